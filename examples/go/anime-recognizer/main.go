@@ -258,7 +258,12 @@ func imageToDataURL(path string) (string, error) {
 	reader := strings.NewReader(string(data))
 	_, format, err := image.DecodeConfig(reader)
 	if err != nil {
-		return "", fmt.Errorf("detect image format: %w", err)
+		// The webp decoder does not handle every variant (e.g. some animated
+		// or lossless files), so fall back to the RIFF container's magic bytes
+		if !isWebP(data) {
+			return "", fmt.Errorf("detect image format: %w", err)
+		}
+		format = "webp"
 	}
 
 	// Map format to MIME type
@@ -273,6 +278,12 @@ func imageToDataURL(path string) (string, error) {
 	return fmt.Sprintf("data:%s;base64,%s", mimeType, encoded), nil
 }
 
+// isWebP reports whether data starts with the header of a webp file:
+// "RIFF", the 4-byte file size, then "WEBP".
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
 // generateRenameActions creates rename actions from recognition results.
 func generateRenameActions(results []RecognitionResult, outputDir string) []RenameAction {
 	var actions []RenameAction
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// undecodableWebP is a webp file whose only chunk is one the webp decoder does
+// not know, as with variants it cannot parse.
+var undecodableWebP = []byte("RIFF\x10\x00\x00\x00WEBPXYZW\x04\x00\x00\x00\x00\x00\x00\x00")
+
+func TestImageToDataURL_WebPFallback(t *testing.T) {
+	if _, _, err := image.DecodeConfig(bytes.NewReader(undecodableWebP)); err == nil {
+		t.Fatal("expected image.DecodeConfig to fail on the test file")
+	}
+	path := filepath.Join(t.TempDir(), "screenshot.webp")
+	if err := os.WriteFile(path, undecodableWebP, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := imageToDataURL(path)
+	if err != nil {
+		t.Fatalf("imageToDataURL: %v", err)
+	}
+	expected := "data:image/webp;base64," + base64.StdEncoding.EncodeToString(undecodableWebP)
+	if url != expected {
+		t.Errorf("expected %s, got %s", expected, url)
+	}
+}
+
+func TestImageToDataURL_UnknownFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.webp")
+	if err := os.WriteFile(path, []byte("RIFF\x10\x00\x00\x00WAVEfmt "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := imageToDataURL(path); err == nil || !strings.Contains(err.Error(), "detect image format") {
+		t.Errorf("expected a format detection error, got %v", err)
+	}
+}
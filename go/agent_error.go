@@ -0,0 +1,73 @@
+package kimi
+
+import (
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+type AgentErrorKind string
+
+const (
+	// AgentErrorKindTool is a tool call that completed with an error result.
+	AgentErrorKindTool AgentErrorKind = "tool"
+)
+
+// AgentError is a machine-readable error raised while the agent worked on a turn.
+type AgentError struct {
+	Kind       AgentErrorKind
+	ToolCallID string
+	Message    string
+	Event      wire.Event // the event the error was derived from
+}
+
+// AgentErrorClassifier reports whether an event represents an agent error.
+type AgentErrorClassifier func(event wire.Event) (AgentError, bool)
+
+// ClassifyAgentError is the default AgentErrorClassifier.
+// The wire protocol has no dedicated error event, so it treats tool results
+// flagged with IsError as agent errors.
+func ClassifyAgentError(event wire.Event) (AgentError, bool) {
+	result, ok := event.(wire.ToolResult)
+	if !ok || !result.ReturnValue.IsError {
+		return AgentError{}, false
+	}
+	message := result.ReturnValue.Message
+	if message == "" {
+		switch output := result.ReturnValue.Output; output.Type {
+		case wire.ContentTypeText:
+			message = output.Text.Value
+		case wire.ContentTypeContentParts:
+			for _, part := range output.ContentParts.Value {
+				if part.Type == wire.ContentPartTypeText {
+					message += part.Text.Value
+				}
+			}
+		}
+	}
+	return AgentError{
+		Kind:       AgentErrorKindTool,
+		ToolCallID: result.ToolCallID,
+		Message:    message,
+		Event:      event,
+	}, true
+}
+
+func (t *Turn) trackAgentError(event wire.Event) {
+	classify := t.classifyError
+	if classify == nil {
+		classify = ClassifyAgentError
+	}
+	agentError, ok := classify(event)
+	if !ok {
+		return
+	}
+	t.errorlock.Lock()
+	defer t.errorlock.Unlock()
+	t.agentErrors = append(t.agentErrors, agentError)
+}
+
+// AgentErrors returns the agent errors collected so far, in the order they occurred.
+func (t *Turn) AgentErrors() []AgentError {
+	t.errorlock.Lock()
+	defer t.errorlock.Unlock()
+	return append([]AgentError(nil), t.agentErrors...)
+}
@@ -0,0 +1,63 @@
+package kimi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ApprovalHandler decides an approval request, e.g. by prompting the user, see
+// WithApprovalHandler. ctx is the context of the Session.Prompt call during
+// which the agent asks for approval.
+type ApprovalHandler func(ctx context.Context, req wire.ApprovalRequest) wire.ApprovalRequestResponse
+
+// sessionApprovals records the actions approved for the rest of the session by
+// an ApprovalHandler.
+type sessionApprovals struct {
+	mu      sync.Mutex
+	actions map[string]bool
+}
+
+func (a *sessionApprovals) approved(action string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.actions[action]
+}
+
+func (a *sessionApprovals) approve(action string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.actions == nil {
+		a.actions = make(map[string]bool)
+	}
+	a.actions[action] = true
+}
+
+// handleApproval decides req with the handler set with WithApprovalHandler,
+// unless its action was approved for the session, and returns the decision and
+// its source. A decision other than approve, approve_for_session or reject is
+// taken as reject.
+func (r *Responder) handleApproval(req wire.ApprovalRequest) (wire.ApprovalRequestResponse, string) {
+	if r.approvals.approved(req.Action) {
+		return wire.ApprovalRequestResponseApprove, ApprovalSourceSessionApproval
+	}
+	decision := r.approvalHandler(r.context(), req)
+	switch decision {
+	case wire.ApprovalRequestResponseApproveForSession:
+		r.approvals.approve(req.Action)
+	case wire.ApprovalRequestResponseApprove, wire.ApprovalRequestResponseReject:
+	default:
+		decision = wire.ApprovalRequestResponseReject
+	}
+	return decision, ApprovalSourceApprovalHandler
+}
+
+// context returns the context of the roundtrip in progress, which handlers
+// called for its requests receive.
+func (r *Responder) context() context.Context {
+	if r.roundtripContext != nil && *r.roundtripContext != nil {
+		return *r.roundtripContext
+	}
+	return context.Background()
+}
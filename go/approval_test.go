@@ -0,0 +1,111 @@
+package kimi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.uber.org/mock/gomock"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
+)
+
+// boundMockTransport is a MockTransport reached through WithTransport, which
+// records the session it delivers the agent's events and requests to.
+type boundMockTransport struct {
+	*transport.MockTransport
+	session transport.Transport
+}
+
+func (b *boundMockTransport) Bind(session transport.Transport) {
+	b.session = session
+}
+
+func TestWithApprovalHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	agent := &boundMockTransport{MockTransport: transport.NewMockTransport(ctrl)}
+
+	requests := []wire.ApprovalRequest{
+		{ID: "req-1", Action: "run shell command"},
+		{ID: "req-2", Action: "edit file"},
+		{ID: "req-3", Action: "run shell command"},
+		{ID: "req-4", Action: "delete file"},
+	}
+	var responses []wire.ApprovalRequestResponse
+	agent.EXPECT().Initialize(gomock.Any()).DoAndReturn(func(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+		return &wire.InitializeResult{ProtocolVersion: params.ProtocolVersion}, nil
+	})
+	agent.EXPECT().Prompt(gomock.Any()).DoAndReturn(func(*wire.PromptParams) (*wire.PromptResult, error) {
+		if _, err := agent.session.Event(&wire.EventParams{Type: wire.EventTypeTurnBegin, Payload: wire.TurnBegin{}}); err != nil {
+			return nil, err
+		}
+		for _, req := range requests {
+			result, err := agent.session.Request(&wire.RequestParams{Type: wire.RequestTypeApprovalRequest, Payload: req})
+			if err != nil {
+				return nil, err
+			}
+			responses = append(responses, result.(*wire.ApprovalResponse).Response)
+		}
+		if _, err := agent.session.Event(&wire.EventParams{Type: wire.EventTypeTurnEnd, Payload: wire.TurnEnd{}}); err != nil {
+			return nil, err
+		}
+		return &wire.PromptResult{Status: wire.PromptResultStatusFinished}, nil
+	})
+	agent.EXPECT().Cancel(gomock.Any()).Return(&wire.CancelResult{}, nil).AnyTimes()
+
+	var asked []string
+	var sources []string
+	session, err := NewSession(
+		WithTransport(agent),
+		WithApprovalHandler(func(ctx context.Context, req wire.ApprovalRequest) wire.ApprovalRequestResponse {
+			asked = append(asked, req.ID)
+			switch req.Action {
+			case "run shell command":
+				return wire.ApprovalRequestResponseApproveForSession
+			case "edit file":
+				return wire.ApprovalRequestResponseApprove
+			}
+			return wire.ApprovalRequestResponseReject
+		}),
+		WithApprovalObserver(func(req wire.ApprovalRequest, decision wire.ApprovalRequestResponse, source string) {
+			sources = append(sources, source)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("clean up"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	for step := range turn.Steps {
+		for msg := range step.Messages {
+			if _, ok := msg.(wire.ApprovalRequest); ok {
+				t.Errorf("expected approval requests not to be delivered on Step.Messages")
+			}
+		}
+	}
+	if err := turn.Err(); err != nil {
+		t.Fatalf("Turn error: %v", err)
+	}
+
+	if expected := []string{"req-1", "req-2", "req-4"}; !reflect.DeepEqual(asked, expected) {
+		t.Errorf("expected the handler to be asked for %v, got %v", expected, asked)
+	}
+	expected := []wire.ApprovalRequestResponse{
+		wire.ApprovalRequestResponseApproveForSession,
+		wire.ApprovalRequestResponseApprove,
+		wire.ApprovalRequestResponseApprove,
+		wire.ApprovalRequestResponseReject,
+	}
+	if !reflect.DeepEqual(responses, expected) {
+		t.Errorf("expected responses %v, got %v", expected, responses)
+	}
+	expectedSources := []string{ApprovalSourceApprovalHandler, ApprovalSourceApprovalHandler, ApprovalSourceSessionApproval, ApprovalSourceApprovalHandler}
+	if !reflect.DeepEqual(sources, expectedSources) {
+		t.Errorf("expected sources %v, got %v", expectedSources, sources)
+	}
+}
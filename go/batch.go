@@ -0,0 +1,143 @@
+package kimi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// CheckpointStore persists which items of a batch have completed, so that a
+// BatchRunner can resume an interrupted run.
+type CheckpointStore interface {
+	// Done reports whether the item with the given ID has completed.
+	Done(id string) (bool, error)
+	// MarkDone records that the item with the given ID has completed. The record
+	// must be durable once MarkDone returns.
+	MarkDone(id string) error
+}
+
+// FileCheckpointStore is a CheckpointStore that appends the ID of each completed
+// item, one per line, to a file.
+type FileCheckpointStore struct {
+	mu   sync.Mutex
+	file *os.File
+	done map[string]bool
+}
+
+// OpenFileCheckpointStore opens, or creates, the checkpoint file at path and
+// loads the IDs it records. A final line left incomplete by an interrupted
+// write is discarded.
+func OpenFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	complete := data[:bytes.LastIndexByte(data, '\n')+1]
+	if len(complete) < len(data) {
+		if err := file.Truncate(int64(len(complete))); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(int64(len(complete)), io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	store := &FileCheckpointStore{file: file, done: make(map[string]bool)}
+	scanner := bufio.NewScanner(bytes.NewReader(complete))
+	for scanner.Scan() {
+		store.done[scanner.Text()] = true
+	}
+	return store, nil
+}
+
+func (s *FileCheckpointStore) Done(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[id], nil
+}
+
+func (s *FileCheckpointStore) MarkDone(id string) error {
+	if id == "" || strings.ContainsAny(id, "\r\n") {
+		return fmt.Errorf("invalid checkpoint id %q", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done[id] {
+		return nil
+	}
+	if _, err := s.file.WriteString(id + "\n"); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.done[id] = true
+	return nil
+}
+
+func (s *FileCheckpointStore) Close() error {
+	return s.file.Close()
+}
+
+// BatchRunner processes a list of items, recording each completed item in a
+// CheckpointStore. Running the same batch again skips the items that have
+// completed, so a run that was interrupted resumes where it stopped.
+type BatchRunner struct {
+	store CheckpointStore
+}
+
+func NewBatchRunner(store CheckpointStore) *BatchRunner {
+	return &BatchRunner{store: store}
+}
+
+// BatchResult reports what a BatchRunner.Run call did with each item.
+type BatchResult struct {
+	Completed []string         // items processed successfully by this run
+	Skipped   []string         // items completed by an earlier run
+	Failed    map[string]error // items whose processing failed; they are retried by the next run
+}
+
+// Run calls process for each item ID, in order, that the store does not record
+// as done, and marks it done when process succeeds. A failing item does not stop
+// the run. Run stops early, returning ctx.Err(), when ctx is done, and returns
+// an error when the store fails; the result describes the items handled so far.
+func (r *BatchRunner) Run(ctx context.Context, ids []string, process func(ctx context.Context, id string) error) (BatchResult, error) {
+	result := BatchResult{Failed: make(map[string]error)}
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		done, err := r.store.Done(id)
+		if err != nil {
+			return result, fmt.Errorf("checkpoint %s: %w", id, err)
+		}
+		if done {
+			result.Skipped = append(result.Skipped, id)
+			continue
+		}
+		if err := process(ctx, id); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+				return result, ctxErr
+			}
+			result.Failed[id] = err
+			continue
+		}
+		if err := r.store.MarkDone(id); err != nil {
+			return result, fmt.Errorf("checkpoint %s: %w", id, err)
+		}
+		result.Completed = append(result.Completed, id)
+	}
+	return result, nil
+}
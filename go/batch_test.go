@@ -0,0 +1,124 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBatchRunner_ResumesInterruptedRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	ids := []string{"a.png", "b.png", "c.png", "d.png", "e.png"}
+
+	store, err := OpenFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCheckpointStore: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var firstRun []string
+	result, err := NewBatchRunner(store).Run(ctx, ids, func(ctx context.Context, id string) error {
+		firstRun = append(firstRun, id)
+		if len(firstRun) == 3 {
+			cancel() // the process dies after the third item
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if !reflect.DeepEqual(result.Completed, ids[:3]) {
+		t.Errorf("expected first run to complete %v, got %v", ids[:3], result.Completed)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	store, err = OpenFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCheckpointStore: %v", err)
+	}
+	defer store.Close()
+	var secondRun []string
+	result, err = NewBatchRunner(store).Run(context.Background(), ids, func(ctx context.Context, id string) error {
+		secondRun = append(secondRun, id)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !reflect.DeepEqual(secondRun, ids[3:]) {
+		t.Errorf("expected resumed run to process %v, got %v", ids[3:], secondRun)
+	}
+	if !reflect.DeepEqual(result.Skipped, ids[:3]) {
+		t.Errorf("expected resumed run to skip %v, got %v", ids[:3], result.Skipped)
+	}
+}
+
+func TestBatchRunner_RetriesFailedItems(t *testing.T) {
+	store, err := OpenFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint"))
+	if err != nil {
+		t.Fatalf("OpenFileCheckpointStore: %v", err)
+	}
+	defer store.Close()
+	runner := NewBatchRunner(store)
+	ids := []string{"a", "b", "c"}
+
+	failure := errors.New("prompt failed")
+	result, err := runner.Run(context.Background(), ids, func(ctx context.Context, id string) error {
+		if id == "b" {
+			return failure
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !reflect.DeepEqual(result.Completed, []string{"a", "c"}) || !errors.Is(result.Failed["b"], failure) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	var processed []string
+	if _, err := runner.Run(context.Background(), ids, func(ctx context.Context, id string) error {
+		processed = append(processed, id)
+		return nil
+	}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !reflect.DeepEqual(processed, []string{"b"}) {
+		t.Errorf("expected only the failed item to be retried, got %v", processed)
+	}
+}
+
+func TestOpenFileCheckpointStore_DiscardsPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	if err := os.WriteFile(path, []byte("a\nb\nc-partial"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	store, err := OpenFileCheckpointStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileCheckpointStore: %v", err)
+	}
+	for id, expected := range map[string]bool{"a": true, "b": true, "c-partial": false} {
+		if done, _ := store.Done(id); done != expected {
+			t.Errorf("Done(%q) = %v, want %v", id, done, expected)
+		}
+	}
+	if err := store.MarkDone("c"); err != nil {
+		t.Fatalf("MarkDone: %v", err)
+	}
+	if err := store.MarkDone("bad\nid"); err == nil {
+		t.Error("expected an error for an ID containing a newline")
+	}
+	store.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("unexpected checkpoint file contents %q", data)
+	}
+}
@@ -0,0 +1,68 @@
+package kimi
+
+import (
+	"strings"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// textCoalescer buffers consecutive text content parts of a step so that they
+// are delivered as a single part. See WithCoalesceText.
+type textCoalescer struct {
+	interval time.Duration
+	pending  strings.Builder
+	buffered bool
+	timer    *time.Timer
+}
+
+// add buffers msg if it is a text content part and coalescing is enabled, and
+// reports whether it did. The buffer becomes due interval after its first part.
+func (c *textCoalescer) add(msg wire.Message) bool {
+	part, ok := msg.(wire.ContentPart)
+	if c.interval <= 0 || !ok || part.Type != wire.ContentPartTypeText {
+		return false
+	}
+	if !c.buffered {
+		c.buffered = true
+		c.timer = time.NewTimer(c.interval)
+	}
+	c.pending.WriteString(part.Text.Value)
+	return true
+}
+
+// due returns a channel that fires when the buffered text must be delivered,
+// or nil when nothing is buffered.
+func (c *textCoalescer) due() <-chan time.Time {
+	if !c.buffered {
+		return nil
+	}
+	return c.timer.C
+}
+
+// take returns the buffered text as a single content part and empties the buffer.
+func (c *textCoalescer) take() (wire.ContentPart, bool) {
+	if !c.buffered {
+		return wire.ContentPart{}, false
+	}
+	c.timer.Stop()
+	part := wire.NewTextContentPart(c.pending.String())
+	c.pending.Reset()
+	c.buffered = false
+	return part, true
+}
+
+// flushText delivers the buffered text, if any, on outgoing. It reports false
+// when the turn stopped before the text could be delivered.
+func (t *Turn) flushText(outgoing chan<- wire.Message) bool {
+	part, ok := t.coalescer.take()
+	if !ok || outgoing == nil {
+		return true
+	}
+	select {
+	case outgoing <- part:
+		return true
+	case <-t.current.Done():
+		return false
+	}
+}
@@ -0,0 +1,86 @@
+package kimi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func collectStepMessages(t *testing.T, turn *Turn, cancel func()) [][]wire.Message {
+	t.Helper()
+	var steps [][]wire.Message
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			var messages []wire.Message
+			for msg := range step.Messages {
+				messages = append(messages, msg)
+			}
+			steps = append(steps, messages)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+	return steps
+}
+
+func TestTurn_CoalesceText(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	turn.coalescer.interval = time.Hour
+
+	call := wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.NewTextContentPart("Let me ")
+		msgs <- wire.NewTextContentPart("search.")
+		msgs <- call
+		msgs <- wire.NewTextContentPart("Searching")
+		msgs <- wire.NewTextContentPart("...")
+		msgs <- wire.StepBegin{N: 2}
+		msgs <- wire.NewTextContentPart("Found ")
+		msgs <- wire.NewTextContentPart("it.")
+		msgs <- wire.TurnEnd{}
+	}()
+
+	got := collectStepMessages(t, turn, cancel)
+	expected := [][]wire.Message{
+		{wire.NewTextContentPart("Let me search."), call, wire.NewTextContentPart("Searching...")},
+		{wire.NewTextContentPart("Found it.")},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v, want %#v", got, expected)
+	}
+}
+
+func TestTurn_CoalesceText_FlushInterval(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	turn.coalescer.interval = 10 * time.Millisecond
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.NewTextContentPart("a")
+		msgs <- wire.NewTextContentPart("b")
+		time.Sleep(100 * time.Millisecond)
+		msgs <- wire.NewTextContentPart("c")
+		msgs <- wire.TurnEnd{}
+	}()
+
+	got := collectStepMessages(t, turn, cancel)
+	expected := [][]wire.Message{
+		{wire.NewTextContentPart("ab"), wire.NewTextContentPart("c")},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v, want %#v", got, expected)
+	}
+}
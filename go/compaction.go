@@ -0,0 +1,124 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// CompactionSummaryFunc extracts the summary of a context compaction from the
+// events received between CompactionBegin and CompactionEnd.
+type CompactionSummaryFunc func(events []wire.Event) (string, bool)
+
+// compactionSummaryFromText is the default CompactionSummaryFunc. CompactionEnd
+// carries no summary, so it joins the text parts streamed during the compaction.
+func compactionSummaryFromText(events []wire.Event) (string, bool) {
+	var (
+		summary strings.Builder
+		found   bool
+	)
+	for _, event := range events {
+		if part, ok := event.(wire.ContentPart); ok && part.Type == wire.ContentPartTypeText {
+			summary.WriteString(part.Text.Value)
+			found = true
+		}
+	}
+	return summary.String(), found
+}
+
+func (t *Turn) trackCompaction(event wire.Event) {
+	switch event.(type) {
+	case wire.CompactionBegin:
+		t.compacting = true
+		t.compactionEvents = nil
+	case wire.CompactionEnd:
+		t.compacted.Store(true)
+		if !t.compacting {
+			return
+		}
+		events := t.compactionEvents
+		t.compacting = false
+		t.compactionEvents = nil
+		if t.summarizeCompaction == nil || t.onCompactionSummary == nil {
+			return
+		}
+		if summary, ok := t.summarizeCompaction(events); ok {
+			t.onCompactionSummary(summary)
+		}
+	default:
+		if t.compacting {
+			t.compactionEvents = append(t.compactionEvents, event)
+		}
+	}
+}
+
+// captureCompactionSummary makes turns report compaction summaries to the session.
+func (s *Session) captureCompactionSummary(extract CompactionSummaryFunc) turnOption {
+	if extract == nil {
+		extract = compactionSummaryFromText
+	}
+	return func(t *Turn) {
+		t.summarizeCompaction = extract
+		t.onCompactionSummary = func(summary string) {
+			s.compactionSummary.Store(&summary)
+		}
+	}
+}
+
+// LastCompactionSummary returns the summary of the most recent context compaction
+// in the session, i.e. what the agent retained of the earlier conversation.
+// It reports false if no compaction has produced a summary yet.
+func (s *Session) LastCompactionSummary() (string, bool) {
+	summary := s.compactionSummary.Load()
+	if summary == nil {
+		return "", false
+	}
+	return *summary, true
+}
+
+// ErrCompactionUnsupported is returned by Session.Compact when the agent does
+// not compact its context on demand.
+var ErrCompactionUnsupported = errors.New("on-demand compaction is not supported")
+
+// compactCommand is the slash command making the agent compact its context.
+const compactCommand = "compact"
+
+// Compact makes the agent compact its context now, e.g. before a large prompt
+// in a long conversation, and blocks until the compaction ends. It sends the
+// /compact slash command as a turn of its own and waits for the turn to end; it
+// fails with ErrTurnInFlight if another turn is in flight, and Prompt fails the
+// same way until the compaction ends. It fails with ErrCompactionUnsupported if
+// the agent does not advertise the command or the turn ends without a
+// CompactionEnd event. If ctx is done first, the turn is cancelled and
+// ctx.Err() is returned.
+func (s *Session) Compact(ctx context.Context) error {
+	if s.Features().SupportsInitialize && !s.hasSlashCommand(compactCommand) {
+		return ErrCompactionUnsupported
+	}
+	turn, err := s.prompt(ctx, wire.NewStringContent("/"+compactCommand), 0, true)
+	if err != nil {
+		return err
+	}
+	if err := turn.Drain(ctx); err != nil {
+		return err
+	}
+	if !turn.compacted.Load() {
+		return fmt.Errorf("%w: the turn ended without CompactionEnd", ErrCompactionUnsupported)
+	}
+	return nil
+}
+
+// hasSlashCommand reports whether the agent advertised the slash command name,
+// or an alias of it, at initialize.
+func (s *Session) hasSlashCommand(name string) bool {
+	for _, command := range s.SlashCommands {
+		if command.Name == name || slices.Contains(command.Aliases, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func runCompactionTurn(t *testing.T, session *Session, extract CompactionSummaryFunc, events ...wire.Message) {
+	t.Helper()
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	session.captureCompactionSummary(extract)(turn)
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	for _, event := range events {
+		msgs <- event
+	}
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+}
+
+func TestSession_LastCompactionSummary(t *testing.T) {
+	session := &Session{}
+	if _, ok := session.LastCompactionSummary(); ok {
+		t.Fatal("expected no summary before any compaction")
+	}
+
+	runCompactionTurn(t, session, nil,
+		wire.NewTextContentPart("before compaction"),
+		wire.CompactionBegin{},
+		wire.NewTextContentPart("The user is refactoring "),
+		wire.NewTextContentPart("the session package."),
+		wire.CompactionEnd{},
+		wire.NewTextContentPart("after compaction"),
+	)
+
+	summary, ok := session.LastCompactionSummary()
+	if !ok {
+		t.Fatal("expected a compaction summary")
+	}
+	if summary != "The user is refactoring the session package." {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+}
+
+func TestSession_LastCompactionSummary_NoSummary(t *testing.T) {
+	session := &Session{}
+	runCompactionTurn(t, session, nil, wire.CompactionBegin{}, wire.CompactionEnd{})
+
+	if summary, ok := session.LastCompactionSummary(); ok {
+		t.Errorf("expected no summary for a compaction without content, got %q", summary)
+	}
+}
+
+func TestSession_LastCompactionSummary_CustomExtractor(t *testing.T) {
+	session := &Session{}
+	var seen []wire.Event
+	runCompactionTurn(t, session, func(events []wire.Event) (string, bool) {
+		seen = events
+		return "custom", true
+	},
+		wire.CompactionBegin{},
+		wire.NewTextContentPart("ignored"),
+		wire.CompactionEnd{},
+	)
+
+	if summary, _ := session.LastCompactionSummary(); summary != "custom" {
+		t.Errorf("expected custom summary, got %q", summary)
+	}
+	if len(seen) != 1 {
+		t.Errorf("expected the extractor to see 1 event, got %d", len(seen))
+	}
+}
+
+func TestSession_Compact_TurnInFlight(t *testing.T) {
+	session := &Session{
+		wireProtocolVersion: "1.2",
+		SlashCommands:       []wire.SlashCommand{{Name: compactCommand}},
+	}
+	// A prompt has been sent but no turn has begun yet.
+	session.wireMessageBridge = make(chan wire.Message)
+
+	if err := session.Compact(context.Background()); !errors.Is(err, ErrTurnInFlight) {
+		t.Errorf("expected ErrTurnInFlight, got %v", err)
+	}
+}
+
+func TestSession_Prompt_DuringCompaction(t *testing.T) {
+	session := &Session{wireProtocolVersion: "1.2", exclusive: 1}
+
+	if _, err := session.Prompt(context.Background(), wire.NewStringContent("hi")); !errors.Is(err, ErrTurnInFlight) {
+		t.Errorf("expected ErrTurnInFlight, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package kimi
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ErrContentPartTooLarge is returned by Session.Prompt, before anything is
+// sent, when a content part is larger than the limit set with
+// WithMaxContentPartBytes.
+var ErrContentPartTooLarge = errors.New("content part too large")
+
+// checkContentPartSizes returns an error wrapping ErrContentPartTooLarge if a
+// part of content is larger than limit bytes once decoded.
+func checkContentPartSizes(content wire.Content, limit int64) error {
+	if limit <= 0 {
+		return nil
+	}
+	switch content.Type {
+	case wire.ContentTypeText:
+		if size := int64(len(content.Text.Value)); size > limit {
+			return fmt.Errorf("%w: text is %d bytes, over the limit of %d", ErrContentPartTooLarge, size, limit)
+		}
+	case wire.ContentTypeContentParts:
+		for i, part := range content.ContentParts.Value {
+			if size := contentPartSize(part); size > limit {
+				return fmt.Errorf("%w: part %d (%s) is %d bytes, over the limit of %d",
+					ErrContentPartTooLarge, i, part.Type, size, limit)
+			}
+		}
+	}
+	return nil
+}
+
+// contentPartSize returns the size of the data a content part carries: the
+// length of its text, or the decoded length of its data URL. Remote URLs are
+// fetched by the agent, not sent, and count as empty.
+func contentPartSize(part wire.ContentPart) int64 {
+	for _, text := range []wire.Optional[string]{part.Text, part.Think} {
+		if text.Valid {
+			return int64(len(text.Value))
+		}
+	}
+	for _, media := range []wire.Optional[wire.MediaURL]{part.ImageURL, part.AudioURL, part.VideoURL} {
+		if media.Valid {
+			return dataURLSize(media.Value.URL)
+		}
+	}
+	return 0
+}
+
+// dataURLSize returns the length of the data of a data URL, without decoding
+// it, or 0 if rawURL is not a data URL.
+func dataURLSize(rawURL string) int64 {
+	rest, ok := strings.CutPrefix(rawURL, "data:")
+	if !ok {
+		return 0
+	}
+	header, payload, ok := strings.Cut(rest, ",")
+	if !ok {
+		return 0
+	}
+	if !strings.HasSuffix(header, ";base64") {
+		if data, err := url.PathUnescape(payload); err == nil {
+			return int64(len(data))
+		}
+		return int64(len(payload))
+	}
+	return int64(len(strings.TrimRight(payload, "="))) * 3 / 4
+}
@@ -0,0 +1,53 @@
+package kimi
+
+import (
+	"encoding/json"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ContentSize returns the size in bytes of c encoded as JSON, as it is sent on
+// the wire as the user input of a prompt, e.g. to decide how many images fit in
+// a prompt before sending it. It returns 0 if c cannot be encoded.
+func ContentSize(c wire.Content) int {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// Tokenizer counts the tokens of a text for a model, see EstimateTokens.
+type Tokenizer interface {
+	CountTokens(text string) int
+}
+
+// bytesPerToken is the average number of bytes of text per token assumed by
+// EstimateTokens without a Tokenizer.
+const bytesPerToken = 4
+
+// EstimateTokens estimates the number of tokens of the text of c, counted with
+// tokenizer, or, if tokenizer is nil, assuming a token for every 4 bytes of
+// text. Media parts are not counted: how many tokens an image, audio or video
+// costs depends on the model.
+func EstimateTokens(c wire.Content, tokenizer Tokenizer) int {
+	count := func(text string) int {
+		if tokenizer != nil {
+			return tokenizer.CountTokens(text)
+		}
+		return (len(text) + bytesPerToken - 1) / bytesPerToken
+	}
+	switch c.Type {
+	case wire.ContentTypeText:
+		return count(c.Text.Value)
+	case wire.ContentTypeContentParts:
+		tokens := 0
+		for _, part := range c.ContentParts.Value {
+			if part.Type == wire.ContentPartTypeText {
+				tokens += count(part.Text.Value)
+			}
+		}
+		return tokens
+	}
+	return 0
+}
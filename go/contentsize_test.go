@@ -0,0 +1,48 @@
+package kimi
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestContentSize(t *testing.T) {
+	content := wire.NewContent(
+		wire.NewTextContentPart("Describe these frames"),
+		wire.NewImageContentPart("data:image/png;base64,iVBORw0KGgo="),
+		wire.NewImageContentPart("https://example.com/frame-2.png"),
+	)
+	data, err := json.Marshal(content)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if size := ContentSize(content); size != len(data) {
+		t.Errorf("expected %d bytes, got %d", len(data), size)
+	}
+}
+
+type wordTokenizer struct{}
+
+func (wordTokenizer) CountTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+func TestEstimateTokens(t *testing.T) {
+	content := wire.NewContent(
+		wire.NewTextContentPart("one two three"),
+		wire.NewImageContentPart("https://example.com/frame.png"),
+		wire.NewTextContentPart("four"),
+	)
+	if tokens := EstimateTokens(content, wordTokenizer{}); tokens != 4 {
+		t.Errorf("expected 4 tokens with the tokenizer, got %d", tokens)
+	}
+	// 13 and 4 bytes of text, a token for every 4 bytes rounded up.
+	if tokens := EstimateTokens(content, nil); tokens != 5 {
+		t.Errorf("expected 5 tokens without a tokenizer, got %d", tokens)
+	}
+	if tokens := EstimateTokens(wire.NewStringContent("12345678"), nil); tokens != 2 {
+		t.Errorf("expected 2 tokens for a string content, got %d", tokens)
+	}
+}
@@ -0,0 +1,95 @@
+package kimi
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// TurnDiff is the difference between the tool calls of two turns, as computed
+// by DiffTurns, e.g. to compare a candidate prompt or model with a baseline in
+// an evaluation harness.
+type TurnDiff struct {
+	Added   []ToolCallDiff // calls made by the second turn only
+	Removed []ToolCallDiff // calls made by the first turn only
+	Changed []ToolCallDiff // calls made by both turns, with different arguments
+}
+
+// ToolCallDiff is a tool call that differs between two turns. Before holds its
+// arguments in the first turn and After in the second; the one of a turn that
+// did not make the call is empty.
+type ToolCallDiff struct {
+	Name   string
+	Before string
+	After  string
+}
+
+// Empty reports whether the turns made the same tool calls.
+func (d TurnDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffTurns compares the tool calls of a and b. The calls to a tool are matched
+// in call order: the n-th call to a tool in a with the n-th call to the same
+// tool in b. Matched calls whose arguments are not the same JSON value are
+// changed; the calls left unmatched are removed, if made by a, or added, if
+// made by b. The order in which different tools are called is not compared.
+func DiffTurns(a, b TurnSummary) TurnDiff {
+	var diff TurnDiff
+	matched := make(map[string]int) // calls to each tool in a
+	for i, name := range a.ToolCalls {
+		before := toolCallArguments(a, i)
+		n := matched[name]
+		matched[name]++
+		j := nthToolCall(b, name, n)
+		if j < 0 {
+			diff.Removed = append(diff.Removed, ToolCallDiff{Name: name, Before: before})
+			continue
+		}
+		if after := toolCallArguments(b, j); !sameJSON(before, after) {
+			diff.Changed = append(diff.Changed, ToolCallDiff{Name: name, Before: before, After: after})
+		}
+	}
+	seen := make(map[string]int)
+	for j, name := range b.ToolCalls {
+		seen[name]++
+		if seen[name] > matched[name] {
+			diff.Added = append(diff.Added, ToolCallDiff{Name: name, After: toolCallArguments(b, j)})
+		}
+	}
+	return diff
+}
+
+// nthToolCall returns the index in s of the n-th call, from 0, to the tool
+// name, or -1 if there are not as many.
+func nthToolCall(s TurnSummary, name string, n int) int {
+	for i, called := range s.ToolCalls {
+		if called != name {
+			continue
+		}
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return -1
+}
+
+func toolCallArguments(s TurnSummary, i int) string {
+	if i < len(s.ToolCallArguments) {
+		return s.ToolCallArguments[i]
+	}
+	return ""
+}
+
+// sameJSON reports whether x and y encode the same JSON value, regardless of
+// the order of object keys and of white space. Documents that are not valid
+// JSON are compared as text.
+func sameJSON(x, y string) bool {
+	var vx, vy any
+	if json.Unmarshal([]byte(x), &vx) != nil || json.Unmarshal([]byte(y), &vy) != nil {
+		return x == y
+	}
+	ex, _ := json.Marshal(vx)
+	ey, _ := json.Marshal(vy)
+	return bytes.Equal(ex, ey)
+}
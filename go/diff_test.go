@@ -0,0 +1,33 @@
+package kimi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffTurns(t *testing.T) {
+	baseline := TurnSummary{
+		ToolCalls:         []string{"search", "fetch", "search", "summarize"},
+		ToolCallArguments: []string{`{"query":"go","limit":5}`, `{"url":"https://go.dev"}`, `{"query":"rust"}`, `{}`},
+	}
+	candidate := TurnSummary{
+		ToolCalls:         []string{"search", "search", "fetch", "translate"},
+		ToolCallArguments: []string{`{"limit": 5, "query": "go"}`, `{"query":"zig"}`, `{"url":"https://go.dev"}`, `{"to":"fr"}`},
+	}
+
+	diff := DiffTurns(baseline, candidate)
+	expected := TurnDiff{
+		Added:   []ToolCallDiff{{Name: "translate", After: `{"to":"fr"}`}},
+		Removed: []ToolCallDiff{{Name: "summarize", Before: `{}`}},
+		Changed: []ToolCallDiff{{Name: "search", Before: `{"query":"rust"}`, After: `{"query":"zig"}`}},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %+v, got %+v", expected, diff)
+	}
+	if diff.Empty() {
+		t.Error("expected the diff not to be empty")
+	}
+	if diff := DiffTurns(baseline, baseline); !diff.Empty() {
+		t.Errorf("expected no difference between a turn and itself, got %+v", diff)
+	}
+}
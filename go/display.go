@@ -0,0 +1,79 @@
+package kimi
+
+import (
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ToolOutput is a tool result that carries display blocks for the user, such as
+// the diff of a file the tool edited. A tool function returns it, or a pointer to
+// it, in place of its plain result.
+type ToolOutput struct {
+	// Output is the result sent to the model. It is converted like the result of
+	// a tool function: wire.Content as is, strings and fmt.Stringers as text, and
+	// any other value as JSON.
+	Output any
+	// Display holds the blocks shown to the user alongside the result.
+	Display []DisplayBlock
+}
+
+// DisplayBlock is a block shown to the user alongside a tool result. Create one
+// with BriefDisplay, DiffDisplay, TodoDisplay or ShellDisplay.
+type DisplayBlock struct {
+	block wire.DisplayBlock
+}
+
+// BriefDisplay returns a block showing a short summary.
+func BriefDisplay(text string) DisplayBlock {
+	return DisplayBlock{wire.DisplayBlock{
+		Type: wire.DisplayBlockTypeBrief,
+		Text: wire.Optional[string]{Value: text, Valid: true},
+	}}
+}
+
+// DiffDisplay returns a block showing the change of the file at path from oldText
+// to newText.
+func DiffDisplay(path, oldText, newText string) DisplayBlock {
+	return DisplayBlock{wire.DisplayBlock{
+		Type:    wire.DisplayBlockTypeDiff,
+		Path:    wire.Optional[string]{Value: path, Valid: true},
+		OldText: wire.Optional[string]{Value: oldText, Valid: true},
+		NewText: wire.Optional[string]{Value: newText, Valid: true},
+	}}
+}
+
+// ShellDisplay returns a block showing a command in the given shell language,
+// such as "bash".
+func ShellDisplay(language, command string) DisplayBlock {
+	return DisplayBlock{wire.DisplayBlock{
+		Type:     wire.DisplayBlockTypeShell,
+		Language: wire.Optional[string]{Value: language, Valid: true},
+		Command:  wire.Optional[string]{Value: command, Valid: true},
+	}}
+}
+
+// TodoStatus is the status of a TodoItem.
+type TodoStatus string
+
+const (
+	TodoPending    TodoStatus = TodoStatus(wire.TodoStatusPending)
+	TodoInProgress TodoStatus = TodoStatus(wire.TodoStatusInProgress)
+	TodoDone       TodoStatus = TodoStatus(wire.TodoStatusDone)
+)
+
+// TodoItem is an entry of a TodoDisplay block.
+type TodoItem struct {
+	Title  string
+	Status TodoStatus
+}
+
+// TodoDisplay returns a block showing a todo list.
+func TodoDisplay(items ...TodoItem) DisplayBlock {
+	todos := make([]wire.DisplayBlockTodoItem, len(items))
+	for i, item := range items {
+		todos[i] = wire.DisplayBlockTodoItem{Title: item.Title, Status: wire.TodoStatus(item.Status)}
+	}
+	return DisplayBlock{wire.DisplayBlock{
+		Type:  wire.DisplayBlockTypeTodo,
+		Items: wire.Optional[[]wire.DisplayBlockTodoItem]{Value: todos, Valid: true},
+	}}
+}
@@ -0,0 +1,56 @@
+package kimi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestCreateTool_ToolOutputDisplay(t *testing.T) {
+	type EditArgs struct {
+		Path string `json:"path"`
+	}
+	tool, err := CreateTool(func(args EditArgs) (*ToolOutput, error) {
+		return &ToolOutput{
+			Output: map[string]int{"replacements": 1},
+			Display: []DisplayBlock{
+				DiffDisplay(args.Path, "old line\n", "new line\n"),
+				TodoDisplay(TodoItem{Title: "Edit file", Status: TodoDone}, TodoItem{Title: "Run tests", Status: TodoPending}),
+			},
+		}, nil
+	}, WithName("edit_file"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	returnValue, err := tool.call(context.Background(), json.RawMessage(`{"path":"main.go"}`))
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	got, err := json.Marshal(returnValue)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	expected := `{"is_error":false,"output":"{\"replacements\":1}","message":"",` +
+		`"display":[{"type":"diff","path":"main.go","old_text":"old line\n","new_text":"new line\n"},` +
+		`{"type":"todo","items":[{"title":"Edit file","status":"done"},{"title":"Run tests","status":"pending"}]}]}`
+	if string(got) != expected {
+		t.Errorf("return value mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestCreateTool_PlainResultHasNoDisplay(t *testing.T) {
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return args.Input, nil
+	}, WithName("echo"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	returnValue, err := tool.call(context.Background(), json.RawMessage(`{"input":"hi"}`))
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if returnValue.Display == nil || len(returnValue.Display) != 0 {
+		t.Errorf("expected an empty display list, got %#v", returnValue.Display)
+	}
+}
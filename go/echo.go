@@ -0,0 +1,44 @@
+package kimi
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// EchoMismatchFunc is called when the user input echoed in TurnBegin differs
+// from the content that was submitted with Prompt.
+type EchoMismatchFunc func(sent, echoed wire.Content)
+
+func (t *Turn) verifyEcho(begin wire.TurnBegin) {
+	if t.onEchoMismatch == nil || sameContent(t.input, begin.UserInput) {
+		return
+	}
+	t.onEchoMismatch(t.input, begin.UserInput)
+}
+
+// sameContent compares two contents by their parts, so that a plain string and
+// a single text part carrying the same string are considered equal.
+func sameContent(a, b wire.Content) bool {
+	x, err := json.Marshal(contentParts(a))
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(contentParts(b))
+	if err != nil {
+		return false
+	}
+	return slices.Equal(x, y)
+}
+
+func contentParts(content wire.Content) []wire.ContentPart {
+	switch content.Type {
+	case wire.ContentTypeText:
+		return []wire.ContentPart{wire.NewTextContentPart(content.Text.Value)}
+	case wire.ContentTypeContentParts:
+		return content.ContentParts.Value
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package kimi
+
+import (
+	"context"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+type TurnEventKind string
+
+const (
+	TurnEventText       TurnEventKind = "text"
+	TurnEventThink      TurnEventKind = "think"
+	TurnEventToolCall   TurnEventKind = "tool_call"
+	TurnEventToolResult TurnEventKind = "tool_result"
+	TurnEventApproval   TurnEventKind = "approval"
+	// TurnEventToolCallComplete is synthesized once the arguments of a tool
+	// call have been received whole, see ToolCallAssembler. Its Message is the
+	// wire.ToolCall with the arguments reassembled from its fragments.
+	TurnEventToolCallComplete TurnEventKind = "tool_call_complete"
+	// TurnEventOther covers every message without a dedicated kind,
+	// such as tool call argument parts or media content parts.
+	TurnEventOther TurnEventKind = "other"
+)
+
+// TurnEvent is a categorized message of a turn. The accessors return the
+// payload of the matching kind and report false for any other kind.
+type TurnEvent struct {
+	Kind    TurnEventKind
+	Step    int          // number of the step the message belongs to
+	Message wire.Message // the raw message
+}
+
+func newTurnEvent(step int, msg wire.Message) TurnEvent {
+	event := TurnEvent{Kind: TurnEventOther, Step: step, Message: msg}
+	switch x := msg.(type) {
+	case wire.ContentPart:
+		switch x.Type {
+		case wire.ContentPartTypeText:
+			event.Kind = TurnEventText
+		case wire.ContentPartTypeThink:
+			event.Kind = TurnEventThink
+		}
+	case wire.ToolCall:
+		event.Kind = TurnEventToolCall
+	case wire.ToolResult:
+		event.Kind = TurnEventToolResult
+	case wire.ApprovalRequest:
+		event.Kind = TurnEventApproval
+	}
+	return event
+}
+
+func (e TurnEvent) Text() (string, bool) {
+	if e.Kind != TurnEventText {
+		return "", false
+	}
+	return e.Message.(wire.ContentPart).Text.Value, true
+}
+
+func (e TurnEvent) Think() (string, bool) {
+	if e.Kind != TurnEventThink {
+		return "", false
+	}
+	return e.Message.(wire.ContentPart).Think.Value, true
+}
+
+func (e TurnEvent) ToolCall() (wire.ToolCall, bool) {
+	if e.Kind != TurnEventToolCall {
+		return wire.ToolCall{}, false
+	}
+	return e.Message.(wire.ToolCall), true
+}
+
+// CompletedToolCall returns the tool call of a TurnEventToolCallComplete event,
+// with its arguments whole.
+func (e TurnEvent) CompletedToolCall() (wire.ToolCall, bool) {
+	if e.Kind != TurnEventToolCallComplete {
+		return wire.ToolCall{}, false
+	}
+	return e.Message.(wire.ToolCall), true
+}
+
+func (e TurnEvent) ToolResult() (wire.ToolResult, bool) {
+	if e.Kind != TurnEventToolResult {
+		return wire.ToolResult{}, false
+	}
+	return e.Message.(wire.ToolResult), true
+}
+
+// ApprovalRequest returns the approval request, which must be responded to
+// as when it is received from Step.Messages.
+func (e TurnEvent) ApprovalRequest() (wire.ApprovalRequest, bool) {
+	if e.Kind != TurnEventApproval {
+		return wire.ApprovalRequest{}, false
+	}
+	return e.Message.(wire.ApprovalRequest), true
+}
+
+// Events flattens the turn's steps into a single channel of categorized events,
+// closed when the turn ends. Each tool call is delivered as it starts, followed
+// by its argument fragments, as TurnEventOther, and then, once its arguments
+// are whole, again as a synthesized TurnEventToolCallComplete event. It consumes
+// Steps, so use either Events or Steps, not both; call it at most once.
+//
+// The turn makes no progress while an event waits to be received. A consumer
+// that stops reading before the channel is closed must cancel ctx: the turn is
+// then cancelled, its remaining messages are discarded and approval requests
+// rejected as by Drain, and the channel is closed once the turn has ended.
+func (t *Turn) Events(ctx context.Context) <-chan TurnEvent {
+	events := make(chan TurnEvent)
+	go func() {
+		defer close(events)
+		send := func(event TurnEvent) bool {
+			if ctx.Err() != nil {
+				return false
+			}
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if !t.sendEvents(send) {
+			t.Drain(ctx)
+		}
+	}()
+	return events
+}
+
+// sendEvents passes the events of the turn to send until the turn ends, or
+// until send reports that the events are no longer received.
+func (t *Turn) sendEvents(send func(TurnEvent) bool) bool {
+	for step := range t.Steps {
+		var calls ToolCallAssembler
+		for msg := range step.Messages {
+			if call, ok := calls.Add(msg); ok {
+				if !send(TurnEvent{Kind: TurnEventToolCallComplete, Step: step.n, Message: call}) {
+					return false
+				}
+			}
+			if !send(newTurnEvent(step.n, msg)) {
+				return false
+			}
+		}
+		if call, ok := calls.Flush(); ok {
+			if !send(TurnEvent{Kind: TurnEventToolCallComplete, Step: step.n, Message: call}) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package kimi
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestTurn_Events(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	think := wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "pondering", Valid: true}}
+	call := wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}
+	part := wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `{}`, Valid: true}}
+	result := wire.ToolResult{ToolCallID: "call-1"}
+	image := wire.NewImageContentPart("https://example.com/a.png")
+	raw := []struct {
+		step int
+		msg  wire.Message
+	}{
+		{1, think},
+		{1, wire.NewTextContentPart("Let me search.")},
+		{1, call},
+		{1, part},
+		{1, result},
+		{2, image},
+		{2, wire.NewTextContentPart("Found it.")},
+	}
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		step := 0
+		for _, r := range raw {
+			if r.step != step {
+				step = r.step
+				msgs <- wire.StepBegin{N: step}
+			}
+			msgs <- r.msg
+		}
+		msgs <- wire.TurnEnd{}
+	}()
+
+	var events []TurnEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range turn.Events(context.Background()) {
+			events = append(events, event)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	// The synthesized completion of the tool call precedes the message that
+	// follows its arguments.
+	if len(events) != len(raw)+1 || events[4].Kind != TurnEventToolCallComplete {
+		t.Fatalf("expected %d events with a tool call completion at 4, got %+v", len(raw)+1, events)
+	}
+	if got, ok := events[4].CompletedToolCall(); !ok || got.ID != "call-1" || got.Function.Arguments.Value != `{}` {
+		t.Errorf("CompletedToolCall() = %+v, %v", got, ok)
+	}
+	events = slices.Delete(events, 4, 5)
+
+	if len(events) != len(raw) {
+		t.Fatalf("expected %d events, got %d", len(raw), len(events))
+	}
+	for i, event := range events {
+		if event.Step != raw[i].step || !reflect.DeepEqual(event.Message, raw[i].msg) {
+			t.Errorf("event %d: got step %d %#v, want step %d %#v", i, event.Step, event.Message, raw[i].step, raw[i].msg)
+		}
+	}
+
+	expectedKinds := []TurnEventKind{
+		TurnEventThink, TurnEventText, TurnEventToolCall, TurnEventOther, TurnEventToolResult, TurnEventOther, TurnEventText,
+	}
+	for i, kind := range expectedKinds {
+		if events[i].Kind != kind {
+			t.Errorf("event %d: expected kind %s, got %s", i, kind, events[i].Kind)
+		}
+	}
+	if got, ok := events[0].Think(); !ok || got != "pondering" {
+		t.Errorf("Think() = %q, %v", got, ok)
+	}
+	if got, ok := events[1].Text(); !ok || got != "Let me search." {
+		t.Errorf("Text() = %q, %v", got, ok)
+	}
+	if got, ok := events[2].ToolCall(); !ok || got.ID != "call-1" {
+		t.Errorf("ToolCall() = %+v, %v", got, ok)
+	}
+	if got, ok := events[4].ToolResult(); !ok || got.ToolCallID != "call-1" {
+		t.Errorf("ToolResult() = %+v, %v", got, ok)
+	}
+	if _, ok := events[1].ToolCall(); ok {
+		t.Error("expected ToolCall() to report false for a text event")
+	}
+	if _, ok := events[2].Text(); ok {
+		t.Error("expected Text() to report false for a tool call event")
+	}
+}
+
+func TestTurn_Events_ToolCallComplete(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "fetch", Arguments: wire.Optional[string]{Value: `{"ur`, Valid: true}}}
+		msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `l":"https://go`, Valid: true}}
+		msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `.dev"}`, Valid: true}}
+		msgs <- wire.ToolCall{ID: "call-2", Function: wire.ToolCallFunction{Name: "search"}}
+		msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `{"q":`, Valid: true}}
+		msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `"go"}`, Valid: true}}
+		msgs <- wire.TurnEnd{}
+	}()
+
+	var kinds []TurnEventKind
+	var completed []wire.ToolCall
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for event := range turn.Events(context.Background()) {
+			kinds = append(kinds, event.Kind)
+			if call, ok := event.CompletedToolCall(); ok {
+				completed = append(completed, call)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	expectedKinds := []TurnEventKind{
+		TurnEventToolCall, TurnEventOther, TurnEventOther,
+		TurnEventToolCallComplete, TurnEventToolCall, TurnEventOther, TurnEventOther,
+		TurnEventToolCallComplete,
+	}
+	if !slices.Equal(kinds, expectedKinds) {
+		t.Fatalf("expected kinds %v, got %v", expectedKinds, kinds)
+	}
+	if len(completed) != 2 {
+		t.Fatalf("expected 2 completed calls, got %d", len(completed))
+	}
+	if got := completed[0].Function.Arguments.Value; got != `{"url":"https://go.dev"}` {
+		t.Errorf("expected the first call's arguments whole, got %q", got)
+	}
+	if got := completed[1]; got.ID != "call-2" || got.Function.Arguments.Value != `{"q":"go"}` || !got.Function.Arguments.Valid {
+		t.Errorf("expected the second call completed when its step ended, got %+v", got)
+	}
+}
+
+func TestTurn_Events_Abandoned(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("first")
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "hmm", Valid: true}}
+	msgs <- wire.NewTextContentPart("second")
+
+	ctx, stop := context.WithCancel(context.Background())
+	events := turn.Events(ctx)
+	if _, ok := (<-events).Text(); !ok {
+		t.Fatal("expected the first event to be text")
+	}
+	// The consumer stops reading and cancels ctx; the agent ends the stream
+	// once the turn is cancelled.
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	closeMsgs()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected no events once ctx is done")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the events to be closed once ctx is done")
+	}
+	if !turn.cancelled.Load() {
+		t.Error("expected the turn to be cancelled")
+	}
+}
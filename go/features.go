@@ -0,0 +1,52 @@
+package kimi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Features describes the protocol capabilities negotiated with the kimi CLI.
+// Branch on these instead of comparing wire protocol versions directly.
+type Features struct {
+	// SupportsInitialize reports whether the session performed the initialize
+	// handshake, which carries slash commands and external tool registration.
+	SupportsInitialize bool
+	// SupportsExternalTools reports whether tools registered with WithTools are
+	// advertised to the CLI and dispatched to the SDK.
+	SupportsExternalTools bool
+	// SupportsTurnEnd reports whether the CLI marks the end of a turn with a
+	// TurnEnd event, so a stream that stops without it is PromptResultStatusUnexpectedEOF.
+	SupportsTurnEnd bool
+	// SupportsEncryptedThink reports whether think content parts may carry
+	// an Encrypted payload.
+	SupportsEncryptedThink bool
+}
+
+func featuresFor(wireProtocolVersion string) Features {
+	major, minor := parseProtocolVersion(wireProtocolVersion)
+	atLeast := func(wantMajor, wantMinor int) bool {
+		return major > wantMajor || major == wantMajor && minor >= wantMinor
+	}
+	return Features{
+		SupportsInitialize:     atLeast(1, 1),
+		SupportsExternalTools:  atLeast(1, 1),
+		SupportsTurnEnd:        atLeast(1, 2),
+		SupportsEncryptedThink: atLeast(1, 2),
+	}
+}
+
+// parseProtocolVersion returns the major and minor numbers of a wire protocol
+// version such as "1.2", compared as integers so that "1.10" follows "1.9". A
+// missing or malformed number is 0.
+func parseProtocolVersion(version string) (major, minor int) {
+	majorPart, rest, _ := strings.Cut(version, ".")
+	minorPart, _, _ := strings.Cut(rest, ".")
+	major, _ = strconv.Atoi(majorPart)
+	minor, _ = strconv.Atoi(minorPart)
+	return major, minor
+}
+
+// Features returns the capabilities derived from the negotiated wire protocol version.
+func (s *Session) Features() Features {
+	return featuresFor(s.wireProtocolVersion)
+}
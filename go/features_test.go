@@ -0,0 +1,36 @@
+package kimi
+
+import "testing"
+
+func TestSession_Features(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected Features
+	}{
+		{"", Features{}},
+		{"1.0", Features{}},
+		{"1.1", Features{SupportsInitialize: true, SupportsExternalTools: true}},
+		{"1.2", Features{SupportsInitialize: true, SupportsExternalTools: true, SupportsTurnEnd: true, SupportsEncryptedThink: true}},
+		{"1.2.1", Features{SupportsInitialize: true, SupportsExternalTools: true, SupportsTurnEnd: true, SupportsEncryptedThink: true}},
+		{"1.10", Features{SupportsInitialize: true, SupportsExternalTools: true, SupportsTurnEnd: true, SupportsEncryptedThink: true}},
+		{"2", Features{SupportsInitialize: true, SupportsExternalTools: true, SupportsTurnEnd: true, SupportsEncryptedThink: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			session := &Session{wireProtocolVersion: tt.version}
+			if got := session.Features(); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSession_Features_TurnEnd(t *testing.T) {
+	if !(&Session{wireProtocolVersion: "1.2"}).Features().SupportsTurnEnd {
+		t.Error("expected a 1.2 session to support TurnEnd")
+	}
+	if (&Session{wireProtocolVersion: "1.1"}).Features().SupportsTurnEnd {
+		t.Error("expected a 1.1 session not to support TurnEnd")
+	}
+}
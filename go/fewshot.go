@@ -0,0 +1,67 @@
+package kimi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// Exchange is an example conversation turn, shown to the model as few-shot
+// context with WithFewShotExamples: the user's message, the tool calls the
+// assistant made in response, and the assistant's final answer.
+type Exchange struct {
+	User      string
+	ToolCalls []ExampleToolCall
+	Assistant string
+}
+
+// ExampleToolCall is a tool call made in an Exchange, with the arguments as a
+// JSON document and the result the tool returned.
+type ExampleToolCall struct {
+	Name      string
+	Arguments string
+	Result    string
+}
+
+// fewShotPreamble introduces the examples to the model, so that they are not
+// taken as part of the conversation.
+const fewShotPreamble = "The following examples show how to respond to requests like the one below " +
+	"and how to use the tools to do so. They are for reference only and are not part of this conversation."
+
+// formatFewShotExamples serializes examples, in order, into the text sent
+// ahead of the first prompt of a session.
+func formatFewShotExamples(examples []Exchange) string {
+	var b strings.Builder
+	b.WriteString(fewShotPreamble)
+	for i, example := range examples {
+		fmt.Fprintf(&b, "\n\n<example index=\"%d\">\n", i+1)
+		fmt.Fprintf(&b, "User: %s\n", example.User)
+		for _, call := range example.ToolCalls {
+			fmt.Fprintf(&b, "Tool call: %s(%s)\n", call.Name, call.Arguments)
+			fmt.Fprintf(&b, "Tool result: %s\n", call.Result)
+		}
+		fmt.Fprintf(&b, "Assistant: %s\n", example.Assistant)
+		b.WriteString("</example>")
+	}
+	return b.String()
+}
+
+// withFewShotExamples returns content preceded by the few-shot examples of the
+// session, if they have not been sent yet, along with the examples it took.
+// Only the first prompt carries them; a prompt that fails puts them back.
+func (s *Session) withFewShotExamples(content wire.Content) (wire.Content, *string) {
+	examples := s.fewShotExamples.Swap(nil)
+	if examples == nil {
+		return content, nil
+	}
+	switch content.Type {
+	case wire.ContentTypeText:
+		return wire.NewStringContent(*examples + "\n\n" + content.Text.Value), examples
+	case wire.ContentTypeContentParts:
+		parts := append([]wire.ContentPart{wire.NewTextContentPart(*examples)}, content.ContentParts.Value...)
+		return wire.NewContent(parts...), examples
+	default:
+		return content, examples
+	}
+}
@@ -0,0 +1,36 @@
+package kimi
+
+import (
+	"context"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// UserInputToolName is the external tool through which the agent asks the
+// InteractionHandler for user input.
+const UserInputToolName = "ask_user"
+
+// InteractionHandler answers every request that needs the user, so that a
+// terminal or chat front end can serve approvals and clarifying questions
+// from a single place. The context passed to its methods is the one of the
+// Prompt call that started the turn, so the wait for the user can be abandoned
+// once the turn is cancelled.
+type InteractionHandler interface {
+	// Approve decides an approval request.
+	Approve(ctx context.Context, req wire.ApprovalRequest) wire.ApprovalRequestResponse
+	// UserInput asks the user a question on behalf of the agent and returns the answer.
+	UserInput(ctx context.Context, question string) (string, error)
+}
+
+type userInputArgs struct {
+	Question string `json:"question" description:"The question to ask the user"`
+}
+
+func newUserInputTool(handler InteractionHandler) (Tool, error) {
+	return CreateToolContext(func(ctx context.Context, args userInputArgs) (string, error) {
+		return handler.UserInput(ctx, args.Question)
+	},
+		WithName(UserInputToolName),
+		WithDescription("Ask the user a clarifying question and wait for the answer."),
+	)
+}
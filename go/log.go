@@ -0,0 +1,44 @@
+package kimi
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+)
+
+// LevelTrace is the level, below slog.LevelDebug, at which the frames exchanged
+// with the kimi subprocess are logged, see WithLogger.
+const LevelTrace = slog.LevelDebug - 4
+
+// newSessionID returns a random identifier for a new session, see Session.ID.
+func newSessionID() string {
+	var b [16]byte
+	rand.Read(b[:]) //nolint:errcheck // crypto/rand.Read never fails
+	return hex.EncodeToString(b[:])
+}
+
+// sessionLogger returns the logger of the session identified by id: the records
+// it emits carry the session ID as the session_id attribute. It returns nil if
+// logger is nil, and callers check for nil before building a record, so that a
+// session without a logger does no logging work at all.
+func sessionLogger(logger *slog.Logger, id string) *slog.Logger {
+	if logger == nil {
+		return nil
+	}
+	return logger.With("session_id", id)
+}
+
+// ID returns the identifier generated for the session when it was created. It
+// is the session_id attribute of every record logged for the session, see
+// WithLogger, so that the activity of one conversation can be told apart.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// errorAttrs returns the attributes logging err, if any.
+func errorAttrs(err error) []any {
+	if err == nil {
+		return nil
+	}
+	return []any{"error", err}
+}
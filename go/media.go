@@ -0,0 +1,213 @@
+package kimi
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// maxMediaBytes is the largest remote media that a mediaSaver downloads.
+const maxMediaBytes = 64 << 20
+
+// mediaSaver writes the media content parts of a turn to files. See WithMediaSaveDir.
+type mediaSaver struct {
+	dir     string
+	client  *http.Client // downloads remote media; http.DefaultClient if nil
+	pending sync.WaitGroup
+	mu      sync.Mutex
+	saves   []mediaSave // in the order the parts arrived
+}
+
+// mediaSave is the outcome of saving one media content part.
+type mediaSave struct {
+	path string
+	err  error
+}
+
+// save writes the media of msg, if it is an image, audio or video content part,
+// to a new file in the save directory. The media is decoded or downloaded in the
+// background, so the part is delivered without waiting for it; wait blocks until
+// every save has finished.
+func (s *mediaSaver) save(ctx context.Context, msg wire.Message) {
+	part, ok := msg.(wire.ContentPart)
+	if !ok {
+		return
+	}
+	var media wire.Optional[wire.MediaURL]
+	switch part.Type {
+	case wire.ContentPartTypeImageURL:
+		media = part.ImageURL
+	case wire.ContentPartTypeAudioURL:
+		media = part.AudioURL
+	case wire.ContentPartTypeVideoURL:
+		media = part.VideoURL
+	}
+	if !media.Valid {
+		return
+	}
+	s.mu.Lock()
+	slot := len(s.saves)
+	s.saves = append(s.saves, mediaSave{})
+	s.mu.Unlock()
+	s.pending.Go(func() {
+		path, err := s.write(ctx, media.Value.URL)
+		if err != nil {
+			err = fmt.Errorf("save %s media: %w", part.Type, err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.saves[slot] = mediaSave{path: path, err: err}
+	})
+}
+
+// wait blocks until the media of every part passed to save has been written or
+// has failed.
+func (s *mediaSaver) wait() {
+	s.pending.Wait()
+}
+
+func (s *mediaSaver) write(ctx context.Context, rawURL string) (string, error) {
+	var (
+		data      []byte
+		mediaType string
+		err       error
+	)
+	if strings.HasPrefix(rawURL, "data:") {
+		data, mediaType, err = decodeDataURL(rawURL)
+	} else {
+		data, mediaType, err = s.fetch(ctx, rawURL)
+	}
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(s.dir, "media-*"+mediaExtension(mediaType, rawURL))
+	if err != nil {
+		return "", err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// decodeDataURL returns the data and media type of a data URL as defined by RFC 2397.
+func decodeDataURL(rawURL string) ([]byte, string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(rawURL, "data:"), ",")
+	if !ok {
+		return nil, "", errors.New("malformed data URL")
+	}
+	mediaType, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		return []byte(data), mediaType, err
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		// Some encoders omit the padding.
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	return data, mediaType, err
+}
+
+// fetch downloads the media at rawURL, failing if it is larger than maxMediaBytes.
+func (s *mediaSaver) fetch(ctx context.Context, rawURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	client := s.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxMediaBytes {
+		return nil, "", fmt.Errorf("GET %s: media is %d bytes, more than the limit of %d", rawURL, resp.ContentLength, maxMediaBytes)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaBytes+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) > maxMediaBytes {
+		return nil, "", fmt.Errorf("GET %s: media is more than the limit of %d bytes", rawURL, maxMediaBytes)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// preferredExtensions picks the usual extension for media types that
+// mime.ExtensionsByType maps to several.
+var preferredExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"audio/mpeg": ".mp3",
+	"video/mp4":  ".mp4",
+}
+
+// mediaExtension returns the file extension for mediaType, preferring the
+// extension of the URL path when it matches.
+func mediaExtension(mediaType, rawURL string) string {
+	var urlExt string
+	if u, err := url.Parse(rawURL); err == nil && u.Scheme != "data" {
+		urlExt = path.Ext(u.Path)
+	}
+	mediaType, _, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return urlExt
+	}
+	exts, _ := mime.ExtensionsByType(mediaType)
+	switch {
+	case len(exts) == 0 || slices.Contains(exts, urlExt):
+		return urlExt
+	case preferredExtensions[mediaType] != "":
+		return preferredExtensions[mediaType]
+	default:
+		return exts[0]
+	}
+}
+
+// SavedMedia returns the paths of the files that the image, audio and video
+// content parts of the turn have been written to so far, in the order the parts
+// arrived, when the session was created with WithMediaSaveDir. The error joins
+// the failures to decode, download or write a part. Media still being saved is
+// left out; once Steps is closed, every part has been saved.
+func (t *Turn) SavedMedia() ([]string, error) {
+	if t.media == nil {
+		return nil, nil
+	}
+	t.media.mu.Lock()
+	defer t.media.mu.Unlock()
+	var (
+		paths []string
+		errs  []error
+	)
+	for _, save := range t.media.saves {
+		if save.path != "" {
+			paths = append(paths, save.path)
+		}
+		errs = append(errs, save.err)
+	}
+	return paths, errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+package kimi
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestTurn_SavedMedia(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\nfake image")
+	mp3 := []byte("ID3 fake audio")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/speech" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write(mp3)
+	}))
+	defer server.Close()
+
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	dir := t.TempDir()
+	turn.media = &mediaSaver{dir: dir}
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.NewTextContentPart("Here is the chart:")
+		msgs <- wire.NewImageContentPart("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		msgs <- wire.NewAudioContentPart(server.URL + "/speech")
+		msgs <- wire.NewAudioContentPart(server.URL + "/missing.mp3")
+		msgs <- wire.TurnEnd{}
+	}()
+	collectStepMessages(t, turn, cancel)
+
+	paths, err := turn.SavedMedia()
+	if err == nil {
+		t.Error("expected an error for the missing media")
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 saved files, got %v", paths)
+	}
+	for i, expected := range []struct {
+		ext  string
+		data []byte
+	}{{".png", png}, {".mp3", mp3}} {
+		if filepath.Dir(paths[i]) != dir || filepath.Ext(paths[i]) != expected.ext {
+			t.Errorf("expected a %s file in %s, got %s", expected.ext, dir, paths[i])
+		}
+		data, err := os.ReadFile(paths[i])
+		if err != nil {
+			t.Fatalf("ReadFile: %v", err)
+		}
+		if string(data) != string(expected.data) {
+			t.Errorf("unexpected contents of %s: %q", paths[i], data)
+		}
+	}
+}
+
+func TestTurn_SavedMedia_SlowDownload(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\nfake image"))
+	}))
+	defer server.Close()
+
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	turn.media = &mediaSaver{dir: t.TempDir()}
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.NewImageContentPart(server.URL + "/chart.png")
+		msgs <- wire.NewTextContentPart("Here is the chart.")
+		msgs <- wire.TurnEnd{}
+	}()
+
+	step := <-turn.Steps
+	for {
+		select {
+		case msg := <-step.Messages:
+			if part, ok := msg.(wire.ContentPart); !ok || part.Type != wire.ContentPartTypeText {
+				continue
+			}
+		case <-time.After(time.Second):
+			cancel()
+			t.Fatal("a slow download held back the step's messages")
+		}
+		break
+	}
+	if paths, _ := turn.SavedMedia(); len(paths) != 0 {
+		t.Errorf("expected no saved files while the download runs, got %v", paths)
+	}
+
+	close(release)
+	collectStepMessages(t, turn, cancel)
+	paths, err := turn.SavedMedia()
+	if err != nil || len(paths) != 1 {
+		t.Errorf("expected the file to be saved by the end of the turn, got %v, %v", paths, err)
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	for _, tc := range []struct {
+		url, mediaType, data string
+	}{
+		{"data:image/png;base64,aGVsbG8=", "image/png", "hello"},
+		{"data:image/png;base64,aGVsbG8", "image/png", "hello"},
+		{"data:text/plain,hello%20world", "text/plain", "hello world"},
+	} {
+		data, mediaType, err := decodeDataURL(tc.url)
+		if err != nil {
+			t.Errorf("decodeDataURL(%q): %v", tc.url, err)
+			continue
+		}
+		if mediaType != tc.mediaType || string(data) != tc.data {
+			t.Errorf("decodeDataURL(%q) = %q, %q", tc.url, data, mediaType)
+		}
+	}
+	if _, _, err := decodeDataURL("data:image/png;base64"); err == nil {
+		t.Error("expected an error for a data URL without data")
+	}
+}
+
+// roundTripFunc serves HTTP requests with a function, in place of the network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestMediaSaver_Fetch(t *testing.T) {
+	var requests int
+	saver := &mediaSaver{client: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		size := int64(16)
+		if req.URL.Path == "/large.mp4" {
+			size = maxMediaBytes + 1
+		}
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {"video/mp4"}},
+			Body:          io.NopCloser(strings.NewReader(strings.Repeat("x", int(size)))),
+			ContentLength: -1,
+			Request:       req,
+		}, nil
+	})}}
+
+	data, mediaType, err := saver.fetch(context.Background(), "https://example.com/small.mp4")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(data) != 16 || mediaType != "video/mp4" {
+		t.Errorf("fetch = %d bytes of %q", len(data), mediaType)
+	}
+	if _, _, err := saver.fetch(context.Background(), "https://example.com/large.mp4"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("expected an error for media over the limit, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected the client to serve 2 requests, got %d", requests)
+	}
+}
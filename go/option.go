@@ -1,16 +1,53 @@
 package kimi
 
 import (
+	"context"
 	"encoding/json"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
 )
 
 type Option func(*option)
 
 type option struct {
-	exec  string
-	args  []string
-	envs  []string
-	tools []Tool
+	exec                   string
+	args                   []string
+	envs                   []string
+	tools                  []Tool
+	lenientJSON            bool
+	observers              []ApprovalObserver
+	argRepair              bool
+	toolsDryRun            bool
+	workDir                string
+	requireWritableWorkDir bool
+	classifyError          AgentErrorClassifier
+	interaction            InteractionHandler
+	onEchoMismatch         EchoMismatchFunc
+	summarizeCompaction    CompactionSummaryFunc
+	requiredTools          []string
+	toolDocs               map[string]ToolDoc
+	coalesceText           time.Duration
+	mediaSaveDir           string
+	retryOnUnexpectedEOF   int
+	fewShotExamples        []Exchange
+	writeConflictPolicy    WriteConflictPolicy
+	systemPrompt           string
+	logger                 *slog.Logger
+	maxContentPartBytes    int64
+	transport              transport.Transport
+	binaryPath             string
+	approvalHandler        ApprovalHandler
+	toolResultInterceptor  ToolResultInterceptor
+	responseFormat         ResponseFormat
+	mediaHTTPClient        *http.Client
+	noUserInputTool        bool
 }
 
 func WithExecutable(executable string) Option {
@@ -45,6 +82,11 @@ func WithConfigFile(file string) Option {
 	}
 }
 
+// WithModel selects the model the agent uses, by a name the CLI knows: one of
+// the models of its configuration (see Config.Models) or of the configuration
+// passed with WithConfig or WithConfigFile. The name is forwarded verbatim with
+// the --model flag. If the CLI refuses the name and exits, NewSession returns
+// an error carrying the CLI's message instead of falling back to the default.
 func WithModel(model string) Option {
 	return func(opt *option) {
 		opt.args = append(opt.args, "--model", model)
@@ -53,6 +95,7 @@ func WithModel(model string) Option {
 
 func WithWorkDir(dir string) Option {
 	return func(opt *option) {
+		opt.workDir = dir
 		opt.args = append(opt.args, "--work-dir", dir)
 	}
 }
@@ -110,3 +153,316 @@ func WithTools(tools ...Tool) Option {
 		opt.tools = append(opt.tools, tools...)
 	}
 }
+
+// WithLenientJSON makes the session tolerate trailing commas and comments in
+// frames received from the CLI. Parsing is strict by default.
+func WithLenientJSON() Option {
+	return func(opt *option) {
+		opt.lenientJSON = true
+	}
+}
+
+// WithApprovalObserver registers an observer that is invoked after each approval
+// request resolves, with the decision and the source that made it (see ApprovalSource*).
+// Observers are for auditing only and cannot change the decision.
+func WithApprovalObserver(observer func(req wire.ApprovalRequest, decision wire.ApprovalRequestResponse, source string)) Option {
+	return func(opt *option) {
+		if observer != nil {
+			opt.observers = append(opt.observers, observer)
+		}
+	}
+}
+
+// WithArgRepair makes Turn.TruncatedToolCall close the arguments of a tool call
+// that was cut off mid-stream into valid JSON, for inspection and logging only.
+func WithArgRepair() Option {
+	return func(opt *option) {
+		opt.argRepair = true
+	}
+}
+
+// WithToolsDryRun intercepts every call to a registered tool: the tool body is not
+// executed, an empty successful result is returned to the model, and the call is
+// recorded for Session.DryRunInvocations. The empty result still goes through
+// WithToolResultInterceptor and is logged like a real one.
+func WithToolsDryRun() Option {
+	return func(opt *option) {
+		opt.toolsDryRun = true
+	}
+}
+
+// WithRequireWritableWorkDir makes NewSession verify that the work directory
+// (see WithWorkDir, defaulting to the current directory) is writable, by creating
+// and removing a temporary file in it. NewSession fails with ErrWorkDirNotWritable otherwise.
+func WithRequireWritableWorkDir() Option {
+	return func(opt *option) {
+		opt.requireWritableWorkDir = true
+	}
+}
+
+// WithToolNamespace registers tools like WithTools, but advertises each one as
+// prefix + "." + name, e.g. "local.search". Tool calls are dispatched by the
+// namespaced name, which avoids collisions between tools from different sources.
+func WithToolNamespace(prefix string, tools ...Tool) Option {
+	return func(opt *option) {
+		for _, tool := range tools {
+			tool.def.Name = prefix + "." + tool.def.Name
+			opt.tools = append(opt.tools, tool)
+		}
+	}
+}
+
+// WithAgentErrorClassifier replaces the classifier that decides which turn events
+// are collected into Turn.AgentErrors. The default is ClassifyAgentError;
+// custom classifiers may call it to extend rather than replace the default rules.
+func WithAgentErrorClassifier(classify AgentErrorClassifier) Option {
+	return func(opt *option) {
+		opt.classifyError = classify
+	}
+}
+
+// WithInteractionHandler routes approval requests and user-input questions to handler.
+// Approval requests are answered by the handler instead of being delivered on Step.Messages,
+// and the agent is given the UserInputToolName tool to ask the user questions, unless
+// WithoutUserInputTool is used. It cannot be combined with WithApprovalHandler:
+// NewSession fails if both are given.
+func WithInteractionHandler(handler InteractionHandler) Option {
+	return func(opt *option) {
+		opt.interaction = handler
+	}
+}
+
+// WithVerifyEcho compares the user input echoed in each TurnBegin with the content
+// submitted to Prompt, and calls warn when the backend altered or dropped part of it.
+// A plain string and a single text part with the same text are considered equal.
+// warn is called from the goroutine that reads the turn and must not block.
+func WithVerifyEcho(warn EchoMismatchFunc) Option {
+	return func(opt *option) {
+		opt.onEchoMismatch = warn
+	}
+}
+
+// WithCompactionSummary replaces how Session.LastCompactionSummary is captured.
+// extract receives the events streamed between CompactionBegin and CompactionEnd;
+// by default, their text content parts are joined.
+func WithCompactionSummary(extract CompactionSummaryFunc) Option {
+	return func(opt *option) {
+		opt.summarizeCompaction = extract
+	}
+}
+
+// WithRequiredTools makes NewSession fail with ErrRequiredToolMissing unless every
+// named tool is registered (with WithTools or WithToolNamespace, using the namespaced
+// name) and accepted by the CLI. This catches prompts that reference a tool by name
+// which was never registered.
+func WithRequiredTools(names ...string) Option {
+	return func(opt *option) {
+		opt.requiredTools = append(opt.requiredTools, names...)
+	}
+}
+
+// WithToolDescriptions overrides the descriptions of registered tools from catalog,
+// keyed by tool name (including any namespace prefix). Catalog descriptions take
+// precedence over WithDescription, WithFieldDescription and description struct tags.
+// It can be given more than once; later entries replace earlier ones for the same tool.
+func WithToolDescriptions(catalog map[string]ToolDoc) Option {
+	return func(opt *option) {
+		if opt.toolDocs == nil {
+			opt.toolDocs = make(map[string]ToolDoc, len(catalog))
+		}
+		maps.Copy(opt.toolDocs, catalog)
+	}
+}
+
+// WithCoalesceText merges consecutive text content parts of a step into a single
+// part before it is delivered on Step.Messages. A merged part is delivered once
+// flushInterval has passed since its first fragment arrived, or as soon as any
+// other message (such as a tool call) or the end of the step arrives, so order is
+// preserved and text is never merged across other messages. Sinks still receive
+// the individual fragments.
+func WithCoalesceText(flushInterval time.Duration) Option {
+	return func(opt *option) {
+		opt.coalesceText = flushInterval
+	}
+}
+
+// WithRetryOnUnexpectedEOF sends a prompt again, up to n times, when its stream
+// ends without TurnEnd (PromptResultStatusUnexpectedEOF), e.g. because the
+// connection dropped. Turns that finish, are cancelled, with Turn.Cancel or the
+// context passed to Prompt or Drain, or fail otherwise are not retried. The
+// steps of each attempt are delivered on the same Turn.Steps, so the partial
+// output of a failed attempt has already been seen when the retry starts. The
+// turn then reports the result, error, text, reasoning and tool calls of the
+// last attempt; its step count and token usage cover all attempts.
+func WithRetryOnUnexpectedEOF(n int) Option {
+	return func(opt *option) {
+		opt.retryOnUnexpectedEOF = n
+	}
+}
+
+// WithMediaSaveDir writes the image, audio and video content parts produced by
+// the assistant to new files in dir, which must exist. Data URLs are decoded and
+// remote URLs are downloaded in the background, with http.DefaultClient unless
+// WithMediaHTTPClient is used; a download larger than 64 MiB fails. The turn's
+// steps end once every part has been saved, and the paths are reported by
+// Turn.SavedMedia.
+func WithMediaSaveDir(dir string) Option {
+	return func(opt *option) {
+		opt.mediaSaveDir = dir
+	}
+}
+
+// WithFewShotExamples shows the model example exchanges, such as a request, the
+// tool calls made to answer it and the final answer, to improve its use of
+// tools. The examples are serialized in order into a text block sent ahead of
+// the content of the session's first prompt; later prompts are sent as is.
+func WithFewShotExamples(examples []Exchange) Option {
+	return func(opt *option) {
+		opt.fewShotExamples = examples
+	}
+}
+
+// WithWriteConflictPolicy sets what happens when tool calls writing the same
+// file, as declared with WithFileWrite, are in flight at the same time: they
+// run concurrently (WriteConflictAllow, the default), one after the other
+// (WriteConflictSerialize), or all but the first fail (WriteConflictReject).
+func WithWriteConflictPolicy(policy WriteConflictPolicy) Option {
+	return func(opt *option) {
+		opt.writeConflictPolicy = policy
+	}
+}
+
+// WithSystemPrompt adds text to the system prompt of the agent, for every turn
+// of the session. The CLI is started with a generated agent file extending its
+// default agent, so the option cannot be combined with an --agent-file passed
+// through WithArgs.
+func WithSystemPrompt(text string) Option {
+	return func(opt *option) {
+		opt.systemPrompt = text
+	}
+}
+
+// WithLogger logs the activity of the session to logger, at debug level: the
+// start and end of the session, of its turns and of its tool calls, the
+// initialize exchange, the type of each event received and the approval
+// requests and their resolution. The JSON-RPC frames exchanged with the kimi
+// subprocess are logged at LevelTrace. Every record carries the session ID,
+// see Session.ID, as the session_id attribute, and turn records the turn ID as
+// the turn_id attribute. Without a logger, the session does no logging work.
+func WithLogger(logger *slog.Logger) Option {
+	return func(opt *option) {
+		opt.logger = logger
+	}
+}
+
+// WithMaxSteps bounds the number of steps the agent may take in a turn of the
+// session, overriding the loop control of the CLI's configuration. A turn
+// reaching the limit ends with PromptResultStatusMaxStepsReached. It is forwarded
+// with the --max-steps-per-turn flag; n <= 0 keeps the CLI's default.
+func WithMaxSteps(n int) Option {
+	return func(opt *option) {
+		if n > 0 {
+			opt.args = append(opt.args, "--max-steps-per-turn", strconv.Itoa(n))
+		}
+	}
+}
+
+// WithEnv sets environment variables of the kimi subprocess, e.g. endpoints or
+// credentials that differ between the sessions of a process. The subprocess
+// inherits the environment of the current process; the variables passed merge
+// over it. Among options setting the same variable, including WithBaseURL and
+// WithAPIKey, the last one wins.
+func WithEnv(env map[string]string) Option {
+	return func(opt *option) {
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			opt.envs = append(opt.envs, key+"="+env[key])
+		}
+	}
+}
+
+// WithMaxContentPartBytes makes Session.Prompt fail fast with
+// ErrContentPartTooLarge, before anything is sent, when a part of the prompt
+// is larger than n bytes: the text of a text part, or the decoded data of an
+// image, audio or video data URL. Remote URLs are not checked.
+func WithMaxContentPartBytes(n int64) Option {
+	return func(opt *option) {
+		opt.maxContentPartBytes = n
+	}
+}
+
+// WithTransport runs the session over tp instead of a kimi subprocess, e.g. to
+// talk to an in-process agent or a remote gateway, or to use a test double.
+// The session calls Initialize, Prompt and Cancel on tp, with the wire protocol
+// version TransportWireProtocolVersion; to deliver the agent's events and
+// requests, tp implements TransportBinder. Closing the session closes tp if it
+// implements io.Closer. The options configuring the subprocess, such as
+// WithExecutable, WithArgs or WithEnv, have no effect.
+func WithTransport(tp transport.Transport) Option {
+	return func(opt *option) {
+		opt.transport = tp
+	}
+}
+
+// WithBinaryPath runs the kimi CLI binary at path instead of looking up "kimi"
+// in PATH. Unlike WithExecutable, which it takes precedence over, the path is
+// checked up front: NewSession fails with ErrBinaryNotFound, mentioning the
+// resolved absolute path, if it does not exist or is not an executable file.
+func WithBinaryPath(path string) Option {
+	return func(opt *option) {
+		opt.binaryPath = path
+	}
+}
+
+// WithApprovalHandler routes approval requests to handler, e.g. to prompt the
+// user for each of them, instead of delivering them on Step.Messages. The agent
+// is answered with the handler's decision. Once the handler answers
+// approve_for_session, later requests for the same action are approved without
+// calling it again. It cannot be combined with WithInteractionHandler:
+// NewSession fails if both are given.
+func WithApprovalHandler(handler func(ctx context.Context, req wire.ApprovalRequest) wire.ApprovalRequestResponse) Option {
+	return func(opt *option) {
+		opt.approvalHandler = handler
+	}
+}
+
+// WithToolResultInterceptor calls intercept with the result of each external
+// tool call, including a call that failed, before the result is sent to the
+// model, e.g. to redact secrets, truncate a large output or annotate it. name
+// is the name of the tool. Changes intercept makes to result are sent; if it
+// returns an error, the model receives that error as the result of the call
+// instead. intercept may be called concurrently for calls running in parallel.
+func WithToolResultInterceptor(intercept func(name string, result *wire.ToolResultReturnValue) error) Option {
+	return func(opt *option) {
+		opt.toolResultInterceptor = intercept
+	}
+}
+
+// WithResponseFormat asks the model to answer in format, for every turn of the
+// session. With ResponseFormatJSON, the agent's system prompt instructs it to
+// answer with a single JSON value, which Turn.Decode unmarshals, e.g. to get
+// structured data back without a reporting tool. The CLI offers no way to
+// enforce the format, so the instruction can be ignored; Decode then fails with
+// ErrInvalidJSONResponse. Like WithSystemPrompt, the option starts the CLI with
+// a generated agent file.
+func WithResponseFormat(format ResponseFormat) Option {
+	return func(opt *option) {
+		opt.responseFormat = format
+	}
+}
+
+// WithMediaHTTPClient downloads the remote media saved with WithMediaSaveDir
+// with client instead of http.DefaultClient, e.g. to set a timeout, or to only
+// allow some hosts with a custom Transport or CheckRedirect.
+func WithMediaHTTPClient(client *http.Client) Option {
+	return func(opt *option) {
+		opt.mediaHTTPClient = client
+	}
+}
+
+// WithoutUserInputTool keeps the UserInputToolName tool from the agent when
+// WithInteractionHandler is used, so that the handler only answers approvals.
+func WithoutUserInputTool() Option {
+	return func(opt *option) {
+		opt.noUserInputTool = true
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
 )
 
 func TestWithExecutable(t *testing.T) {
@@ -38,6 +40,26 @@ func TestWithAPIKey(t *testing.T) {
 	}
 }
 
+func TestWithEnv(t *testing.T) {
+	opt := &option{envs: []string{"PATH=/usr/bin", "KIMI_API_KEY=sk-parent"}}
+	WithAPIKey("sk-option")(opt)
+	WithEnv(map[string]string{"KIMI_API_KEY": "sk-session", "FEATURE_FLAG": "on"})(opt)
+
+	expected := []string{"PATH=/usr/bin", "KIMI_API_KEY=sk-parent", "KIMI_API_KEY=sk-option", "FEATURE_FLAG=on", "KIMI_API_KEY=sk-session"}
+	if !reflect.DeepEqual(opt.envs, expected) {
+		t.Fatalf("expected envs %v, got %v", expected, opt.envs)
+	}
+}
+
+func TestWithBinaryPath(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithBinaryPath("/opt/kimi/bin/kimi")(opt)
+
+	if opt.binaryPath != "/opt/kimi/bin/kimi" {
+		t.Fatalf("expected binaryPath /opt/kimi/bin/kimi, got %q", opt.binaryPath)
+	}
+}
+
 func TestWithConfig(t *testing.T) {
 	cfg := &Config{
 		DefaultModel: "test-model",
@@ -255,3 +277,164 @@ func TestOptions_Chaining(t *testing.T) {
 		t.Fatalf("expected args %v, got %v", expectedArgs, opt.args)
 	}
 }
+
+func TestWithLenientJSON(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	if opt.lenientJSON {
+		t.Fatal("expected lenientJSON to be false by default")
+	}
+	f := WithLenientJSON()
+	f(opt)
+
+	if !opt.lenientJSON {
+		t.Fatal("expected lenientJSON to be true")
+	}
+}
+
+func TestWithApprovalObserver(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	var called bool
+	WithApprovalObserver(func(wire.ApprovalRequest, wire.ApprovalRequestResponse, string) {
+		called = true
+	})(opt)
+	WithApprovalObserver(nil)(opt)
+
+	if len(opt.observers) != 1 {
+		t.Fatalf("expected 1 observer, got %d", len(opt.observers))
+	}
+	opt.observers[0](wire.ApprovalRequest{}, wire.ApprovalRequestResponseApprove, ApprovalSourceHandler)
+	if !called {
+		t.Fatal("expected observer to be called")
+	}
+}
+
+func TestWithArgRepair(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithArgRepair()(opt)
+
+	if !opt.argRepair {
+		t.Fatal("expected argRepair to be true")
+	}
+}
+
+func TestWithToolsDryRun(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithToolsDryRun()(opt)
+
+	if !opt.toolsDryRun {
+		t.Fatal("expected toolsDryRun to be true")
+	}
+}
+
+func TestWithRequireWritableWorkDir(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithWorkDir("/tmp")(opt)
+	WithRequireWritableWorkDir()(opt)
+
+	if !opt.requireWritableWorkDir {
+		t.Fatal("expected requireWritableWorkDir to be true")
+	}
+	if opt.workDir != "/tmp" {
+		t.Fatalf("expected workDir=/tmp, got %s", opt.workDir)
+	}
+}
+
+func TestWithToolNamespace(t *testing.T) {
+	search, err := CreateTool(Search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	opt := &option{exec: "kimi"}
+	WithTools(search)(opt)
+	WithToolNamespace("local", search)(opt)
+	WithToolNamespace("proxy", search)(opt)
+
+	var names []string
+	for _, tool := range opt.tools {
+		names = append(names, tool.def.Name)
+	}
+	expected := []string{"search", "local.search", "proxy.search"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected tool names %v, got %v", expected, names)
+	}
+	if search.def.Name != "search" {
+		t.Fatalf("expected original tool to be unchanged, got %s", search.def.Name)
+	}
+}
+
+func TestWithAgentErrorClassifier(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithAgentErrorClassifier(func(wire.Event) (AgentError, bool) {
+		return AgentError{Kind: "custom"}, true
+	})(opt)
+
+	if opt.classifyError == nil {
+		t.Fatal("expected classifyError to be set")
+	}
+	if agentError, ok := opt.classifyError(wire.StatusUpdate{}); !ok || agentError.Kind != "custom" {
+		t.Errorf("unexpected classification: %+v, %v", agentError, ok)
+	}
+}
+
+func TestWithInteractionHandler(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	handler := &recordingInteractionHandler{}
+	WithInteractionHandler(handler)(opt)
+
+	if opt.interaction != handler {
+		t.Fatal("expected interaction handler to be set")
+	}
+}
+
+func TestWithoutUserInputTool(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithoutUserInputTool()(opt)
+
+	if !opt.noUserInputTool {
+		t.Fatal("expected the user input tool to be disabled")
+	}
+}
+
+func TestWithVerifyEcho(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	called := false
+	WithVerifyEcho(func(sent, echoed wire.Content) { called = true })(opt)
+
+	if opt.onEchoMismatch == nil {
+		t.Fatal("expected onEchoMismatch to be set")
+	}
+	opt.onEchoMismatch(wire.NewStringContent("a"), wire.NewStringContent("b"))
+	if !called {
+		t.Fatal("expected warning callback to be called")
+	}
+}
+
+func TestWithCompactionSummary(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithCompactionSummary(func([]wire.Event) (string, bool) { return "summary", true })(opt)
+
+	if opt.summarizeCompaction == nil {
+		t.Fatal("expected summarizeCompaction to be set")
+	}
+}
+
+func TestWithRequiredTools(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithRequiredTools("a", "b")(opt)
+	WithRequiredTools("c")(opt)
+
+	if !reflect.DeepEqual(opt.requiredTools, []string{"a", "b", "c"}) {
+		t.Errorf("unexpected required tools: %v", opt.requiredTools)
+	}
+}
+
+func TestWithToolDescriptions(t *testing.T) {
+	opt := &option{exec: "kimi"}
+	WithToolDescriptions(map[string]ToolDoc{"a": {Description: "first"}, "b": {Description: "b"}})(opt)
+	WithToolDescriptions(map[string]ToolDoc{"a": {Description: "second"}})(opt)
+
+	if opt.toolDocs["a"].Description != "second" || opt.toolDocs["b"].Description != "b" {
+		t.Errorf("unexpected tool docs: %+v", opt.toolDocs)
+	}
+}
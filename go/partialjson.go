@@ -0,0 +1,61 @@
+package kimi
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// PartialJSON is a Sink for turns whose answer is a JSON document, e.g. when the
+// prompt asks for a structured result. As the text streams in, it closes the
+// document received so far into valid JSON, decodes it into a T and passes it to
+// a callback, so that a UI can show the result filling up. Text before the first
+// '{' or '[', such as a Markdown code fence, is ignored.
+//
+// Partial values are best-effort: a number or string may still grow, and a
+// field absent from a partial value may just not have arrived yet.
+type PartialJSON[T any] struct {
+	onPartial func(partial T)
+
+	mu      sync.Mutex
+	text    strings.Builder
+	started bool
+	last    string
+}
+
+// NewPartialJSON returns a PartialJSON that calls onPartial each time the
+// document received so far closes into a new value. Add it to a turn with
+// Turn.AddSink.
+func NewPartialJSON[T any](onPartial func(partial T)) *PartialJSON[T] {
+	return &PartialJSON[T]{onPartial: onPartial}
+}
+
+func (p *PartialJSON[T]) OnText(text string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.started {
+		start := strings.IndexAny(text, "{[")
+		if start < 0 {
+			return
+		}
+		text = text[start:]
+		p.started = true
+	}
+	p.text.WriteString(text)
+	repaired, ok := repairJSON(p.text.String())
+	if !ok || repaired == p.last {
+		return
+	}
+	var partial T
+	if err := json.Unmarshal([]byte(repaired), &partial); err != nil {
+		return
+	}
+	p.last = repaired
+	p.onPartial(partial)
+}
+
+func (p *PartialJSON[T]) OnThink(think string)                {}
+func (p *PartialJSON[T]) OnToolCall(call wire.ToolCall)       {}
+func (p *PartialJSON[T]) OnToolResult(result wire.ToolResult) {}
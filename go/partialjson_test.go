@@ -0,0 +1,53 @@
+package kimi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestPartialJSON(t *testing.T) {
+	type Form struct {
+		Name string   `json:"name"`
+		Age  int      `json:"age"`
+		Tags []string `json:"tags"`
+	}
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	var partials []Form
+	turn.AddSink(NewPartialJSON(func(partial Form) {
+		partials = append(partials, partial)
+	}))
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		for _, fragment := range []string{
+			"```json\n{\"na",
+			"me\": \"Ali",
+			"ce\", \"ag",
+			"e\": 3",
+			"0, \"tags\": [\"a\"",
+			", \"b\"]}",
+			"\n```",
+		} {
+			msgs <- wire.NewTextContentPart(fragment)
+		}
+		msgs <- wire.TurnEnd{}
+	}()
+	collectStepMessages(t, turn, cancel)
+
+	expected := []Form{
+		{},
+		{Name: "Ali"},
+		{Name: "Alice"},
+		{Name: "Alice", Age: 3},
+		{Name: "Alice", Age: 30, Tags: []string{"a"}},
+		{Name: "Alice", Age: 30, Tags: []string{"a", "b"}},
+	}
+	if !reflect.DeepEqual(partials, expected) {
+		t.Errorf("got partials %+v, want %+v", partials, expected)
+	}
+}
@@ -0,0 +1,182 @@
+package kimi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+type repairExpect int
+
+const (
+	expectTopValue repairExpect = iota
+	expectTopDone
+	expectObjectKey
+	expectObjectColon
+	expectObjectValue
+	expectObjectComma
+	expectArrayValue
+	expectArrayComma
+)
+
+// repairJSON closes whatever a truncated JSON document left open: unterminated
+// strings, partial literals and numbers, dangling keys, commas and colons, and
+// unclosed objects and arrays. It reports false when the input cannot be turned
+// into a valid document.
+//
+// The repaired document is a best-effort reconstruction meant for inspection and
+// logging; it must never be used to execute a tool call.
+func repairJSON(partial string) (string, bool) {
+	var (
+		out        = []byte(partial)
+		stack      []byte
+		expects    = []repairExpect{expectTopValue}
+		inString   bool
+		isKey      bool
+		escaped    bool
+		unicodeHex = -1 // number of hex digits seen after \u, or -1 outside of a \u escape
+		literal    = -1 // start index of the current literal or number, or -1
+	)
+	top := func() *repairExpect {
+		return &expects[len(expects)-1]
+	}
+	valueDone := func() {
+		switch *top() {
+		case expectObjectValue:
+			*top() = expectObjectComma
+		case expectArrayValue:
+			*top() = expectArrayComma
+		case expectTopValue:
+			*top() = expectTopDone
+		}
+	}
+	endLiteral := func() {
+		if literal >= 0 {
+			literal = -1
+			valueDone()
+		}
+	}
+	for i := 0; i < len(partial); i++ {
+		c := partial[i]
+		if inString {
+			switch {
+			case unicodeHex >= 0:
+				unicodeHex++
+				if unicodeHex == 4 {
+					unicodeHex = -1
+				}
+			case escaped:
+				escaped = false
+				if c == 'u' {
+					unicodeHex = 0
+				}
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if isKey {
+					*top() = expectObjectColon
+				} else {
+					valueDone()
+				}
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\n', '\r':
+			endLiteral()
+		case '"':
+			endLiteral()
+			inString = true
+			isKey = *top() == expectObjectKey
+		case '{':
+			endLiteral()
+			stack = append(stack, '}')
+			expects = append(expects, expectObjectKey)
+		case '[':
+			endLiteral()
+			stack = append(stack, ']')
+			expects = append(expects, expectArrayValue)
+		case '}', ']':
+			endLiteral()
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				return "", false
+			}
+			stack = stack[:len(stack)-1]
+			expects = expects[:len(expects)-1]
+			valueDone()
+		case ':':
+			endLiteral()
+			if *top() != expectObjectColon {
+				return "", false
+			}
+			*top() = expectObjectValue
+		case ',':
+			endLiteral()
+			switch *top() {
+			case expectObjectComma:
+				*top() = expectObjectKey
+			case expectArrayComma:
+				*top() = expectArrayValue
+			default:
+				return "", false
+			}
+		default:
+			if literal < 0 {
+				literal = i
+			}
+		}
+	}
+	if inString {
+		switch {
+		case unicodeHex >= 0:
+			// Drop the incomplete \uXXXX escape, including the backslash and 'u'.
+			out = out[:len(out)-unicodeHex-2]
+		case escaped:
+			out = out[:len(out)-1]
+		}
+		out = append(out, '"')
+		if isKey {
+			*top() = expectObjectColon
+		} else {
+			valueDone()
+		}
+	}
+	if literal >= 0 {
+		out = append(out[:literal], completeLiteral(string(out[literal:]))...)
+		valueDone()
+	}
+	out = []byte(strings.TrimRight(string(out), " \t\n\r"))
+	switch *top() {
+	case expectTopValue:
+		return "", false
+	case expectObjectKey, expectArrayValue:
+		if n := len(out); n > 0 && out[n-1] == ',' {
+			out = out[:n-1]
+		}
+	case expectObjectColon:
+		out = append(out, ":null"...)
+	case expectObjectValue:
+		out = append(out, "null"...)
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		out = append(out, stack[i])
+	}
+	if !json.Valid(out) {
+		return "", false
+	}
+	return string(out), true
+}
+
+// completeLiteral turns a truncated true/false/null or number into a valid one.
+func completeLiteral(lit string) string {
+	for _, full := range []string{"true", "false", "null"} {
+		if strings.HasPrefix(full, lit) {
+			return full
+		}
+	}
+	lit = strings.TrimRight(lit, ".eE+-")
+	if lit == "" {
+		return "null"
+	}
+	return lit
+}
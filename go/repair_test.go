@@ -0,0 +1,64 @@
+package kimi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRepairJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		partial  string
+		expected string
+	}{
+		{"complete", `{"a":1}`, `{"a":1}`},
+		{"open object", `{"a":1`, `{"a":1}`},
+		{"open string value", `{"path":"/tmp/fo`, `{"path":"/tmp/fo"}`},
+		{"open key", `{"a":1,"pa`, `{"a":1,"pa":null}`},
+		{"after key", `{"a":1,"path"`, `{"a":1,"path":null}`},
+		{"after colon", `{"a": `, `{"a":null}`},
+		{"trailing comma", `{"a":1,`, `{"a":1}`},
+		{"nested", `{"a":{"b":[1,2,{"c":"x`, `{"a":{"b":[1,2,{"c":"x"}]}}`},
+		{"array trailing comma", `[1,2,`, `[1,2]`},
+		{"partial true", `{"ok":tr`, `{"ok":true}`},
+		{"partial null", `[nu`, `[null]`},
+		{"partial number", `{"n":1.`, `{"n":1}`},
+		{"partial exponent", `{"n":2e-`, `{"n":2}`},
+		{"lone minus", `{"n":-`, `{"n":null}`},
+		{"dangling escape", `{"s":"a\`, `{"s":"a"}`},
+		{"partial unicode escape", `{"s":"a\u00`, `{"s":"a"}`},
+		{"escaped quote", `{"s":"say \"hi`, `{"s":"say \"hi"}`},
+		{"structural chars in string", `{"s":"{[,:`, `{"s":"{[,:"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := repairJSON(tt.partial)
+			if !ok {
+				t.Fatalf("expected repair to succeed for %q", tt.partial)
+			}
+			if got != tt.expected {
+				t.Errorf("repair mismatch:\ngot:  %s\nwant: %s", got, tt.expected)
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("expected valid JSON, got %s", got)
+			}
+		})
+	}
+}
+
+func TestRepairJSON_Unrepairable(t *testing.T) {
+	tests := []string{
+		``,
+		`   `,
+		`{"a":1]`,
+		`{"a" "b"}`,
+		`{tru`,
+	}
+
+	for _, partial := range tests {
+		if got, ok := repairJSON(partial); ok {
+			t.Errorf("expected repair to fail for %q, got %s", partial, got)
+		}
+	}
+}
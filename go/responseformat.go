@@ -0,0 +1,128 @@
+package kimi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ErrInvalidJSONResponse is returned by Turn.Decode when the final text of the
+// turn is not a JSON document.
+var ErrInvalidJSONResponse = errors.New("response is not valid JSON")
+
+// ResponseFormat is the format the model is asked to answer in, see
+// WithResponseFormat.
+type ResponseFormat string
+
+const (
+	// ResponseFormatText leaves the answers free-form, the default.
+	ResponseFormatText ResponseFormat = "text"
+	// ResponseFormatJSON asks for answers made of a single JSON value, to be
+	// read with Turn.Decode.
+	ResponseFormatJSON ResponseFormat = "json"
+)
+
+// jsonResponseInstruction is added to the system prompt for ResponseFormatJSON.
+const jsonResponseInstruction = "Your final answer must be a single valid JSON value, " +
+	"with no text before or after it and no Markdown code fences."
+
+func (f ResponseFormat) validate() error {
+	switch f {
+	case "", ResponseFormatText, ResponseFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("unknown response format %q", f)
+}
+
+// agentSystemPrompt returns the text added to the system prompt of the agent
+// for opt: the WithSystemPrompt text and the WithResponseFormat instruction.
+func agentSystemPrompt(opt *option) string {
+	if opt.responseFormat != ResponseFormatJSON {
+		return opt.systemPrompt
+	}
+	if opt.systemPrompt == "" {
+		return jsonResponseInstruction
+	}
+	return opt.systemPrompt + "\n\n" + jsonResponseInstruction
+}
+
+// Decode consumes the remaining steps of the turn and their messages until the
+// turn ends, like Drain, and unmarshals the final text of the turn, that is,
+// the text content parts of the last step that produced any, after its last
+// tool call, into v with encoding/json. Text written before a tool call, in the
+// same step or an earlier one, is left out, and so is a Markdown code fence
+// around the document. If the text is not a
+// JSON document, Decode returns an error wrapping ErrInvalidJSONResponse that
+// quotes the beginning of the text. The error of the turn, or ctx.Err() if ctx
+// is done first, takes precedence. Create the session with
+// WithResponseFormat(ResponseFormatJSON) to ask the model for JSON answers.
+func (t *Turn) Decode(ctx context.Context, v any) error {
+	var (
+		text strings.Builder
+		last *Step
+	)
+	err := t.consume(ctx, func(step *Step, msg wire.Message) {
+		if _, ok := msg.(wire.ToolCall); ok {
+			text.Reset()
+			return
+		}
+		part, ok := msg.(wire.ContentPart)
+		if !ok || part.Type != wire.ContentPartTypeText || part.Text.Value == "" {
+			return
+		}
+		if step != last {
+			text.Reset()
+			last = step
+		}
+		text.WriteString(part.Text.Value)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeJSONResponse(text.String(), v)
+}
+
+// decodeJSONResponse unmarshals text, the answer of the model, into v.
+func decodeJSONResponse(text string, v any) error {
+	doc := strings.TrimSpace(text)
+	if fenced, ok := strings.CutPrefix(doc, "```"); ok {
+		if body, ok := strings.CutSuffix(fenced, "```"); ok {
+			if _, rest, ok := strings.Cut(body, "\n"); ok {
+				// Drop the info string, e.g. "json", on the opening line.
+				body = rest
+			} else if !json.Valid([]byte(body)) {
+				// A fence on a single line, e.g. ```json {"a":1}```.
+				body = strings.TrimLeftFunc(body, unicode.IsLetter)
+			}
+			doc = strings.TrimSpace(body)
+		}
+	}
+	if doc == "" {
+		return fmt.Errorf("%w: the turn produced no text", ErrInvalidJSONResponse)
+	}
+	if !json.Valid([]byte(doc)) {
+		var syntaxErr *json.SyntaxError
+		if err := json.Unmarshal([]byte(doc), new(json.RawMessage)); errors.As(err, &syntaxErr) {
+			return fmt.Errorf("%w: %v at offset %d in %q", ErrInvalidJSONResponse, err, syntaxErr.Offset, snippet(doc))
+		}
+		return fmt.Errorf("%w: %q", ErrInvalidJSONResponse, snippet(doc))
+	}
+	if err := json.Unmarshal([]byte(doc), v); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// snippet returns the beginning of text, to quote it in an error.
+func snippet(text string) string {
+	const limit = 80
+	if len(text) <= limit {
+		return text
+	}
+	return strings.ToValidUTF8(text[:limit], "") + "..."
+}
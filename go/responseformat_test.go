@@ -0,0 +1,122 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestTurn_Decode(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("Let me check the sources.")
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search", Arguments: wire.Optional[string]{Value: `{}`, Valid: true}}}
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "Two sources agree.", Valid: true}}
+	msgs <- wire.NewTextContentPart(`{"verdict":"false",`)
+	msgs <- wire.NewTextContentPart(`"sources":["a","b"]}`)
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	var report struct {
+		Verdict string   `json:"verdict"`
+		Sources []string `json:"sources"`
+	}
+	if err := turn.Decode(context.Background(), &report); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if report.Verdict != "false" || len(report.Sources) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestTurn_Decode_ProseBeforeToolCall(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("Let me check the sources.")
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search", Arguments: wire.Optional[string]{Value: `{}`, Valid: true}}}
+	msgs <- wire.ToolResult{ToolCallID: "call-1"}
+	msgs <- wire.NewTextContentPart(`{"verdict":"true"}`)
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	var report struct {
+		Verdict string `json:"verdict"`
+	}
+	if err := turn.Decode(context.Background(), &report); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if report.Verdict != "true" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestDecodeJSONResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    map[string]int
+		invalid bool
+	}{
+		{"plain", ` {"n": 1} `, map[string]int{"n": 1}, false},
+		{"fenced", "```json\n{\"n\": 2}\n```", map[string]int{"n": 2}, false},
+		{"fenced without info string", "```\n{\"n\": 3}\n```", map[string]int{"n": 3}, false},
+		{"fenced on one line", "```{\"n\": 5}```", map[string]int{"n": 5}, false},
+		{"fenced on one line with info string", "```json {\"n\": 6}```", map[string]int{"n": 6}, false},
+		{"prose", "Here is the report: {\"n\": 4}", nil, true},
+		{"truncated", `{"n": `, nil, true},
+		{"empty", "  ", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]int
+			err := decodeJSONResponse(tt.text, &got)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidJSONResponse) {
+					t.Fatalf("expected ErrInvalidJSONResponse, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeJSONResponse: %v", err)
+			}
+			if len(got) != 1 || got["n"] != tt.want["n"] {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	err := decodeJSONResponse("Sure! "+strings.Repeat("x", 100), new(any))
+	if msg := err.Error(); !strings.Contains(msg, `"Sure! xxx`) || !strings.Contains(msg, "offset") {
+		t.Errorf("expected the error to quote the text and locate the problem, got %q", msg)
+	}
+	// Valid JSON of the wrong shape is a decoding error, not an invalid response.
+	if err := decodeJSONResponse(`["a"]`, new(map[string]int)); err == nil || errors.Is(err, ErrInvalidJSONResponse) {
+		t.Errorf("expected a decoding error, got %v", err)
+	}
+}
+
+func TestAgentSystemPrompt(t *testing.T) {
+	if got := agentSystemPrompt(&option{}); got != "" {
+		t.Errorf("expected no system prompt by default, got %q", got)
+	}
+	if got := agentSystemPrompt(&option{responseFormat: ResponseFormatJSON}); got != jsonResponseInstruction {
+		t.Errorf("expected the JSON instruction, got %q", got)
+	}
+	got := agentSystemPrompt(&option{systemPrompt: "Be brief.", responseFormat: ResponseFormatJSON})
+	if got != "Be brief.\n\n"+jsonResponseInstruction {
+		t.Errorf("expected the JSON instruction after the system prompt, got %q", got)
+	}
+	if _, err := NewSession(WithResponseFormat("yaml")); err == nil || !strings.Contains(err.Error(), "unknown response format") {
+		t.Errorf("expected an unknown format to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
+)
+
+// Restart relaunches the kimi subprocess of the session, e.g. after it crashed,
+// with the options the session was created with, and initializes it again with
+// the tools registered, including those added with AddTool. The session keeps
+// its ID, its settings and the values stored with Set. The conversation history
+// is kept by the CLI: it is restored only if the session was created with
+// WithSession, which makes the CLI persist it and load it again at startup.
+//
+// A subprocess still running is killed first. Restart fails with
+// ErrTurnInFlight while a turn is in flight, with ErrSessionClosed once the
+// session was closed or killed, and with errors.ErrUnsupported for a session
+// over WithTransport. If ctx is done before the new subprocess is initialized,
+// the subprocess is killed and Restart returns ctx.Err(); Restart can then be
+// called again. Restart must not be called concurrently with other methods of
+// the session.
+func (s *Session) Restart(ctx context.Context) error {
+	if s.closed.Load() {
+		return ErrSessionClosed
+	}
+	if s.cmd == nil {
+		return fmt.Errorf("restart a session over a transport: %w", errors.ErrUnsupported)
+	}
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	s.rwlock.RLock()
+	inFlight := len(s.cancellers) > 0
+	s.rwlock.RUnlock()
+	if inFlight {
+		return ErrTurnInFlight
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-s.exited
+	// Closing the codec waits, up to its shutdown timeout, for the requests
+	// in flight when the subprocess exited, which are never answered.
+	go s.codec.Close() //nolint:errcheck
+
+	watch, cancel, err := s.launch(s.parent, s.opt)
+	if err != nil {
+		return err
+	}
+	s.ready = make(chan struct{})
+	s.responder.ready = s.ready
+	go s.serve(s.codec, transport.NewTransportServer(s.responder))
+	stop := context.AfterFunc(ctx, cancel)
+	err = s.initialize(s.responder.tools)
+	stop()
+	if err != nil {
+		cancel()
+		watch()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return s.stderr.explain(err)
+	}
+	if s.logger != nil {
+		s.logger.Debug("session restarted", "pid", s.cmd.Process.Pid)
+	}
+	go watch()
+	return nil
+}
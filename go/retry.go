@@ -0,0 +1,141 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"slices"
+	"syscall"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// prompt sends content as a new turn that is retried up to retries times when
+// its stream ends with PromptResultStatusUnexpectedEOF. An exclusive turn runs
+// alone, see Compact.
+func (s *Session) prompt(ctx context.Context, content wire.Content, retries int, exclusive bool, extra ...turnOption) (*Turn, error) {
+	options := append(slices.Clip(s.turnOptions), extra...)
+	if retries > 0 {
+		options = append(options, func(t *Turn) {
+			t.retry = func(options ...turnOption) (*Turn, error) {
+				if ctx.Err() != nil {
+					return nil, nil
+				}
+				return s.prompt(ctx, content, retries-1, false, options...)
+			}
+		})
+	}
+	params := &wire.PromptParams{UserInput: content}
+	return roundtrip(ctx, s, &turnConstructor{s.tp, params, options}, params, exclusive)
+}
+
+// IsRetryable reports whether the turn, once ended, failed in a way that
+// sending the same prompt again may fix: its stream ended without TurnEnd
+// (io.ErrUnexpectedEOF), or its request failed with a transport error, such as
+// a broken pipe or a connection closed mid-request. A turn that finished,
+// reached the step limit or was cancelled is not retryable, nor is a turn that
+// failed because ctx was done, the session was closed or the agent rejected the
+// request, e.g. with a JSON-RPC error. IsRetryable returns false for a nil turn.
+func IsRetryable(turn *Turn) bool {
+	if turn == nil {
+		return false
+	}
+	switch turn.Result().Status {
+	case wire.PromptResultStatusFinished,
+		wire.PromptResultStatusCancelled,
+		wire.PromptResultStatusMaxStepsReached:
+		return false
+	}
+	err := turn.Err()
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrSessionClosed) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, rpc.ErrShutdown) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.As(err, &netErr)
+}
+
+// retryUnexpectedEOF runs the turn again, once its stream has ended without
+// TurnEnd, and delivers the steps of the new attempt on steps. The turn then
+// reports the outcome of that attempt. See WithRetryOnUnexpectedEOF.
+func (t *Turn) retryUnexpectedEOF(steps chan<- *Step) {
+	if t.retry == nil || t.cancelled.Load() || t.Result().Status != wire.PromptResultStatusUnexpectedEOF {
+		return
+	}
+	if p := t.errorPointer.Load(); p != nil && *p != nil {
+		return
+	}
+	owner := t.sinkTurn()
+	next, err := t.retry(func(next *Turn) { next.sinkOwner = owner })
+	if err != nil {
+		t.errorPointer.Store(&err)
+		return
+	}
+	if next == nil {
+		return
+	}
+	t.next.Store(next)
+	if t.cancelled.Load() {
+		// The caller gave up on the turn while the retry was starting.
+		next.abort()
+	}
+	for step := range next.Steps {
+		t.delivered.Store(step)
+		select {
+		case steps <- step:
+		case <-next.current.Done():
+			// The retry was cancelled; its steps are no longer read.
+		}
+	}
+	t.adopt(next)
+}
+
+// adopt takes over the outcome of next, a retry of the turn that has ended:
+// the output tracked for the turn, its text, reasoning and tool calls, is that
+// of the last attempt, while its step count and token usage add up all
+// attempts.
+func (t *Turn) adopt(next *Turn) {
+	t.resultPointer.Store(next.resultPointer.Load())
+	t.errorPointer.Store(next.errorPointer.Load())
+	t.end.Store(next.end.Load())
+	t.nsteps.Add(next.nsteps.Load())
+
+	usage, nextUsage := t.Usage(), next.Usage()
+	total := &Usage{Context: nextUsage.Context, Tokens: usage.Tokens}
+	total.Tokens.InputOther += nextUsage.Tokens.InputOther
+	total.Tokens.Output += nextUsage.Tokens.Output
+	total.Tokens.InputCacheRead += nextUsage.Tokens.InputCacheRead
+	total.Tokens.InputCacheCreation += nextUsage.Tokens.InputCacheCreation
+	t.usage.Store(total)
+
+	next.toollock.Lock()
+	toolcalls, inflight := next.toolcalls, next.inflight
+	next.toollock.Unlock()
+	t.toollock.Lock()
+	t.toolcalls = toolcalls
+	t.inflight = inflight
+	t.toollock.Unlock()
+
+	next.textlock.Lock()
+	text, lastEventType, hasContent := next.text.String(), next.lastEventType, next.hasContent
+	think, thinkHidden := next.think.String(), next.thinkHidden
+	next.textlock.Unlock()
+	t.textlock.Lock()
+	t.text.Reset()
+	t.text.WriteString(text)
+	t.lastEventType = lastEventType
+	t.hasContent = hasContent
+	t.think.Reset()
+	t.think.WriteString(think)
+	t.thinkHidden = thinkHidden
+	t.textlock.Unlock()
+}
@@ -6,10 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/rpc"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -27,7 +31,32 @@ var (
 	tpname = reflect.TypeOf((*transport.Transport)(nil)).Elem().Name()
 )
 
+var (
+	ErrWorkDirNotWritable  = errors.New("work directory is not writable")
+	ErrSessionClosed       = errors.New("session closed")
+	ErrRequiredToolMissing = errors.New("required tool is not registered")
+	ErrTurnInFlight        = errors.New("a turn is in flight")
+	ErrBinaryNotFound      = errors.New("kimi CLI binary not found")
+)
+
+// ToolRejectedError is returned when the CLI rejects external tools advertised
+// to it, at initialization or by Session.AddTool.
+type ToolRejectedError struct {
+	Rejected []wire.RejectedExternalTool
+}
+
+func (e *ToolRejectedError) Error() string {
+	return fmt.Sprintf("%q tool is rejected: %s", e.Rejected[0].Name, e.Rejected[0].Reason)
+}
+
 func NewSession(options ...Option) (*Session, error) {
+	return NewSessionContext(context.Background(), options...)
+}
+
+// NewSessionContext is like NewSession, but ties the session to ctx:
+// when ctx is cancelled, the session is closed and the kimi subprocess is killed,
+// without an explicit call to Close. Subsequent operations return ErrSessionClosed.
+func NewSessionContext(parent context.Context, options ...Option) (*Session, error) {
 	opt := &option{
 		exec: "kimi",
 		args: []string{"--wire"},
@@ -38,116 +67,479 @@ func NewSession(options ...Option) (*Session, error) {
 			f(opt)
 		}
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	cmd := exec.CommandContext(ctx, opt.exec, opt.args...)
+	if err := opt.responseFormat.validate(); err != nil {
+		return nil, err
+	}
+	if opt.approvalHandler != nil && opt.interaction != nil {
+		return nil, errors.New("WithApprovalHandler and WithInteractionHandler cannot be combined")
+	}
+	if opt.binaryPath != "" && opt.transport == nil {
+		path, err := resolveBinaryPath(opt.binaryPath)
+		if err != nil {
+			return nil, err
+		}
+		opt.exec = path
+	}
+	if opt.requireWritableWorkDir {
+		if err := checkWritableDir(opt.workDir); err != nil {
+			return nil, err
+		}
+	}
+	for i, tool := range opt.tools {
+		if doc, ok := opt.toolDocs[tool.def.Name]; ok {
+			documented, err := tool.withDoc(doc)
+			if err != nil {
+				return nil, err
+			}
+			opt.tools[i] = documented
+		}
+	}
+	if opt.interaction != nil && !opt.noUserInputTool {
+		tool, err := newUserInputTool(opt.interaction)
+		if err != nil {
+			return nil, err
+		}
+		opt.tools = append(opt.tools, tool)
+	}
+	if err := checkRequiredTools(opt.requiredTools, opt.tools); err != nil {
+		return nil, err
+	}
+	if opt.transport != nil {
+		return newTransportSession(parent, opt)
+	}
+	session := newSession(opt)
+	watch, cancel, err := session.launch(parent, opt)
+	if err != nil {
+		return nil, err
+	}
+	wireProtocolVersion, err := getWireProtocolVersion(opt.exec)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	responder, err := session.configure(opt, wireProtocolVersion)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// Serve before initializing, so that a request the agent sends while the
+	// initialize call is in flight is answered instead of stalling the codec.
+	go session.serve(session.codec, transport.NewTransportServer(responder))
+	if err := session.initialize(opt.tools); err != nil {
+		cancel()
+		watch()
+		err = session.stderr.explain(err)
+		if session.logger != nil {
+			session.logger.Error("session failed to start", "error", err)
+		}
+		return nil, err
+	}
+	if session.logger != nil {
+		session.logger.Debug("session started", "pid", session.cmd.Process.Pid, "wire_protocol_version", wireProtocolVersion)
+	}
+	go watch()
+	session.parent = parent
+	session.opt = opt
+	session.stopAfterFunc = context.AfterFunc(parent, func() {
+		session.close() //nolint:errcheck
+	})
+	return session, nil
+}
+
+// launch starts the kimi subprocess of the session, tied to parent, and
+// connects the session to it. It returns watch, which waits for the subprocess
+// to exit and releases its resources, and cancel, which kills it.
+func (s *Session) launch(parent context.Context, opt *option) (watch, cancel func(), err error) {
+	args := opt.args
+	removeAgentFile := func() {}
+	if systemPrompt := agentSystemPrompt(opt); systemPrompt != "" {
+		path, remove, err := writeSystemPromptAgent(systemPrompt)
+		if err != nil {
+			return nil, nil, err
+		}
+		args = append(slices.Clip(args), "--agent-file", path)
+		removeAgentFile = remove
+	}
+	ctx, cancelContext := context.WithCancel(parent)
+	// The agent file is read at startup, and only needed as long as the
+	// subprocess may run.
+	cancel = func() {
+		cancelContext()
+		removeAgentFile()
+	}
+	cmd := exec.CommandContext(ctx, opt.exec, args...)
 	cmd.Env = append(cmd.Env, opt.envs...)
+	stderr := &stderrTail{}
+	cmd.Stderr = stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
 		cancel()
-		return nil, err
+		return nil, nil, err
 	}
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		cancel()
-		return nil, err
+		return nil, nil, err
 	}
 	if err := cmd.Start(); err != nil {
 		cancel()
-		return nil, err
+		return nil, nil, err
 	}
-	watch := func() {
+	exited := make(chan struct{})
+	watch = func() {
 		cmd.Wait()
 		stdin.Close()
 		stdout.Close()
 		cancel()
+		close(exited)
 	}
-	codec := jsonrpc2.NewCodec(&stdio{stdin, stdout},
+	codecOptions := []jsonrpc2.CodecOption{
 		jsonrpc2.ClientMethodRenamer(jsonrpc2.RenamerFunc(func(method string) string {
 			return strings.ToLower(strings.TrimPrefix(method, tpname+"."))
 		})),
 		jsonrpc2.ServerMethodRenamer(jsonrpc2.RenamerFunc(func(method string) string {
 			return tpname + "." + cases.Title(language.English).String(method)
 		})),
-	)
-	tp := transport.NewTransportClient(rpc.NewClientWithCodec(codec))
-	session := &Session{
-		ctx:   ctx,
-		cmd:   cmd,
-		codec: codec,
-		tp:    tp,
 	}
-	responder := &Responder{
-		rwlock:                  &session.rwlock,
-		pending:                 &session.pending,
-		wireMessageBridge:       &session.wireMessageBridge,
-		wireRequestResponseChan: &session.wireRequestResponseChan,
+	if opt.lenientJSON {
+		codecOptions = append(codecOptions, jsonrpc2.LenientJSON())
 	}
-	wireProtocolVersion, err := getWireProtocolVersion(opt.exec)
+	if s.logger != nil {
+		codecOptions = append(codecOptions, jsonrpc2.FrameLogger(s.logger, LevelTrace))
+	}
+	codec := jsonrpc2.NewCodec(&stdio{stdin, stdout}, codecOptions...)
+	s.ctx = ctx
+	s.cmd = cmd
+	s.codec = codec
+	s.tp = transport.NewTransportClient(rpc.NewClientWithCodec(codec))
+	s.stderr = stderr
+	s.exited = exited
+	return watch, cancel, nil
+}
+
+// newTransportSession creates a session talking to the agent over the
+// transport set with WithTransport instead of a kimi subprocess.
+func newTransportSession(parent context.Context, opt *option) (*Session, error) {
+	ctx, cancel := context.WithCancel(parent)
+	session := newSession(opt)
+	session.ctx = ctx
+	session.cancel = cancel
+	session.tp = opt.transport
+	responder, err := session.configure(opt, TransportWireProtocolVersion)
 	if err != nil {
 		cancel()
 		return nil, err
 	}
-	if wireProtocolVersion >= "1.1" {
-		var toolDefs []wire.ExternalTool
-		for _, tool := range opt.tools {
-			toolDefs = append(toolDefs, tool.def)
-		}
-		initResult, err := tp.Initialize(&wire.InitializeParams{
-			ProtocolVersion: wireProtocolVersion,
-			ExternalTools:   toolDefs,
-		})
-		if err != nil {
-			cancel()
-			return nil, err
-		}
-		if initResult.ExternalTools.Valid && len(initResult.ExternalTools.Value.Rejected) > 0 {
-			cancel()
-			return nil, fmt.Errorf("%q tool is rejected: %s",
-				initResult.ExternalTools.Value.Rejected[0].Name,
-				initResult.ExternalTools.Value.Rejected[0].Reason)
+	if binder, ok := opt.transport.(TransportBinder); ok {
+		binder.Bind(responder)
+	}
+	if err := session.initialize(opt.tools); err != nil {
+		session.close() //nolint:errcheck
+		if session.logger != nil {
+			session.logger.Error("session failed to start", "error", err)
 		}
-		session.SlashCommands = initResult.SlashCommands
-		responder.tools = opt.tools
+		return nil, err
 	}
-	session.wireProtocolVersion = wireProtocolVersion
-	go session.serve(transport.NewTransportServer(responder))
-	go watch()
+	if session.logger != nil {
+		session.logger.Debug("session started", "wire_protocol_version", TransportWireProtocolVersion)
+	}
+	session.stopAfterFunc = context.AfterFunc(parent, func() {
+		session.close() //nolint:errcheck
+	})
 	return session, nil
 }
 
+// newSession returns a session, identified by a new ID, without its connection
+// to the agent.
+func newSession(opt *option) *Session {
+	id := newSessionID()
+	return &Session{
+		id:     id,
+		logger: sessionLogger(opt.logger, id),
+	}
+}
+
+// configure applies opt to the session, once the wire protocol version of the
+// agent is known, and returns the responder answering the agent's events and
+// requests.
+func (s *Session) configure(opt *option, wireProtocolVersion string) (*Responder, error) {
+	if opt.argRepair {
+		s.turnOptions = append(s.turnOptions, func(t *Turn) { t.argRepair = true })
+	}
+	s.turnOptions = append(s.turnOptions, s.captureCompactionSummary(opt.summarizeCompaction))
+	if opt.onEchoMismatch != nil {
+		s.turnOptions = append(s.turnOptions, func(t *Turn) { t.onEchoMismatch = opt.onEchoMismatch })
+	}
+	if opt.classifyError != nil {
+		s.turnOptions = append(s.turnOptions, func(t *Turn) { t.classifyError = opt.classifyError })
+	}
+	if opt.coalesceText > 0 {
+		s.turnOptions = append(s.turnOptions, func(t *Turn) { t.coalescer.interval = opt.coalesceText })
+	}
+	s.retryOnUnexpectedEOF = opt.retryOnUnexpectedEOF
+	s.maxContentPartBytes = opt.maxContentPartBytes
+	if len(opt.fewShotExamples) > 0 {
+		examples := formatFewShotExamples(opt.fewShotExamples)
+		s.fewShotExamples.Store(&examples)
+	}
+	if opt.mediaSaveDir != "" {
+		s.turnOptions = append(s.turnOptions, func(t *Turn) { t.media = &mediaSaver{dir: opt.mediaSaveDir, client: opt.mediaHTTPClient} })
+	}
+	responder := &Responder{
+		rwlock:                  &s.rwlock,
+		pending:                 &s.pending,
+		wireMessageBridge:       &s.wireMessageBridge,
+		wireRequestResponseChan: &s.wireRequestResponseChan,
+		roundtripContext:        &s.roundtripContext,
+		observers:               opt.observers,
+		interaction:             opt.interaction,
+		interceptToolResult:     opt.toolResultInterceptor,
+		logger:                  s.logger,
+	}
+	if opt.approvalHandler != nil {
+		responder.approvalHandler = opt.approvalHandler
+		responder.approvals = &sessionApprovals{}
+	}
+	if opt.writeConflictPolicy != WriteConflictAllow {
+		responder.writes = newWriteLocks(opt.writeConflictPolicy)
+	}
+	if opt.toolsDryRun {
+		s.dryRun = &dryRun{}
+		responder.dryRun = s.dryRun
+	}
+	s.wireProtocolVersion = wireProtocolVersion
+	if s.Features().SupportsExternalTools {
+		responder.tools = opt.tools
+	} else if len(opt.requiredTools) > 0 {
+		return nil, fmt.Errorf("%w: %s: wire protocol version %s does not support external tools",
+			ErrRequiredToolMissing, strings.Join(opt.requiredTools, ", "), wireProtocolVersion)
+	}
+	s.ready = make(chan struct{})
+	responder.ready = s.ready
+	s.responder = responder
+	return responder, nil
+}
+
 type Session struct {
+	id                      string
+	logger                  *slog.Logger
 	ctx                     context.Context
+	cancel                  context.CancelFunc // set for sessions over a transport, see WithTransport
 	cmd                     *exec.Cmd
+	stderr                  *stderrTail
+	exited                  chan struct{} // closed once the subprocess has exited and been released
+	parent                  context.Context
+	opt                     *option // the options of the subprocess, see Restart
 	codec                   *jsonrpc2.Codec
 	pending                 atomic.Int64
 	rwlock                  sync.RWMutex
 	seq                     uint64
 	cancellers              []Canceller
+	exclusive               uint64 // the ID of the turn that runs alone, see Compact; 0 if none
 	wireProtocolVersion     string
 	wireMessageBridge       chan wire.Message
 	wireRequestResponseChan chan wire.RequestResponse
+	roundtripContext        context.Context
 	tp                      transport.Transport
+	turnOptions             []turnOption
+	dryRun                  *dryRun
+	values                  sync.Map
+	closed                  atomic.Bool
+	stopAfterFunc           func() bool
+	ready                   chan struct{}
+	initErr                 error
+	compactionSummary       atomic.Pointer[string]
+	retryOnUnexpectedEOF    int
+	maxContentPartBytes     int64
+	fewShotExamples         atomic.Pointer[string]
+	responder               *Responder
+	toolsMu                 sync.Mutex
+	tools                   []wire.ExternalTool
 
 	SlashCommands []wire.SlashCommand
 }
 
-func (s *Session) serve(responder *transport.TransportServer) {
+func (s *Session) initialize(tools []Tool) (err error) {
+	defer func() {
+		s.initErr = err
+		close(s.ready)
+	}()
+	if !s.Features().SupportsInitialize {
+		return nil
+	}
+	initResult, toolDefs, err := s.advertise(tools)
+	if err != nil {
+		return err
+	}
+	s.SlashCommands = initResult.SlashCommands
+	s.tools = toolDefs
+	return nil
+}
+
+// advertise sends the initialize request advertising tools to the CLI, and
+// fails if the CLI rejects any of them.
+func (s *Session) advertise(tools []Tool) (*wire.InitializeResult, []wire.ExternalTool, error) {
+	var toolDefs []wire.ExternalTool
+	for _, tool := range tools {
+		toolDefs = append(toolDefs, tool.Definition())
+	}
+	initResult, err := s.tp.Initialize(&wire.InitializeParams{
+		ProtocolVersion: s.wireProtocolVersion,
+		ExternalTools:   toolDefs,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if initResult.ExternalTools.Valid && len(initResult.ExternalTools.Value.Rejected) > 0 {
+		return nil, nil, &ToolRejectedError{Rejected: initResult.ExternalTools.Value.Rejected}
+	}
+	if s.logger != nil {
+		names := make([]string, len(toolDefs))
+		for i, def := range toolDefs {
+			names[i] = def.Name
+		}
+		s.logger.Debug("initialized", "external_tools", names, "slash_commands", len(initResult.SlashCommands))
+	}
+	return initResult, toolDefs, nil
+}
+
+// AddTool registers tool with the session after its creation, e.g. for a plugin
+// loaded at runtime. The external tool set is negotiated with the CLI again, by
+// repeating the initialize exchange with the new set. If the CLI rejects the
+// tool, AddTool returns a *ToolRejectedError and the tool is not registered.
+// It fails with ErrTurnInFlight while a turn is in flight.
+func (s *Session) AddTool(tool *Tool) error {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	tools, err := s.registeredTools()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(tools, func(t Tool) bool { return t.def.Name == tool.def.Name }) {
+		return fmt.Errorf("tool %q is already registered", tool.def.Name)
+	}
+	return s.renegotiateTools(append(slices.Clip(tools), *tool))
+}
+
+// RemoveTool unregisters the tool named name, negotiating the external tool set
+// with the CLI again like AddTool. It fails with ErrTurnInFlight while a turn is
+// in flight.
+func (s *Session) RemoveTool(name string) error {
+	s.toolsMu.Lock()
+	defer s.toolsMu.Unlock()
+	tools, err := s.registeredTools()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(tools, func(t Tool) bool { return t.def.Name == name })
+	if i < 0 {
+		return fmt.Errorf("tool %q is not registered", name)
+	}
+	return s.renegotiateTools(slices.Delete(slices.Clone(tools), i, i+1))
+}
+
+// registeredTools returns the tools the session dispatches calls to, once
+// checked that they can be changed.
+func (s *Session) registeredTools() ([]Tool, error) {
+	if s.closed.Load() {
+		return nil, ErrSessionClosed
+	}
+	if !s.Features().SupportsExternalTools || s.responder == nil {
+		return nil, fmt.Errorf("wire protocol version %s does not support external tools", s.wireProtocolVersion)
+	}
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+	if len(s.cancellers) > 0 {
+		return nil, ErrTurnInFlight
+	}
+	return s.responder.tools, nil
+}
+
+// renegotiateTools advertises tools to the CLI and, once it accepts them all,
+// dispatches calls to them.
+func (s *Session) renegotiateTools(tools []Tool) error {
+	_, toolDefs, err := s.advertise(tools)
+	if err != nil {
+		return err
+	}
+	s.rwlock.Lock()
+	s.responder.tools = tools
+	s.tools = toolDefs
+	s.rwlock.Unlock()
+	return nil
+}
+
+// Tools returns the definitions of the external tools the session advertised to
+// the model, including those added by options such as WithInteractionHandler
+// and with AddTool, with the names and descriptions actually sent. It is empty
+// if the wire protocol of the CLI does not support external tools.
+func (s *Session) Tools() []wire.ExternalTool {
+	s.rwlock.RLock()
+	tools := slices.Clone(s.tools)
+	s.rwlock.RUnlock()
+	for i := range tools {
+		tools[i].Parameters = slices.Clone(tools[i].Parameters)
+	}
+	return tools
+}
+
+// Ready blocks until the session has finished initializing, or ctx is done,
+// and returns the initialization error, if any (including rejected tools).
+// NewSession currently completes initialization before returning, so Ready
+// returns immediately for any session it hands out; calling it keeps callers
+// correct should initialization become asynchronous.
+func (s *Session) Ready(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return s.initErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Set associates an application-defined value with the session under key.
+// Values are kept on the client side only and are never sent to the CLI.
+// It is safe for concurrent use.
+func (s *Session) Set(key string, v any) {
+	s.values.Store(key, v)
+}
+
+// Get returns the value previously stored with Set, and whether it was present.
+// It is safe for concurrent use.
+func (s *Session) Get(key string) (any, bool) {
+	return s.values.Load(key)
+}
+
+// serve answers the requests of the agent received on codec with responder,
+// until codec fails, e.g. once the subprocess has exited.
+func (s *Session) serve(codec *jsonrpc2.Codec, responder *transport.TransportServer) {
 	server := rpc.NewServer()
 	server.RegisterName(tpname, responder)
 	for {
-		if err := server.ServeRequest(s.codec); err != nil {
+		if err := server.ServeRequest(codec); err != nil {
 			return
 		}
 	}
 }
 
 func (s *Session) waitForDataExchange() {
-	for {
+	// Requests pending in the codec are never answered once the subprocess
+	// has exited, e.g. after Kill.
+	var exited <-chan struct{}
+	if s.ctx != nil {
+		exited = s.ctx.Done()
+	}
+codec:
+	for s.codec != nil {
 		pending := s.codec.PendingRequests()
 		if pending == 0 {
 			break
 		}
-		time.Sleep(time.Duration(pending) * time.Second)
+		select {
+		case <-time.After(time.Duration(pending) * time.Second):
+		case <-exited:
+			break codec
+		}
 	}
 	for {
 		pending := s.pending.Load()
@@ -159,13 +551,32 @@ func (s *Session) waitForDataExchange() {
 }
 
 func (s *Session) Prompt(ctx context.Context, content wire.Content) (*Turn, error) {
-	return roundtrip(ctx, s, &turnConstructor{s.tp, content})
+	if err := checkContentPartSizes(content, s.maxContentPartBytes); err != nil {
+		return nil, err
+	}
+	content, examples := s.withFewShotExamples(content)
+	turn, err := s.prompt(ctx, content, s.retryOnUnexpectedEOF, false)
+	if err != nil && examples != nil {
+		// The prompt failed, so the next one carries the examples instead.
+		s.fewShotExamples.CompareAndSwap(nil, examples)
+	}
+	return turn, err
 }
 
 func roundtrip[T any, R any, I interface {
 	Cargo[R]
 	*T
-}](ctx context.Context, s *Session, constructor Constructor[T, R]) (*T, error) {
+}](ctx context.Context, s *Session, constructor Constructor[T, R], args any, exclusive bool) (*T, error) {
+	if s.closed.Load() {
+		return nil, ErrSessionClosed
+	}
+	if s.ctx != nil {
+		select {
+		case <-s.ctx.Done():
+			return nil, ErrSessionClosed
+		default:
+		}
+	}
 	// Check if context is already cancelled before starting any work
 	select {
 	case <-ctx.Done():
@@ -184,8 +595,18 @@ func roundtrip[T any, R any, I interface {
 		wireMessageChan         = make(chan wire.Message)
 	)
 	s.rwlock.Lock()
+	// A turn that runs alone fails if another one is in flight, and keeps others
+	// from starting until it ends.
+	if s.exclusive != 0 || exclusive && (len(s.cancellers) > 0 || s.wireMessageBridge != nil) {
+		s.rwlock.Unlock()
+		return nil, ErrTurnInFlight
+	}
+	if exclusive {
+		s.exclusive = id
+	}
 	s.wireMessageBridge = wireMessageBridge
 	s.wireRequestResponseChan = wireRequestResponseChan
+	s.roundtripContext = ctx
 	s.rwlock.Unlock()
 	var rpcErrorSignal = make(chan struct{})
 	bg.Go(func() {
@@ -214,6 +635,7 @@ func roundtrip[T any, R any, I interface {
 			s.rwlock.Lock()
 			s.wireMessageBridge = nil
 			s.wireRequestResponseChan = nil
+			s.roundtripContext = nil
 			s.rwlock.Unlock()
 			close(wireMessageBridge)
 			close(rpcErrorChan)
@@ -238,7 +660,7 @@ func roundtrip[T any, R any, I interface {
 		}
 		resultPointer.Store(rpcresult)
 	})
-	exit := func(err error) error {
+	finish := func(err error) error {
 		for range wireMessageBridge {
 		}
 		bg.Wait()
@@ -250,11 +672,17 @@ func roundtrip[T any, R any, I interface {
 				break
 			}
 		}
+		if s.exclusive == id {
+			s.exclusive = 0
+		}
 		s.rwlock.Unlock()
 		select {
 		case <-s.ctx.Done():
+			if s.cmd == nil {
+				break
+			}
 			if state := s.cmd.ProcessState; state.ExitCode() > 0 {
-				return errors.New(state.String())
+				return s.stderr.explain(errors.New(state.String()))
 			}
 		default:
 		}
@@ -263,6 +691,13 @@ func roundtrip[T any, R any, I interface {
 		}
 		return nil
 	}
+	exit := func(err error) error {
+		err = finish(err)
+		if s.logger != nil {
+			s.logger.Debug("turn finished", append([]any{"turn_id", id}, errorAttrs(err)...)...)
+		}
+		return err
+	}
 	select {
 	case <-cargoAvailableChan:
 		close(deliveredSignal)
@@ -280,10 +715,19 @@ func roundtrip[T any, R any, I interface {
 		s.rwlock.Lock()
 		s.cancellers = append(s.cancellers, I(value))
 		s.rwlock.Unlock()
+		if s.logger != nil {
+			s.logger.Debug("turn started", "turn_id", id)
+		}
 		return value, nil
 	case err := <-rpcErrorChan:
 		return nil, exit(err)
 	case <-ctx.Done():
+		// The request may still be uploading, e.g. a prompt carrying a large image;
+		// stop transmitting it rather than waiting for the upload to finish. args
+		// tells its frame apart from those of other requests.
+		if s.codec != nil {
+			s.codec.InterruptWrite(args)
+		}
 		return nil, exit(ctx.Err())
 	}
 }
@@ -294,7 +738,74 @@ type Responder struct {
 	pending                 *atomic.Int64
 	wireMessageBridge       *chan wire.Message
 	wireRequestResponseChan *chan wire.RequestResponse
+	roundtripContext        *context.Context
 	tools                   []Tool
+	observers               []ApprovalObserver
+	dryRun                  *dryRun
+	interaction             InteractionHandler
+	approvalHandler         ApprovalHandler
+	approvals               *sessionApprovals
+	interceptToolResult     ToolResultInterceptor
+	ready                   <-chan struct{}
+	writes                  *writeLocks
+	logger                  *slog.Logger
+}
+
+// ToolInvocation records a call to an external tool.
+type ToolInvocation struct {
+	ID        string
+	Name      string
+	Arguments string
+}
+
+type dryRun struct {
+	mu          sync.Mutex
+	invocations []ToolInvocation
+}
+
+func (d *dryRun) record(invocation ToolInvocation) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.invocations = append(d.invocations, invocation)
+}
+
+// DryRunInvocations returns the tool calls intercepted so far when the session
+// was created with WithToolsDryRun, in call order. It returns nil otherwise.
+func (s *Session) DryRunInvocations() []ToolInvocation {
+	if s.dryRun == nil {
+		return nil
+	}
+	s.dryRun.mu.Lock()
+	defer s.dryRun.mu.Unlock()
+	return append([]ToolInvocation(nil), s.dryRun.invocations...)
+}
+
+// ToolResultInterceptor is called with the result of each external tool call
+// before it is sent to the model, see WithToolResultInterceptor.
+type ToolResultInterceptor func(name string, result *wire.ToolResultReturnValue) error
+
+// ApprovalObserver is invoked after an approval request has been resolved.
+type ApprovalObserver func(req wire.ApprovalRequest, decision wire.ApprovalRequestResponse, source string)
+
+const (
+	// ApprovalSourceHandler means the decision was made by calling Respond on the request.
+	ApprovalSourceHandler = "handler"
+	// ApprovalSourceInteractionHandler means the decision was made by the InteractionHandler.
+	ApprovalSourceInteractionHandler = "interaction_handler"
+	// ApprovalSourceApprovalHandler means the decision was made by the ApprovalHandler.
+	ApprovalSourceApprovalHandler = "approval_handler"
+	// ApprovalSourceSessionApproval means the action was approved for the session
+	// earlier by the ApprovalHandler, which was not called again.
+	ApprovalSourceSessionApproval = "session_approval"
+)
+
+func (r *Responder) observeApproval(req wire.ApprovalRequest, decision wire.ApprovalRequestResponse, source string) {
+	if r.logger != nil {
+		r.logger.Debug("approval resolved", "approval_id", req.ID, "decision", decision, "source", source)
+	}
+	for _, observer := range r.observers {
+		observer(req, decision, source)
+	}
 }
 
 func (r *Responder) Event(event *wire.EventParams) (*wire.EventResult, error) {
@@ -302,17 +813,70 @@ func (r *Responder) Event(event *wire.EventParams) (*wire.EventResult, error) {
 	defer r.pending.Add(-1)
 	r.rwlock.RLock()
 	defer r.rwlock.RUnlock()
+	if r.logger != nil {
+		r.logger.Debug("event received", "type", event.Type)
+	}
 	if *r.wireMessageBridge != nil {
 		*r.wireMessageBridge <- event.Payload
 	}
 	return &wire.EventResult{}, nil
 }
 
+// tool returns the external tool registered under name.
+func (r *Responder) tool(name string) (Tool, bool) {
+	for _, tool := range r.tools {
+		if tool.def.Name == name {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+// toolDefinition returns the definition of the external tool registered under
+// name, generated again from the registered tool as it was advertised at
+// initialize, e.g. to answer an agent asking for a tool's schema again. No
+// released wire protocol version sends such a request yet.
+func (r *Responder) toolDefinition(name string) (wire.ExternalTool, error) {
+	tool, ok := r.tool(name)
+	if !ok {
+		return wire.ExternalTool{}, jsonrpc2.Error{
+			Code:    jsonrpc2.ErrorCodeInvalidParams,
+			Message: fmt.Sprintf("tool not found: %s", name),
+		}
+	}
+	return tool.Definition(), nil
+}
+
+// callTool calls tool, once the policy set with WithWriteConflictPolicy lets
+// it write its file.
+func (r *Responder) callTool(ctx context.Context, tool Tool, args json.RawMessage) (wire.ToolResultReturnValue, error) {
+	if r.writes != nil && tool.writePath != nil {
+		if path, ok := tool.writePath(args); ok {
+			release, err := r.writes.acquire(path)
+			if err != nil {
+				return wire.ToolResultReturnValue{}, err
+			}
+			defer release()
+		}
+	}
+	return tool.call(ctx, args)
+}
+
 func (r *Responder) Request(request *wire.RequestParams) (wire.RequestResult, error) {
 	r.pending.Add(1)
 	defer r.pending.Add(-1)
 	r.rwlock.RLock()
 	defer r.rwlock.RUnlock()
+	if r.ready != nil {
+		select {
+		case <-r.ready:
+		default:
+			return nil, jsonrpc2.Error{
+				Code:    jsonrpc2.ErrorCodeInternalError,
+				Message: "session is not initialized yet",
+			}
+		}
+	}
 	if *r.wireMessageBridge == nil || *r.wireRequestResponseChan == nil {
 		return nil, jsonrpc2.Error{
 			Code:    jsonrpc2.ErrorCodeInternalError,
@@ -321,6 +885,25 @@ func (r *Responder) Request(request *wire.RequestParams) (wire.RequestResult, er
 	}
 	switch req := request.Payload.(type) {
 	case wire.ApprovalRequest:
+		if r.logger != nil {
+			r.logger.Debug("approval requested", "approval_id", req.ID, "tool_call_id", req.ToolCallID, "sender", req.Sender, "action", req.Action)
+		}
+		if r.approvalHandler != nil {
+			decision, source := r.handleApproval(req)
+			r.observeApproval(req, decision, source)
+			return &wire.ApprovalResponse{
+				RequestID: req.ID,
+				Response:  decision,
+			}, nil
+		}
+		if r.interaction != nil {
+			decision := r.interaction.Approve(r.context(), req)
+			r.observeApproval(req, decision, ApprovalSourceInteractionHandler)
+			return &wire.ApprovalResponse{
+				RequestID: req.ID,
+				Response:  decision,
+			}, nil
+		}
 		req.Responder = ResponderFunc(func(rr wire.RequestResponse) error {
 			if _, ok := rr.(wire.ApprovalRequestResponse); !ok {
 				return fmt.Errorf("invalid approval request response type: %T", rr)
@@ -329,30 +912,42 @@ func (r *Responder) Request(request *wire.RequestParams) (wire.RequestResult, er
 			return nil
 		})
 		*r.wireMessageBridge <- req
+		decision := (<-*r.wireRequestResponseChan).(wire.ApprovalRequestResponse)
+		r.observeApproval(req, decision, ApprovalSourceHandler)
 		return &wire.ApprovalResponse{
 			RequestID: req.ID,
-			Response:  (<-*r.wireRequestResponseChan).(wire.ApprovalRequestResponse),
+			Response:  decision,
 		}, nil
 	case wire.ToolCallRequest:
-		for _, tool := range r.tools {
-			if req.Name == tool.def.Name && req.Arguments.Valid {
-				toolResult, err := tool.call(json.RawMessage(req.Arguments.Value))
-				var output wire.Content
-				if err != nil {
-					output = wire.NewStringContent(err.Error())
-				} else {
-					output = wire.NewStringContent(toolResult)
+		if tool, ok := r.tool(req.Name); ok && req.Arguments.Valid {
+			var (
+				returnValue wire.ToolResultReturnValue
+				err         error
+			)
+			if r.dryRun != nil {
+				r.dryRun.record(ToolInvocation{ID: req.ID, Name: req.Name, Arguments: req.Arguments.Value})
+				returnValue = wire.ToolResultReturnValue{
+					Output:  wire.NewStringContent(""),
+					Display: []wire.DisplayBlock{},
 				}
-				return &wire.ToolResult{
-					ToolCallID: req.ID,
-					ReturnValue: wire.ToolResultReturnValue{
-						IsError: err != nil,
-						Output:  output,
-						Message: "",
-						Display: []wire.DisplayBlock{},
-					},
-				}, nil
+			} else {
+				returnValue, err = r.callTool(r.context(), tool, json.RawMessage(req.Arguments.Value))
+			}
+			if r.logger != nil {
+				r.logger.Debug("tool called", append([]any{"tool", req.Name, "tool_call_id", req.ID, "dry_run", r.dryRun != nil}, errorAttrs(err)...)...)
 			}
+			if err != nil {
+				returnValue = toolErrorResult(err)
+			}
+			if r.interceptToolResult != nil {
+				if err := r.interceptToolResult(req.Name, &returnValue); err != nil {
+					returnValue = toolErrorResult(err)
+				}
+			}
+			return &wire.ToolResult{
+				ToolCallID:  req.ID,
+				ReturnValue: returnValue,
+			}, nil
 		}
 		return nil, jsonrpc2.Error{
 			Code:    jsonrpc2.ErrorCodeInvalidParams,
@@ -366,8 +961,69 @@ func (r *Responder) Request(request *wire.RequestParams) (wire.RequestResult, er
 	}
 }
 
+// toolErrorResult is the result reporting to the model that a tool call failed
+// with err.
+func toolErrorResult(err error) wire.ToolResultReturnValue {
+	return wire.ToolResultReturnValue{
+		IsError: true,
+		Output:  wire.NewStringContent(err.Error()),
+		Display: []wire.DisplayBlock{},
+	}
+}
+
+// Close cancels all in-flight turns and terminates the kimi subprocess.
+// Calling Close more than once is a no-op.
 func (s *Session) Close() error {
-	defer s.codec.Close()
+	if s.stopAfterFunc != nil {
+		s.stopAfterFunc()
+	}
+	return s.close()
+}
+
+// Kill terminates the kimi subprocess immediately with SIGKILL, without the
+// graceful shutdown of Close, e.g. for emergency teardown when the subprocess
+// no longer responds and Close hangs. Turns in flight end with an error, and
+// later operations return ErrSessionClosed. It is safe to call after Close, or
+// more than once.
+func (s *Session) Kill() error {
+	if s.stopAfterFunc != nil {
+		s.stopAfterFunc()
+	}
+	closed := s.closed.Swap(true)
+	if !closed && s.logger != nil {
+		s.logger.Debug("session killed")
+	}
+	if !closed && s.codec != nil {
+		// Closing the codec fails the calls in flight right away. It then waits
+		// for the pending requests, which the killed subprocess never answers,
+		// so it must not hold up Kill.
+		go s.codec.Close() //nolint:errcheck
+	}
+	if s.cmd == nil {
+		if closed {
+			return nil
+		}
+		return s.closeTransport()
+	}
+	if s.cmd.Process == nil {
+		return nil
+	}
+	if err := s.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	return nil
+}
+
+func (s *Session) close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	if s.logger != nil {
+		s.logger.Debug("session closed")
+	}
+	if s.codec != nil {
+		defer s.codec.Close()
+	}
 	s.rwlock.Lock()
 	cancels := make([]func() error, len(s.cancellers))
 	for i, canceller := range s.cancellers {
@@ -378,9 +1034,58 @@ func (s *Session) Close() error {
 	for _, cancel := range cancels {
 		cancel() //nolint:errcheck
 	}
+	if s.cmd == nil {
+		return s.closeTransport()
+	}
 	return s.cmd.Cancel()
 }
 
+// closeTransport ends a session over a transport set with WithTransport, and
+// closes the transport if it is an io.Closer.
+func (s *Session) closeTransport() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if closer, ok := s.tp.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// maxStderrTail is the number of bytes of the subprocess's standard error kept
+// to explain its failures.
+const maxStderrTail = 4096
+
+// stderrTail keeps the end of the subprocess's standard error, e.g. the CLI's
+// message about an unknown model, to add it to the errors its exit causes.
+type stderrTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > maxStderrTail {
+		t.buf = slices.Clone(t.buf[len(t.buf)-maxStderrTail:])
+	}
+	return len(p), nil
+}
+
+// explain adds the subprocess's last words on standard error, if any, to err.
+func (t *stderrTail) explain(err error) error {
+	if t == nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if msg := strings.TrimSpace(string(t.buf)); msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
 type stdio struct {
 	io.WriteCloser
 	io.ReadCloser
@@ -427,13 +1132,12 @@ type Constructor[T any, R any] interface {
 
 type turnConstructor struct {
 	transport transport.Transport
-	content   wire.Content
+	params    *wire.PromptParams
+	options   []turnOption
 }
 
 func (tc *turnConstructor) RPCRequest() (*wire.PromptResult, error) {
-	return tc.transport.Prompt(&wire.PromptParams{
-		UserInput: tc.content,
-	})
+	return tc.transport.Prompt(tc.params)
 }
 
 func (tc *turnConstructor) Construct(
@@ -457,9 +1161,56 @@ func (tc *turnConstructor) Construct(
 		wireMessageChan,
 		wireRequestResponseChan,
 		exit,
+		append(slices.Clip(tc.options), func(t *Turn) { t.input = tc.params.UserInput })...,
 	)
 }
 
+func checkRequiredTools(required []string, tools []Tool) error {
+	var missing []string
+	for _, name := range required {
+		if !slices.ContainsFunc(tools, func(tool Tool) bool { return tool.def.Name == name }) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrRequiredToolMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkWritableDir(dir string) error {
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		dir = wd
+	}
+	probe, err := os.CreateTemp(dir, ".kimi-write-probe-*")
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrWorkDirNotWritable, dir, err)
+	}
+	return errors.Join(probe.Close(), os.Remove(probe.Name()))
+}
+
+// resolveBinaryPath returns the absolute path of the kimi CLI binary at path,
+// see WithBinaryPath, or an error wrapping ErrBinaryNotFound and mentioning
+// that path if it is not an executable file.
+func resolveBinaryPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrBinaryNotFound, path, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %w", ErrBinaryNotFound, abs, err)
+	}
+	if info.IsDir() || (runtime.GOOS != "windows" && info.Mode().Perm()&0o111 == 0) {
+		return "", fmt.Errorf("%w: %s: not an executable file", ErrBinaryNotFound, abs)
+	}
+	return abs, nil
+}
+
 func getWireProtocolVersion(executable string) (string, error) {
 	cmd := exec.Command(executable, "info", "--json")
 	output, err := cmd.CombinedOutput()
@@ -1,12 +1,30 @@
 package kimi
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
 
 	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/jsonrpc2"
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
 )
 
 func TestResponder_Event(t *testing.T) {
@@ -127,6 +145,64 @@ func TestResponder_Request_ApprovalRequest(t *testing.T) {
 	}
 }
 
+func TestResponder_Request_ApprovalObserver(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	type observation struct {
+		req      wire.ApprovalRequest
+		decision wire.ApprovalRequestResponse
+		source   string
+	}
+	var observed []observation
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		observers: []ApprovalObserver{
+			func(req wire.ApprovalRequest, decision wire.ApprovalRequestResponse, source string) {
+				observed = append(observed, observation{req, decision, source})
+			},
+		},
+	}
+
+	request := &wire.RequestParams{
+		Type: wire.RequestTypeApprovalRequest,
+		Payload: wire.ApprovalRequest{
+			ID:     "req-123",
+			Action: "execute",
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := responder.Request(request); err != nil {
+			t.Errorf("Request: %v", err)
+		}
+	}()
+
+	msg := <-msgs
+	msg.(wire.ApprovalRequest).Respond(wire.ApprovalRequestResponseReject)
+	<-done
+
+	if len(observed) != 1 {
+		t.Fatalf("expected 1 observation, got %d", len(observed))
+	}
+	if observed[0].req.ID != "req-123" {
+		t.Errorf("expected request ID 'req-123', got %s", observed[0].req.ID)
+	}
+	if observed[0].decision != wire.ApprovalRequestResponseReject {
+		t.Errorf("expected decision 'reject', got %s", observed[0].decision)
+	}
+	if observed[0].source != ApprovalSourceHandler {
+		t.Errorf("expected source %q, got %q", ApprovalSourceHandler, observed[0].source)
+	}
+}
+
 func TestResponder_Request_NilMsgs(t *testing.T) {
 	var msgs chan wire.Message
 	usrc := make(chan wire.RequestResponse, 1)
@@ -153,6 +229,1407 @@ func TestResponder_Request_NilMsgs(t *testing.T) {
 	}
 }
 
+func TestResponder_toolDefinition(t *testing.T) {
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return args.Input, nil
+	}, WithName("search"), WithDescription("Search the index"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	responder := &Responder{tools: []Tool{tool}}
+
+	def, err := responder.toolDefinition("search")
+	if err != nil {
+		t.Fatalf("toolDefinition: %v", err)
+	}
+	if !reflect.DeepEqual(def, tool.Definition()) {
+		t.Errorf("expected the advertised definition %+v, got %+v", tool.Definition(), def)
+	}
+	if !strings.Contains(string(def.Parameters), `"input"`) {
+		t.Errorf("expected the schema of the tool's arguments, got %s", def.Parameters)
+	}
+
+	_, err = responder.toolDefinition("missing")
+	var rpcErr jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.ErrorCodeInvalidParams {
+		t.Errorf("expected an invalid params error for an unknown tool, got %v", err)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_DryRun(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	var executed bool
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		executed = true
+		return "real result", nil
+	}, WithName("side_effect"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	dry := &dryRun{}
+	session := &Session{dryRun: dry}
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+		dryRun:                  dry,
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "side_effect",
+			Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if executed {
+		t.Error("expected tool body not to run in dry-run mode")
+	}
+	toolResult, ok := result.(*wire.ToolResult)
+	if !ok {
+		t.Fatalf("expected *wire.ToolResult, got %T", result)
+	}
+	if toolResult.ToolCallID != "call-1" || toolResult.ReturnValue.IsError {
+		t.Errorf("unexpected tool result: %+v", toolResult)
+	}
+	if toolResult.ReturnValue.Output.Text.Value != "" {
+		t.Errorf("expected empty output, got %q", toolResult.ReturnValue.Output.Text.Value)
+	}
+
+	invocations := session.DryRunInvocations()
+	expected := []ToolInvocation{{ID: "call-1", Name: "side_effect", Arguments: `{"input":"x"}`}}
+	if !reflect.DeepEqual(invocations, expected) {
+		t.Errorf("expected invocations %v, got %v", expected, invocations)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_DryRunIntercepted(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return "real result", nil
+	}, WithName("side_effect"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var intercepted []string
+	var logs strings.Builder
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+		dryRun:                  &dryRun{},
+		interceptToolResult: func(name string, result *wire.ToolResultReturnValue) error {
+			intercepted = append(intercepted, name)
+			result.Output = wire.NewStringContent("(dry run)")
+			return nil
+		},
+		logger: slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "side_effect",
+			Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if !reflect.DeepEqual(intercepted, []string{"side_effect"}) {
+		t.Errorf("expected the dry-run result to be intercepted once, got %v", intercepted)
+	}
+	if got := result.(*wire.ToolResult).ReturnValue.Output.Text.Value; got != "(dry run)" {
+		t.Errorf("expected the intercepted output, got %q", got)
+	}
+	if expected := `msg="tool called" tool=side_effect tool_call_id=call-1 dry_run=true`; !strings.Contains(logs.String(), expected) {
+		t.Errorf("expected %s in the logs:\n%s", expected, logs.String())
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_ArgValidator(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	var executed bool
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		executed = true
+		return args.Input, nil
+	}, WithName("echo"), WithArgValidator(func(args SimpleArgs) error {
+		if args.Input == "" {
+			return errors.New("input must not be empty")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "echo",
+			Arguments: wire.Optional[string]{Value: `{"input":""}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if executed {
+		t.Error("expected tool body not to run for rejected arguments")
+	}
+	toolResult, ok := result.(*wire.ToolResult)
+	if !ok {
+		t.Fatalf("expected *wire.ToolResult, got %T", result)
+	}
+	if !toolResult.ReturnValue.IsError {
+		t.Errorf("expected an error result, got %+v", toolResult)
+	}
+	if output := toolResult.ReturnValue.Output.Text.Value; output != "input must not be empty" {
+		t.Errorf("expected the validation message, got %q", output)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_ToolResultInterceptor(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return "token=sk-secret-123 for " + args.Input, nil
+	}, WithName("login"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var opt option
+	WithToolResultInterceptor(func(name string, result *wire.ToolResultReturnValue) error {
+		if strings.Contains(result.Output.Text.Value, "reject") {
+			return errors.New("result withheld")
+		}
+		result.Output = wire.NewStringContent(strings.ReplaceAll(result.Output.Text.Value, "sk-secret-123", "[REDACTED]"))
+		return nil
+	})(&opt)
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+		interceptToolResult:     opt.toolResultInterceptor,
+	}
+	call := func(input string) *wire.ToolResult {
+		t.Helper()
+		result, err := responder.Request(&wire.RequestParams{
+			Type: wire.RequestTypeToolCallRequest,
+			Payload: wire.ToolCallRequest{
+				ID:        "call-1",
+				Name:      "login",
+				Arguments: wire.Optional[string]{Value: `{"input":"` + input + `"}`, Valid: true},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		return result.(*wire.ToolResult)
+	}
+
+	toolResult := call("alice")
+	if toolResult.ReturnValue.IsError {
+		t.Errorf("expected a successful result, got %+v", toolResult)
+	}
+	if output := toolResult.ReturnValue.Output.Text.Value; output != "token=[REDACTED] for alice" {
+		t.Errorf("expected the redacted output to be sent, got %q", output)
+	}
+
+	toolResult = call("reject")
+	if !toolResult.ReturnValue.IsError {
+		t.Errorf("expected an error result, got %+v", toolResult)
+	}
+	if output := toolResult.ReturnValue.Output.Text.Value; output != "result withheld" {
+		t.Errorf("expected the interceptor's error to be sent, got %q", output)
+	}
+}
+
+func TestSession_DryRunInvocations_Disabled(t *testing.T) {
+	session := &Session{}
+	if invocations := session.DryRunInvocations(); invocations != nil {
+		t.Errorf("expected nil invocations, got %v", invocations)
+	}
+}
+
+func TestSession_SetGet(t *testing.T) {
+	session := &Session{}
+
+	if _, ok := session.Get("user_id"); ok {
+		t.Fatal("expected missing key to report ok=false")
+	}
+
+	session.Set("user_id", 42)
+	session.Set("title", "weekly sync")
+
+	if v, ok := session.Get("user_id"); !ok || v != 42 {
+		t.Errorf("expected user_id=42, got %v (ok=%v)", v, ok)
+	}
+	if v, ok := session.Get("title"); !ok || v != "weekly sync" {
+		t.Errorf("expected title='weekly sync', got %v (ok=%v)", v, ok)
+	}
+
+	session.Set("title", "renamed")
+	if v, _ := session.Get("title"); v != "renamed" {
+		t.Errorf("expected title to be overwritten, got %v", v)
+	}
+}
+
+func TestSession_SetGet_Concurrent(t *testing.T) {
+	session := &Session{}
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Go(func() {
+			key := strconv.Itoa(i % 5)
+			session.Set(key, i)
+			if _, ok := session.Get(key); !ok {
+				t.Errorf("expected key %s to be present", key)
+			}
+		})
+	}
+	wg.Wait()
+
+	for i := range 5 {
+		if _, ok := session.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("expected key %d to be present", i)
+		}
+	}
+}
+
+func TestCheckWritableDir(t *testing.T) {
+	if err := checkWritableDir(t.TempDir()); err != nil {
+		t.Fatalf("expected temp dir to be writable, got %v", err)
+	}
+}
+
+func TestCheckWritableDir_ReadOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permission bits are not enforced for root")
+	}
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0o555); err != nil {
+		t.Fatalf("Chmod: %v", err)
+	}
+	defer os.Chmod(dir, 0o755) //nolint:errcheck
+
+	err := checkWritableDir(dir)
+	if !errors.Is(err, ErrWorkDirNotWritable) {
+		t.Fatalf("expected ErrWorkDirNotWritable, got %v", err)
+	}
+}
+
+func TestNewSession_RequireWritableWorkDir(t *testing.T) {
+	// A regular file cannot hold the probe file, regardless of privileges.
+	file := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	_, err := NewSession(
+		WithExecutable(filepath.Join(t.TempDir(), "kimi-does-not-exist")),
+		WithWorkDir(file),
+		WithRequireWritableWorkDir(),
+	)
+	if !errors.Is(err, ErrWorkDirNotWritable) {
+		t.Fatalf("expected ErrWorkDirNotWritable, got %v", err)
+	}
+}
+
+func TestNewSession_WithBinaryPath(t *testing.T) {
+	dir := t.TempDir()
+	notExecutable := filepath.Join(dir, "kimi-not-executable")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	for name, path := range map[string]string{
+		"missing":        filepath.Join(dir, "kimi-does-not-exist"),
+		"directory":      dir,
+		"not executable": notExecutable,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSession(WithBinaryPath(path))
+			if !errors.Is(err, ErrBinaryNotFound) {
+				t.Fatalf("expected ErrBinaryNotFound, got %v", err)
+			}
+			if !strings.Contains(err.Error(), path) {
+				t.Errorf("expected the error to mention %s, got %v", path, err)
+			}
+		})
+	}
+}
+
+func TestResolveBinaryPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "kimi"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	t.Chdir(dir)
+
+	path, err := resolveBinaryPath("kimi")
+	if err != nil {
+		t.Fatalf("resolveBinaryPath: %v", err)
+	}
+	if expected := filepath.Join(dir, "kimi"); path != expected {
+		t.Errorf("expected %s, got %s", expected, path)
+	}
+}
+
+func TestNewSession_RequiredToolMissing(t *testing.T) {
+	tool, err := CreateTool(Search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	_, err = NewSession(
+		WithExecutable(filepath.Join(t.TempDir(), "kimi-does-not-exist")),
+		WithTools(tool),
+		WithRequiredTools("search", "report_verification_result"),
+	)
+	if !errors.Is(err, ErrRequiredToolMissing) {
+		t.Fatalf("expected ErrRequiredToolMissing, got %v", err)
+	}
+	if want := "required tool is not registered: report_verification_result"; err.Error() != want {
+		t.Errorf("expected error %q, got %q", want, err.Error())
+	}
+}
+
+func TestNewSession_ApprovalAndInteractionHandlers(t *testing.T) {
+	_, err := NewSession(
+		WithExecutable(filepath.Join(t.TempDir(), "kimi-does-not-exist")),
+		WithApprovalHandler(func(context.Context, wire.ApprovalRequest) wire.ApprovalRequestResponse {
+			return wire.ApprovalRequestResponseApprove
+		}),
+		WithInteractionHandler(&recordingInteractionHandler{}),
+	)
+	if err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Fatalf("expected an error for both handlers, got %v", err)
+	}
+}
+
+func TestCheckRequiredTools(t *testing.T) {
+	tool, err := CreateTool(Search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if err := checkRequiredTools([]string{"search"}, []Tool{tool}); err != nil {
+		t.Errorf("expected registered tool to satisfy the requirement, got %v", err)
+	}
+	if err := checkRequiredTools(nil, nil); err != nil {
+		t.Errorf("expected no requirement to pass, got %v", err)
+	}
+}
+
+func TestSession_Prompt_AfterClose(t *testing.T) {
+	session := &Session{}
+	session.closed.Store(true)
+
+	_, err := session.Prompt(context.Background(), wire.NewStringContent("hello"))
+	if !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatalf("expected Close on a closed session to be a no-op, got %v", err)
+	}
+}
+
+type slowUpload struct {
+	*io.PipeReader
+	written atomic.Int64
+}
+
+func (u *slowUpload) Write(p []byte) (int, error) {
+	time.Sleep(10 * time.Millisecond)
+	u.written.Add(int64(len(p)))
+	return len(p), nil
+}
+
+func TestSession_Prompt_CancelInterruptsUpload(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	upload := &slowUpload{PipeReader: pr}
+	codec := jsonrpc2.NewCodec(upload, jsonrpc2.ShutdownTimeout(100*time.Millisecond))
+	defer codec.Close()
+	session := &Session{
+		ctx:   context.Background(),
+		codec: codec,
+		tp:    transport.NewTransportClient(rpc.NewClientWithCodec(codec)),
+	}
+
+	const size = 4 << 20 // takes over a second to write at this pace
+	image := "data:image/png;base64," + strings.Repeat("A", size)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan time.Time, 1)
+	go func() {
+		for upload.written.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancelled <- time.Now()
+		cancel()
+	}()
+
+	_, err := session.Prompt(ctx, wire.NewContent(wire.NewImageContentPart(image)))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(<-cancelled); elapsed > 500*time.Millisecond {
+		t.Errorf("expected Prompt to return promptly after cancellation, took %s", elapsed)
+	}
+	if written := upload.written.Load(); written >= size {
+		t.Errorf("expected the upload to stop, but %d bytes were written", written)
+	}
+}
+
+func TestSession_Prompt_CancelKeepsOtherUpload(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	upload := &slowUpload{PipeReader: pr}
+	codec := jsonrpc2.NewCodec(upload, jsonrpc2.ShutdownTimeout(100*time.Millisecond))
+	defer codec.Close()
+	// The other request is never answered; ending the session stops waiting for it.
+	sessionCtx, endSession := context.WithCancel(context.Background())
+	defer endSession()
+	session := &Session{
+		ctx:   sessionCtx,
+		codec: codec,
+		tp:    transport.NewTransportClient(rpc.NewClientWithCodec(codec)),
+	}
+
+	// Another request is uploading when the prompt is cancelled.
+	const size = 1 << 20
+	image := "data:image/png;base64," + strings.Repeat("A", size)
+	go session.tp.Prompt(&wire.PromptParams{UserInput: wire.NewContent(wire.NewImageContentPart(image))})
+	for upload.written.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := session.Prompt(ctx, wire.NewStringContent("hello"))
+		done <- err
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for upload.written.Load() < size {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the other upload to complete, but %d bytes were written", upload.written.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	endSession()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for Prompt to return")
+	}
+}
+
+func TestSession_Kill_ClosesCodec(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	upload := &slowUpload{PipeReader: pr}
+	codec := jsonrpc2.NewCodec(upload, jsonrpc2.ShutdownTimeout(100*time.Millisecond))
+	session := &Session{
+		ctx:   context.Background(),
+		cmd:   &exec.Cmd{},
+		codec: codec,
+		tp:    transport.NewTransportClient(rpc.NewClientWithCodec(codec)),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := session.tp.Cancel(&wire.CancelParams{})
+		done <- err
+	}()
+	for upload.written.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := session.Kill(); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected the call in flight to fail")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the call in flight to return once the session was killed")
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_Namespaced(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	newTool := func(result string) Tool {
+		tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+			return result, nil
+		}, WithName("search"))
+		if err != nil {
+			t.Fatalf("CreateTool: %v", err)
+		}
+		return tool
+	}
+	opt := &option{}
+	WithToolNamespace("local", newTool("from local"))(opt)
+	WithToolNamespace("proxy", newTool("from proxy"))(opt)
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   opt.tools,
+	}
+
+	call := func(name string) (wire.RequestResult, error) {
+		return responder.Request(&wire.RequestParams{
+			Type: wire.RequestTypeToolCallRequest,
+			Payload: wire.ToolCallRequest{
+				ID:        "call-1",
+				Name:      name,
+				Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+			},
+		})
+	}
+
+	for name, expected := range map[string]string{"local.search": "from local", "proxy.search": "from proxy"} {
+		result, err := call(name)
+		if err != nil {
+			t.Fatalf("Request(%s): %v", name, err)
+		}
+		if got := result.(*wire.ToolResult).ReturnValue.Output.Text.Value; got != expected {
+			t.Errorf("Request(%s): expected output %q, got %q", name, expected, got)
+		}
+	}
+
+	if _, err := call("search"); err == nil {
+		t.Error("expected un-namespaced name not to be dispatched")
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_NilMapResult(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateTool(func(args SimpleArgs) (map[string]int, error) {
+		return nil, nil
+	}, WithName("counts"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "counts",
+			Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if got := result.(*wire.ToolResult).ReturnValue.Output.Text.Value; got != "{}" {
+		t.Errorf("expected output {}, got %q", got)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_ContentResult(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	content := wire.NewContent(
+		wire.NewTextContentPart("Rendered chart:"),
+		wire.NewImageContentPart("data:image/png;base64,iVBORw0KGgo="),
+	)
+	tool, err := CreateTool(func(args SimpleArgs) (wire.Content, error) {
+		return content, nil
+	}, WithName("chart"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "chart",
+			Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if output := result.(*wire.ToolResult).ReturnValue.Output; !reflect.DeepEqual(output, content) {
+		t.Errorf("expected the content to be returned as is, got %+v", output)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_Panic(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		if args.Input == "boom" {
+			var counts map[string]int
+			counts[args.Input]++
+		}
+		return "ok", nil
+	}, WithName("fragile"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+	}
+	call := func(input string) wire.ToolResultReturnValue {
+		t.Helper()
+		result, err := responder.Request(&wire.RequestParams{
+			Type: wire.RequestTypeToolCallRequest,
+			Payload: wire.ToolCallRequest{
+				ID:        "call-" + input,
+				Name:      "fragile",
+				Arguments: wire.Optional[string]{Value: `{"input":"` + input + `"}`, Valid: true},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		return result.(*wire.ToolResult).ReturnValue
+	}
+
+	returnValue := call("boom")
+	if output := returnValue.Output.Text.Value; !returnValue.IsError ||
+		!strings.Contains(output, "assignment to entry in nil map") || !strings.Contains(output, "goroutine") {
+		t.Errorf("expected the panic to be reported as a tool error with a stack trace, got %+v", returnValue)
+	}
+	if returnValue := call("fine"); returnValue.IsError || returnValue.Output.Text.Value != "ok" {
+		t.Errorf("expected the responder to keep serving tool calls, got %+v", returnValue)
+	}
+	if pending := responder.pending.Load(); pending != 0 {
+		t.Errorf("expected no pending requests after the panic, got %d", pending)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_Context(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateToolContext(func(ctx context.Context, args SimpleArgs) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, WithName("slow"))
+	if err != nil {
+		t.Fatalf("CreateToolContext: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		roundtripContext:        &ctx,
+		tools:                   []Tool{tool},
+	}
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	result, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "slow",
+			Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	returnValue := result.(*wire.ToolResult).ReturnValue
+	if !returnValue.IsError || returnValue.Output.Text.Value != context.Canceled.Error() {
+		t.Errorf("expected the cancelled prompt to cancel the tool, got %+v", returnValue)
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_Concurrent(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	const n = 100
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		i, _ := strconv.Atoi(args.Input)
+		// Later calls finish first.
+		time.Sleep(time.Duration(n-i) * 100 * time.Microsecond)
+		return "result-" + args.Input, nil
+	}, WithName("slow"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*wire.ToolResult, n)
+	for i := range n {
+		wg.Go(func() {
+			result, err := responder.Request(&wire.RequestParams{
+				Type: wire.RequestTypeToolCallRequest,
+				Payload: wire.ToolCallRequest{
+					ID:        fmt.Sprintf("call-%d", i),
+					Name:      "slow",
+					Arguments: wire.Optional[string]{Value: fmt.Sprintf(`{"input":"%d"}`, i), Valid: true},
+				},
+			})
+			if err != nil {
+				t.Errorf("Request %d: %v", i, err)
+				return
+			}
+			results[i] = result.(*wire.ToolResult)
+		})
+	}
+	wg.Wait()
+
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if id := fmt.Sprintf("call-%d", i); result.ToolCallID != id {
+			t.Errorf("result %d: expected tool call ID %s, got %s", i, id, result.ToolCallID)
+		}
+		if output := result.ReturnValue.Output.Text.Value; output != fmt.Sprintf("result-%d", i) {
+			t.Errorf("result %d: expected output result-%d, got %s", i, i, output)
+		}
+	}
+}
+
+func TestResponder_Request_ToolCallRequest_WriteConflict(t *testing.T) {
+	type WriteArgs struct {
+		Path string `json:"path"`
+		Text string `json:"text"`
+	}
+	// appendSlowly appends text to the file one byte at a time, so that
+	// concurrent writes to the same file would interleave.
+	appendSlowly := func(args WriteArgs) (string, error) {
+		f, err := os.OpenFile(args.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		for i := range len(args.Text) {
+			if _, err := f.WriteString(args.Text[i : i+1]); err != nil {
+				return "", err
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return "ok", nil
+	}
+	writeTool, err := CreateTool(appendSlowly, WithName("write_file"), WithFileWrite("path"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	appendTool, err := CreateTool(appendSlowly, WithName("append_file"), WithFileWrite("path"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	run := func(t *testing.T, policy WriteConflictPolicy, path string) []*wire.ToolResult {
+		msgs := make(chan wire.Message, 1)
+		usrc := make(chan wire.RequestResponse, 1)
+		var rwlock sync.RWMutex
+		responder := &Responder{
+			rwlock:                  &rwlock,
+			pending:                 new(atomic.Int64),
+			wireMessageBridge:       &msgs,
+			wireRequestResponseChan: &usrc,
+			tools:                   []Tool{writeTool, appendTool},
+			writes:                  newWriteLocks(policy),
+		}
+		var wg sync.WaitGroup
+		results := make([]*wire.ToolResult, 2)
+		for i, call := range []struct{ name, text string }{{"write_file", "aaaaa"}, {"append_file", "bbbbb"}} {
+			wg.Go(func() {
+				result, err := responder.Request(&wire.RequestParams{
+					Type: wire.RequestTypeToolCallRequest,
+					Payload: wire.ToolCallRequest{
+						ID:        fmt.Sprintf("call-%d", i),
+						Name:      call.name,
+						Arguments: wire.Optional[string]{Value: fmt.Sprintf(`{"path":%q,"text":%q}`, path, call.text), Valid: true},
+					},
+				})
+				if err != nil {
+					t.Errorf("Request %d: %v", i, err)
+					return
+				}
+				results[i] = result.(*wire.ToolResult)
+			})
+		}
+		wg.Wait()
+		return results
+	}
+
+	t.Run("serialize", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		for _, result := range run(t, WriteConflictSerialize, path) {
+			if result == nil || result.ReturnValue.IsError {
+				t.Fatalf("expected both calls to succeed, got %+v", result)
+			}
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != "aaaaabbbbb" && got != "bbbbbaaaaa" {
+			t.Errorf("expected the writes to be serialized, got %q", got)
+		}
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out.txt")
+		results := run(t, WriteConflictReject, path)
+		var failed []string
+		for _, result := range results {
+			if result != nil && result.ReturnValue.IsError {
+				failed = append(failed, result.ReturnValue.Output.Text.Value)
+			}
+		}
+		if len(failed) != 1 || !strings.Contains(failed[0], "write conflict") {
+			t.Fatalf("expected one call to fail with a write conflict, got %q", failed)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != "aaaaa" && got != "bbbbb" {
+			t.Errorf("expected only the first write, got %q", got)
+		}
+	})
+
+	t.Run("different paths", func(t *testing.T) {
+		dir := t.TempDir()
+		writes := newWriteLocks(WriteConflictReject)
+		release, err := writes.acquire(filepath.Join(dir, "a.txt"))
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		defer release()
+		if _, err := writes.acquire(filepath.Join(dir, "b.txt")); err != nil {
+			t.Errorf("expected writes to another file to proceed, got %v", err)
+		}
+		path, ok := writeTool.writePath(json.RawMessage(fmt.Sprintf(`{"path":%q}`, dir+"/x/../a.txt")))
+		if !ok {
+			t.Fatal("expected the path to be found in the arguments")
+		}
+		if _, err := writes.acquire(path); !errors.Is(err, ErrWriteConflict) {
+			t.Errorf("expected a conflict for the same file, got %v", err)
+		}
+	})
+}
+
+func TestResponder_Request_BeforeInitialized(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return "done", nil
+	}, WithName("early"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	ready := make(chan struct{})
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+		ready:                   ready,
+	}
+
+	call := func() (wire.RequestResult, error) {
+		return responder.Request(&wire.RequestParams{
+			Type: wire.RequestTypeToolCallRequest,
+			Payload: wire.ToolCallRequest{
+				ID:        "call-1",
+				Name:      "early",
+				Arguments: wire.Optional[string]{Value: `{"input":"x"}`, Valid: true},
+			},
+		})
+	}
+
+	_, err = call()
+	var rpcErr jsonrpc2.Error
+	if !errors.As(err, &rpcErr) || rpcErr.Message != "session is not initialized yet" {
+		t.Fatalf("expected not-initialized error, got %v", err)
+	}
+
+	close(ready)
+	result, err := call()
+	if err != nil {
+		t.Fatalf("Request after initialization: %v", err)
+	}
+	if got := result.(*wire.ToolResult).ReturnValue.Output.Text.Value; got != "done" {
+		t.Errorf("expected output done, got %q", got)
+	}
+}
+
+type recordingInteractionHandler struct {
+	approvals []wire.ApprovalRequest
+	questions []string
+	contexts  []context.Context
+}
+
+func (h *recordingInteractionHandler) Approve(ctx context.Context, req wire.ApprovalRequest) wire.ApprovalRequestResponse {
+	h.contexts = append(h.contexts, ctx)
+	h.approvals = append(h.approvals, req)
+	return wire.ApprovalRequestResponseApproveForSession
+}
+
+func (h *recordingInteractionHandler) UserInput(ctx context.Context, question string) (string, error) {
+	h.contexts = append(h.contexts, ctx)
+	h.questions = append(h.questions, question)
+	return "blue", nil
+}
+
+func TestResponder_Logger(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	handler := &recordingInteractionHandler{}
+	tool, err := newUserInputTool(handler)
+	if err != nil {
+		t.Fatalf("newUserInputTool: %v", err)
+	}
+	var logs strings.Builder
+	var rwlock sync.RWMutex
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		tools:                   []Tool{tool},
+		interaction:             handler,
+		logger:                  slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	if _, err := responder.Event(&wire.EventParams{Type: wire.EventTypeStepBegin, Payload: wire.StepBegin{N: 1}}); err != nil {
+		t.Fatalf("Event: %v", err)
+	}
+	<-msgs
+	if _, err := responder.Request(&wire.RequestParams{
+		Type:    wire.RequestTypeApprovalRequest,
+		Payload: wire.ApprovalRequest{ID: "req-1", ToolCallID: "call-0", Action: "run command"},
+	}); err != nil {
+		t.Fatalf("Request(approval): %v", err)
+	}
+	if _, err := responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      UserInputToolName,
+			Arguments: wire.Optional[string]{Value: `{"question":"Which color?"}`, Valid: true},
+		},
+	}); err != nil {
+		t.Fatalf("Request(user input): %v", err)
+	}
+
+	for _, expected := range []string{
+		`msg="event received" type=StepBegin`,
+		`msg="approval requested" approval_id=req-1 tool_call_id=call-0`,
+		`msg="approval resolved" approval_id=req-1 decision=approve_for_session source=interaction_handler`,
+		`msg="tool called" tool=` + UserInputToolName + ` tool_call_id=call-1`,
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("expected %s in the logs:\n%s", expected, logs.String())
+		}
+	}
+}
+
+func TestResponder_Request_InteractionHandler(t *testing.T) {
+	msgs := make(chan wire.Message, 1)
+	usrc := make(chan wire.RequestResponse, 1)
+
+	handler := &recordingInteractionHandler{}
+	tool, err := newUserInputTool(handler)
+	if err != nil {
+		t.Fatalf("newUserInputTool: %v", err)
+	}
+	var sources []string
+	var rwlock sync.RWMutex
+	ctx := context.WithValue(context.Background(), contextKey{}, "turn")
+	responder := &Responder{
+		rwlock:                  &rwlock,
+		pending:                 new(atomic.Int64),
+		wireMessageBridge:       &msgs,
+		wireRequestResponseChan: &usrc,
+		roundtripContext:        &ctx,
+		tools:                   []Tool{tool},
+		interaction:             handler,
+		observers: []ApprovalObserver{func(_ wire.ApprovalRequest, _ wire.ApprovalRequestResponse, source string) {
+			sources = append(sources, source)
+		}},
+	}
+
+	result, err := responder.Request(&wire.RequestParams{
+		Type:    wire.RequestTypeApprovalRequest,
+		Payload: wire.ApprovalRequest{ID: "req-1", Action: "run command"},
+	})
+	if err != nil {
+		t.Fatalf("Request(approval): %v", err)
+	}
+	if resp := result.(*wire.ApprovalResponse); resp.RequestID != "req-1" || resp.Response != wire.ApprovalRequestResponseApproveForSession {
+		t.Errorf("unexpected approval response: %+v", resp)
+	}
+	if len(msgs) != 0 {
+		t.Error("expected approval request not to be forwarded to the message stream")
+	}
+
+	result, err = responder.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      UserInputToolName,
+			Arguments: wire.Optional[string]{Value: `{"question":"Which color?"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Request(user input): %v", err)
+	}
+	if got := result.(*wire.ToolResult).ReturnValue.Output.Text.Value; got != "blue" {
+		t.Errorf("expected user input answer %q, got %q", "blue", got)
+	}
+
+	if len(handler.approvals) != 1 || handler.approvals[0].ID != "req-1" {
+		t.Errorf("unexpected approvals routed to handler: %+v", handler.approvals)
+	}
+	for _, got := range handler.contexts {
+		if got.Value(contextKey{}) != "turn" {
+			t.Error("expected the handler to receive the context of the turn")
+		}
+	}
+	if len(handler.contexts) != 2 {
+		t.Errorf("expected the handler to be called twice, got %d calls", len(handler.contexts))
+	}
+	if !reflect.DeepEqual(handler.questions, []string{"Which color?"}) {
+		t.Errorf("unexpected questions routed to handler: %v", handler.questions)
+	}
+	if !reflect.DeepEqual(sources, []string{ApprovalSourceInteractionHandler}) {
+		t.Errorf("unexpected approval sources: %v", sources)
+	}
+}
+
+func newInitializingSession(t *testing.T, version string, initialize func(*wire.InitializeParams) (*wire.InitializeResult, error)) *Session {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	mockTP := transport.NewMockTransport(ctrl)
+	mockTP.EXPECT().Initialize(gomock.Any()).DoAndReturn(initialize).AnyTimes()
+	return &Session{tp: mockTP, wireProtocolVersion: version, ready: make(chan struct{})}
+}
+
+func TestSession_Ready_InitializeError(t *testing.T) {
+	initErr := errors.New("initialize failed")
+	session := newInitializingSession(t, "1.2", func(*wire.InitializeParams) (*wire.InitializeResult, error) {
+		return nil, initErr
+	})
+
+	go session.initialize(nil) //nolint:errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := session.Ready(ctx); !errors.Is(err, initErr) {
+		t.Fatalf("expected initialization error, got %v", err)
+	}
+}
+
+func TestSession_Ready_RejectedTool(t *testing.T) {
+	session := newInitializingSession(t, "1.2", func(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+		return &wire.InitializeResult{
+			ExternalTools: wire.Optional[wire.ExternalToolsResult]{Valid: true, Value: wire.ExternalToolsResult{
+				Rejected: []wire.RejectedExternalTool{{Name: params.ExternalTools[0].Name, Reason: "conflicts with builtin tool"}},
+			}},
+		}, nil
+	})
+	tool, err := CreateTool(Search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	if err := session.initialize([]Tool{tool}); err == nil {
+		t.Fatal("expected initialize to fail")
+	}
+	err = session.Ready(context.Background())
+	if err == nil || !strings.Contains(err.Error(), `"search" tool is rejected`) {
+		t.Fatalf("expected rejected tool error, got %v", err)
+	}
+}
+
+func TestSession_Ready_Success(t *testing.T) {
+	session := newInitializingSession(t, "1.2", func(*wire.InitializeParams) (*wire.InitializeResult, error) {
+		return &wire.InitializeResult{SlashCommands: []wire.SlashCommand{{Name: "help"}}}, nil
+	})
+
+	if err := session.initialize(nil); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	if err := session.Ready(context.Background()); err != nil {
+		t.Fatalf("expected Ready to succeed, got %v", err)
+	}
+	if len(session.SlashCommands) != 1 {
+		t.Errorf("expected slash commands to be populated, got %v", session.SlashCommands)
+	}
+}
+
+func TestSession_Tools(t *testing.T) {
+	var advertised []wire.ExternalTool
+	session := newInitializingSession(t, "1.2", func(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+		advertised = params.ExternalTools
+		return &wire.InitializeResult{}, nil
+	})
+	search, err := CreateTool(Search, WithName("search"), WithDescription("Search the web"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	lookup, err := CreateToolFromSchema("lookup", "Look up a ticket", json.RawMessage(`{"type":"object"}`), func(json.RawMessage) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	if err := session.initialize([]Tool{search, lookup}); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	tools := session.Tools()
+	if !reflect.DeepEqual(tools, advertised) {
+		t.Errorf("expected the advertised tools %+v, got %+v", advertised, tools)
+	}
+	if len(tools) != 2 || tools[0].Name != "search" || tools[0].Description != "Search the web" || tools[1].Name != "lookup" {
+		t.Fatalf("unexpected tools: %+v", tools)
+	}
+	if !reflect.DeepEqual(tools[0], search.Definition()) {
+		t.Errorf("expected %+v, got %+v", search.Definition(), tools[0])
+	}
+
+	tools[1].Parameters[0] = '['
+	if got := string(session.Tools()[1].Parameters); got != `{"type":"object"}` {
+		t.Errorf("expected the session's tools not to be modifiable, got %s", got)
+	}
+}
+
+// newToolSession returns an initialized session with a responder dispatching
+// calls to tools, whose initialize exchanges are answered by initialize.
+func newToolSession(t *testing.T, initialize func(*wire.InitializeParams) (*wire.InitializeResult, error), tools ...Tool) *Session {
+	t.Helper()
+	session := newInitializingSession(t, "1.2", initialize)
+	session.wireMessageBridge = make(chan wire.Message, 1)
+	session.wireRequestResponseChan = make(chan wire.RequestResponse, 1)
+	session.responder = &Responder{
+		rwlock:                  &session.rwlock,
+		pending:                 &session.pending,
+		wireMessageBridge:       &session.wireMessageBridge,
+		wireRequestResponseChan: &session.wireRequestResponseChan,
+		tools:                   tools,
+	}
+	if err := session.initialize(tools); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	return session
+}
+
+func toolNames(defs []wire.ExternalTool) []string {
+	var names []string
+	for _, def := range defs {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+func TestSession_AddTool_RemoveTool(t *testing.T) {
+	var advertised [][]string
+	session := newToolSession(t, func(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+		advertised = append(advertised, toolNames(params.ExternalTools))
+		return &wire.InitializeResult{}, nil
+	})
+	echo := func(args SimpleArgs) (string, error) { return args.Input, nil }
+	search, err := CreateTool(echo, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	plugin, err := CreateTool(echo, WithName("plugin"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	call := func(name string) (wire.RequestResult, error) {
+		return session.responder.Request(&wire.RequestParams{
+			Type: wire.RequestTypeToolCallRequest,
+			Payload: wire.ToolCallRequest{
+				ID:        "call-1",
+				Name:      name,
+				Arguments: wire.Optional[string]{Value: `{"input":"hi"}`, Valid: true},
+			},
+		})
+	}
+
+	if err := session.AddTool(&search); err != nil {
+		t.Fatalf("AddTool: %v", err)
+	}
+	if err := session.AddTool(&plugin); err != nil {
+		t.Fatalf("AddTool: %v", err)
+	}
+	if err := session.AddTool(&plugin); err == nil || !strings.Contains(err.Error(), "already registered") {
+		t.Errorf("expected a duplicate tool to be refused, got %v", err)
+	}
+	if result, err := call("plugin"); err != nil || result.(*wire.ToolResult).ReturnValue.Output.Text.Value != "hi" {
+		t.Errorf("expected the added tool to be called, got %+v, %v", result, err)
+	}
+
+	if err := session.RemoveTool("search"); err != nil {
+		t.Fatalf("RemoveTool: %v", err)
+	}
+	if err := session.RemoveTool("search"); err == nil || !strings.Contains(err.Error(), "not registered") {
+		t.Errorf("expected removing an unknown tool to fail, got %v", err)
+	}
+	if _, err := call("search"); err == nil || !strings.Contains(err.Error(), "tool not found") {
+		t.Errorf("expected the removed tool not to be found, got %v", err)
+	}
+
+	expected := [][]string{nil, {"search"}, {"search", "plugin"}, {"plugin"}}
+	if !reflect.DeepEqual(advertised, expected) {
+		t.Errorf("expected the tool sets %q to be advertised, got %q", expected, advertised)
+	}
+	if names := toolNames(session.Tools()); !slices.Equal(names, []string{"plugin"}) {
+		t.Errorf("expected the session's tools to be updated, got %q", names)
+	}
+}
+
+func TestSession_AddTool_Rejected(t *testing.T) {
+	session := newToolSession(t, func(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+		var result wire.InitializeResult
+		for _, tool := range params.ExternalTools {
+			if tool.Name == "bash" {
+				result.ExternalTools = wire.Optional[wire.ExternalToolsResult]{Valid: true, Value: wire.ExternalToolsResult{
+					Rejected: []wire.RejectedExternalTool{{Name: tool.Name, Reason: "conflicts with builtin tool"}},
+				}}
+			}
+		}
+		return &result, nil
+	})
+	bash, err := CreateTool(func(args SimpleArgs) (string, error) { return "", nil }, WithName("bash"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	err = session.AddTool(&bash)
+	var rejected *ToolRejectedError
+	if !errors.As(err, &rejected) || rejected.Rejected[0].Reason != "conflicts with builtin tool" {
+		t.Fatalf("expected a ToolRejectedError, got %v", err)
+	}
+	if len(session.Tools()) != 0 || len(session.responder.tools) != 0 {
+		t.Errorf("expected the rejected tool not to be registered, got %+v", session.Tools())
+	}
+}
+
+func TestSession_AddTool_TurnInFlight(t *testing.T) {
+	session := newToolSession(t, func(*wire.InitializeParams) (*wire.InitializeResult, error) {
+		return &wire.InitializeResult{}, nil
+	})
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) { return "", nil }, WithName("plugin"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	session.cancellers = append(session.cancellers, &Turn{})
+
+	if err := session.AddTool(&tool); !errors.Is(err, ErrTurnInFlight) {
+		t.Errorf("expected ErrTurnInFlight, got %v", err)
+	}
+	if err := session.RemoveTool("plugin"); !errors.Is(err, ErrTurnInFlight) {
+		t.Errorf("expected ErrTurnInFlight, got %v", err)
+	}
+}
+
+func TestSession_Ready_ContextDone(t *testing.T) {
+	session := &Session{ready: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := session.Ready(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
 func TestResponderFunc(t *testing.T) {
 	var called bool
 	var receivedResponse wire.RequestResponse
@@ -0,0 +1,151 @@
+package kimi
+
+import (
+	"sync"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// Sink receives a categorized view of a turn's events.
+// Each sink added to a turn runs on its own goroutine and queues the events it
+// has yet to handle, so a slow sink holds back neither the turn nor the other
+// sinks; callbacks on a single sink are invoked sequentially.
+type Sink interface {
+	OnText(text string)
+	OnThink(think string)
+	OnToolCall(call wire.ToolCall)
+	OnToolResult(result wire.ToolResult)
+}
+
+type sinkRunner struct {
+	sink Sink
+	wake chan struct{}
+	done chan struct{}
+
+	mu     sync.Mutex
+	queue  []wire.Event
+	closed bool
+}
+
+func newSinkRunner(sink Sink) *sinkRunner {
+	return &sinkRunner{
+		sink: sink,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// push queues event for the sink without waiting for it to be handled.
+func (r *sinkRunner) push(event wire.Event) {
+	r.mu.Lock()
+	if !r.closed {
+		r.queue = append(r.queue, event)
+	}
+	r.mu.Unlock()
+	r.signal()
+}
+
+// close lets the sink handle the events already queued, then ends it.
+func (r *sinkRunner) close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+	r.signal()
+}
+
+func (r *sinkRunner) signal() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *sinkRunner) run() {
+	defer close(r.done)
+	for range r.wake {
+		r.mu.Lock()
+		events, closed := r.queue, r.closed
+		r.queue = nil
+		r.mu.Unlock()
+		for _, event := range events {
+			r.handle(event)
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+func (r *sinkRunner) handle(event wire.Event) {
+	switch x := event.(type) {
+	case wire.ContentPart:
+		switch x.Type {
+		case wire.ContentPartTypeText:
+			r.sink.OnText(x.Text.Value)
+		case wire.ContentPartTypeThink:
+			r.sink.OnThink(x.Think.Value)
+		}
+	case wire.ToolCall:
+		r.sink.OnToolCall(x)
+	case wire.ToolResult:
+		r.sink.OnToolResult(x)
+	}
+}
+
+// AddSink registers a sink that receives the turn's text, thinking, tool calls and
+// tool results from the moment it is added. Sinks see events independently of
+// whether Steps is being consumed; the turn's messages must still be consumed for
+// the turn to make progress. By the time Steps is closed, every sink has received
+// all of its events, so a sink that blocks holds back the close of Steps. Sinks added after the turn has ended are never called.
+func (t *Turn) AddSink(sink Sink) {
+	t.sinklock.Lock()
+	defer t.sinklock.Unlock()
+	if t.sinksClosed {
+		return
+	}
+	runner := newSinkRunner(sink)
+	t.sinks = append(t.sinks, runner)
+	go runner.run()
+}
+
+// sinkTurn returns the turn whose sinks receive the events of t: the turn
+// first sent, which t retries, or t itself.
+func (t *Turn) sinkTurn() *Turn {
+	if t.sinkOwner != nil {
+		return t.sinkOwner
+	}
+	return t
+}
+
+func (t *Turn) dispatchToSinks(event wire.Event) {
+	switch event.(type) {
+	case wire.ContentPart, wire.ToolCall, wire.ToolResult:
+	default:
+		return
+	}
+	t = t.sinkTurn()
+	t.sinklock.Lock()
+	sinks := t.sinks
+	t.sinklock.Unlock()
+	for _, runner := range sinks {
+		runner.push(event)
+	}
+}
+
+// closeSinks ends the sinks of the turn once it has ended, after its retries if
+// any. A retry leaves them to the turn it retries.
+func (t *Turn) closeSinks() {
+	if t.sinkOwner != nil {
+		return
+	}
+	t.sinklock.Lock()
+	t.sinksClosed = true
+	sinks := t.sinks
+	t.sinklock.Unlock()
+	for _, runner := range sinks {
+		runner.close()
+	}
+	for _, runner := range sinks {
+		<-runner.done
+	}
+}
@@ -0,0 +1,185 @@
+package kimi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *recordingSink) record(event string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+// text joins the text the sink has received.
+func (s *recordingSink) text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	for _, event := range s.events {
+		if text, ok := strings.CutPrefix(event, "text:"); ok {
+			b.WriteString(text)
+		}
+	}
+	return b.String()
+}
+
+func (s *recordingSink) OnText(text string)                  { s.record("text:" + text) }
+func (s *recordingSink) OnThink(think string)                { s.record("think:" + think) }
+func (s *recordingSink) OnToolCall(call wire.ToolCall)       { s.record("call:" + call.Function.Name) }
+func (s *recordingSink) OnToolResult(result wire.ToolResult) { s.record("result:" + result.ToolCallID) }
+
+func TestTurn_AddSink_MultipleSinks(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	terminal, logfile := &recordingSink{}, &recordingSink{}
+	turn.AddSink(terminal)
+	turn.AddSink(logfile)
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "hmm", Valid: true}}
+	msgs <- wire.NewTextContentPart("Hello")
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}
+	msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: "{}", Valid: true}}
+	msgs <- wire.ToolResult{ToolCallID: "call-1"}
+	msgs <- wire.StatusUpdate{}
+	msgs <- wire.NewTextContentPart("Done")
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	expected := []string{"think:hmm", "text:Hello", "call:search", "result:call-1", "text:Done"}
+	for name, sink := range map[string]*recordingSink{"terminal": terminal, "logfile": logfile} {
+		sink.mu.Lock()
+		if !reflect.DeepEqual(sink.events, expected) {
+			t.Errorf("%s sink: expected %v, got %v", name, expected, sink.events)
+		}
+		sink.mu.Unlock()
+	}
+}
+
+func TestTurn_AddSink_AfterTurnEnded(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.TurnEnd{}
+
+	select {
+	case _, ok := <-turn.Steps:
+		if ok {
+			t.Fatal("expected Steps channel to be closed")
+		}
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for Steps channel to close")
+	}
+
+	late := &recordingSink{}
+	turn.AddSink(late)
+	if len(turn.sinks) != 0 {
+		t.Errorf("expected late sink to be ignored, got %d sinks", len(turn.sinks))
+	}
+}
+
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+}
+
+func (s *blockingSink) OnText(text string) {
+	<-s.release
+	s.record("text:" + text)
+}
+
+func TestTurn_AddSink_BlockedSink(t *testing.T) {
+	turn, _, msgs, cancel, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	blocked := &blockingSink{release: make(chan struct{})}
+	logfile := &recordingSink{}
+	turn.AddSink(blocked)
+	turn.AddSink(logfile)
+
+	const parts = 100
+	var want strings.Builder
+	for i := range parts {
+		want.WriteString(strconv.Itoa(i))
+	}
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		for i := range parts {
+			msgs <- wire.NewTextContentPart(strconv.Itoa(i))
+		}
+		msgs <- wire.TurnEnd{}
+		closeMsgs()
+	}()
+
+	step := <-turn.Steps
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range step.Messages {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("a blocked sink held back the turn")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logfile.text() != want.String() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the other sink to receive %q, got %q", want.String(), logfile.text())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-turn.Steps:
+		t.Fatal("expected Steps to stay open while a sink has events to handle")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(blocked.release)
+	select {
+	case _, ok := <-turn.Steps:
+		if ok {
+			t.Fatal("expected Steps channel to be closed")
+		}
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for Steps channel to close")
+	}
+	if got := blocked.text(); got != want.String() {
+		t.Errorf("expected the blocked sink to receive %q, got %q", want.String(), got)
+	}
+}
@@ -0,0 +1,32 @@
+package kimi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// writeSystemPromptAgent writes an agent file extending the CLI's default agent
+// with prompt as the additional role instruction of its system prompt, and
+// returns its path and a function removing it. See WithSystemPrompt.
+func writeSystemPromptAgent(prompt string) (path string, remove func(), err error) {
+	dir, err := os.MkdirTemp("", "kimi-agent-*")
+	if err != nil {
+		return "", nil, err
+	}
+	remove = func() { os.RemoveAll(dir) }
+	// A JSON string is a valid YAML double-quoted scalar.
+	quoted, err := json.Marshal(prompt)
+	if err != nil {
+		remove()
+		return "", nil, err
+	}
+	spec := fmt.Sprintf("version: 1\nagent:\n  extend: default\n  system_prompt_args:\n    ROLE_ADDITIONAL: %s\n", quoted)
+	path = filepath.Join(dir, "agent.yaml")
+	if err := os.WriteFile(path, []byte(spec), 0o600); err != nil {
+		remove()
+		return "", nil, err
+	}
+	return path, remove, nil
+}
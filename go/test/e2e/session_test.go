@@ -91,6 +91,37 @@ func TestE2E_ContextTimeout(t *testing.T) {
 	t.Logf("Request cancelled as expected: %v", err)
 }
 
+func TestE2E_WithMaxSteps(t *testing.T) {
+	skipIfNoAPIKey(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithAutoApprove(),
+		kimi.WithMaxSteps(1),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	defer cancel()
+
+	// Listing and then reading files takes more than one step.
+	turn, err := session.Prompt(ctx, wire.NewStringContent(
+		"List the files in the current directory, then read each of them and summarize their contents."))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	for step := range turn.Steps {
+		for range step.Messages {
+		}
+	}
+
+	if status := turn.Result().Status; status != wire.PromptResultStatusMaxStepsReached {
+		t.Errorf("expected status %s, got %s", wire.PromptResultStatusMaxStepsReached, status)
+	}
+}
+
 func TestE2E_RumorBuster(t *testing.T) {
 	skipIfNoAPIKey(t)
 
@@ -1,10 +1,17 @@
 package integration
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -191,6 +198,78 @@ func TestIntegration_Session_Close(t *testing.T) {
 	}
 }
 
+func TestIntegration_Session_Kill(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("hang"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("test"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+
+	if err := session.Kill(); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the turn to end once the subprocess was killed")
+	}
+	if turn.Err() == nil {
+		t.Error("expected the interrupted turn to report an error")
+	}
+
+	if _, err := session.Prompt(context.Background(), wire.NewStringContent("test")); !errors.Is(err, kimi.ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed, got %v", err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- session.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Close to return after Kill")
+	}
+	if err := session.Kill(); err != nil {
+		t.Errorf("expected Kill after Close to succeed, got %v", err)
+	}
+}
+
+func TestIntegration_NewSession_WithModel(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		kimi.WithModel("kimi-k2-thinking-turbo"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	session.Close()
+
+	_, err = kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		kimi.WithModel("no-such-model"),
+	)
+	if err == nil || !strings.Contains(err.Error(), `model "no-such-model" is not configured`) {
+		t.Fatalf("expected the CLI's error about the model, got %v", err)
+	}
+}
+
 // withMode returns an Option that adds --mode flag to the mock_kimi command
 func withMode(mode string) kimi.Option {
 	return kimi.WithArgs("--mode", mode)
@@ -494,6 +573,52 @@ func TestIntegration_WithTools_ExternalToolCall(t *testing.T) {
 	t.Log("Tool call completed successfully")
 }
 
+// TestIntegration_NewSession_EarlyToolCall tests that a tool call the server
+// sends before answering initialize is rejected with a clear error instead of
+// stalling NewSession.
+func TestIntegration_NewSession_EarlyToolCall(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	testTool, err := kimi.CreateTool(func(args testToolArgs) (testToolResult, error) {
+		return testToolResult("result"), nil
+	}, kimi.WithName("test_tool"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	type outcome struct {
+		session *kimi.Session
+		err     error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		session, err := kimi.NewSession(
+			kimi.WithExecutable(mockPath),
+			kimi.WithTools(testTool),
+			withMode("early_tool_call"),
+		)
+		done <- outcome{session, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewSession did not return while a tool call was pending during initialization")
+	}
+	if result.err != nil {
+		t.Fatalf("NewSession: %v", result.err)
+	}
+	defer result.session.Close()
+
+	if len(result.session.SlashCommands) != 1 {
+		t.Fatalf("expected the mock to report the tool call reply, got %+v", result.session.SlashCommands)
+	}
+	if got := result.session.SlashCommands[0].Description; got != "session is not initialized yet" {
+		t.Errorf("expected not-initialized error, got %q", got)
+	}
+}
+
 // TestIntegration_NewSession_ToolRejected tests that NewSession returns an error
 // when the server rejects external tools in the initialize response.
 func TestIntegration_NewSession_ToolRejected(t *testing.T) {
@@ -567,3 +692,511 @@ func TestIntegration_TurnEnd_ExplicitEnd(t *testing.T) {
 		t.Errorf("expected status finished, got %s", result.Status)
 	}
 }
+
+func TestIntegration_RetryOnUnexpectedEOF(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("unexpected_eof_once"),
+		kimi.WithRetryOnUnexpectedEOF(2),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("test input"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+
+	var texts []string
+	for step := range turn.Steps {
+		for msg := range step.Messages {
+			if part, ok := msg.(wire.ContentPart); ok {
+				texts = append(texts, part.Text.Value)
+			}
+		}
+	}
+
+	if err := turn.Err(); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+	if status := turn.Result().Status; status != wire.PromptResultStatusFinished {
+		t.Errorf("expected status finished, got %s", status)
+	}
+	if expected := []string{"Hello from", "Hello from mock kimi!"}; !slices.Equal(texts, expected) {
+		t.Errorf("expected the output of both attempts %q, got %q", expected, texts)
+	}
+}
+
+// textSink records the text a turn delivers to its sinks.
+type textSink struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (s *textSink) OnText(text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.texts = append(s.texts, text)
+}
+func (s *textSink) OnThink(string)               {}
+func (s *textSink) OnToolCall(wire.ToolCall)     {}
+func (s *textSink) OnToolResult(wire.ToolResult) {}
+
+func TestIntegration_RetryOnUnexpectedEOF_Sink(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("unexpected_eof_once"),
+		kimi.WithRetryOnUnexpectedEOF(2),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("test input"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	sink := &textSink{}
+	turn.AddSink(sink)
+	for step := range turn.Steps {
+		for range step.Messages {
+		}
+	}
+
+	// The sink may be added after the first attempt has sent its text, but it
+	// must receive the text of the retry before Steps is closed.
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.texts) == 0 || sink.texts[len(sink.texts)-1] != "Hello from mock kimi!" {
+		t.Errorf("expected the sink to receive the text of the retry, got %q", sink.texts)
+	}
+}
+
+func TestIntegration_WithFewShotExamples(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("echo"),
+		kimi.WithFewShotExamples([]kimi.Exchange{
+			{
+				User:      "Who is the character in this image?",
+				ToolCalls: []kimi.ExampleToolCall{{Name: "search_anime", Arguments: `{"query":"silver hair, red eyes"}`, Result: "Rem (Re:Zero)"}},
+				Assistant: "This is Rem from Re:Zero.",
+			},
+			{
+				User:      "Is it true that goldfish have a three-second memory?",
+				Assistant: "No, goldfish can remember things for months.",
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	prompt := func(content wire.Content) string {
+		turn, err := session.Prompt(context.Background(), content)
+		if err != nil {
+			t.Fatalf("Prompt: %v", err)
+		}
+		defer turn.Cancel()
+		var text strings.Builder
+		for step := range turn.Steps {
+			for msg := range step.Messages {
+				if part, ok := msg.(wire.ContentPart); ok {
+					text.WriteString(part.Text.Value)
+				}
+			}
+		}
+		if err := turn.Err(); err != nil {
+			t.Fatalf("Turn error: %v", err)
+		}
+		return text.String()
+	}
+
+	// A prompt that fails leaves the examples to the next one.
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := session.Prompt(cancelled, wire.NewStringContent("Never sent")); err == nil {
+		t.Fatal("expected Prompt to fail with a cancelled context")
+	}
+
+	first := prompt(wire.NewContent(wire.NewTextContentPart("Who is this?")))
+	expected := []string{
+		`<example index="1">`,
+		"User: Who is the character in this image?",
+		`Tool call: search_anime({"query":"silver hair, red eyes"})`,
+		"Tool result: Rem (Re:Zero)",
+		"Assistant: This is Rem from Re:Zero.",
+		`<example index="2">`,
+		"User: Is it true that goldfish have a three-second memory?",
+		"Assistant: No, goldfish can remember things for months.",
+		"Who is this?",
+	}
+	rest := first
+	for _, s := range expected {
+		i := strings.Index(rest, s)
+		if i < 0 {
+			t.Fatalf("expected %q after the previous lines in the transmitted input:\n%s", s, first)
+		}
+		rest = rest[i+len(s):]
+	}
+	if !strings.HasSuffix(first, "Who is this?") {
+		t.Errorf("expected the examples to precede the prompt, got:\n%s", first)
+	}
+
+	if second := prompt(wire.NewStringContent("And this one?")); second != "And this one?" {
+		t.Errorf("expected later prompts to be sent as is, got:\n%s", second)
+	}
+}
+
+func TestIntegration_WithSystemPrompt(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	const system = "Answer in \"French\",\nbriefly."
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("echo"),
+		kimi.WithSystemPrompt(system),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	for _, input := range []string{"Hello", "How are you?"} {
+		turn, err := session.Prompt(context.Background(), wire.NewStringContent(input))
+		if err != nil {
+			t.Fatalf("Prompt: %v", err)
+		}
+		var text strings.Builder
+		for step := range turn.Steps {
+			for msg := range step.Messages {
+				if part, ok := msg.(wire.ContentPart); ok {
+					text.WriteString(part.Text.Value)
+				}
+			}
+		}
+		if err := turn.Err(); err != nil {
+			t.Fatalf("Turn error: %v", err)
+		}
+		if expected := "system: " + system + "\n" + input; text.String() != expected {
+			t.Errorf("expected %q, got %q", expected, text.String())
+		}
+	}
+}
+
+func TestIntegration_WithLogger_SessionID(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	var logs bytes.Buffer
+	var mu sync.Mutex
+	logger := slog.New(slog.NewJSONHandler(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return logs.Write(p)
+	}), &slog.HandlerOptions{Level: kimi.LevelTrace}))
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("echo"),
+		kimi.WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	other, err := kimi.NewSession(kimi.WithExecutable(mockPath))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	other.Close()
+	if session.ID() == "" || session.ID() == other.ID() {
+		t.Fatalf("expected distinct session IDs, got %q and %q", session.ID(), other.ID())
+	}
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("Hello"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	for step := range turn.Steps {
+		for range step.Messages {
+		}
+	}
+	if err := turn.Err(); err != nil {
+		t.Fatalf("Turn error: %v", err)
+	}
+	session.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	var messages, events []string
+	frames := 0
+	for line := range strings.Lines(logs.String()) {
+		var record struct {
+			Msg       string `json:"msg"`
+			SessionID string `json:"session_id"`
+			Type      string `json:"type"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log record %q: %v", line, err)
+		}
+		if record.SessionID != session.ID() {
+			t.Errorf("expected session_id %q in %s", session.ID(), line)
+		}
+		switch record.Msg {
+		case "jsonrpc2 frame":
+			frames++
+		case "event received":
+			events = append(events, record.Type)
+		default:
+			messages = append(messages, record.Msg)
+		}
+	}
+	expected := []string{"initialized", "session started", "turn started", "turn finished", "session closed"}
+	if !slices.Equal(messages, expected) {
+		t.Errorf("expected records %q, got %q", expected, messages)
+	}
+	if expected := []string{"TurnBegin", "StepBegin", "ContentPart", "TurnEnd"}; !slices.Equal(events, expected) {
+		t.Errorf("expected events %q to be logged, got %q", expected, events)
+	}
+	if frames == 0 {
+		t.Error("expected the JSON-RPC frames to be logged at kimi.LevelTrace")
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestIntegration_WithMaxSteps(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("loop"),
+		kimi.WithMaxSteps(3),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("Loop forever"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	steps := 0
+	for step := range turn.Steps {
+		steps++
+		for range step.Messages {
+		}
+	}
+	if steps != 3 {
+		t.Errorf("expected 3 steps, got %d", steps)
+	}
+	if status := turn.Result().Status; status != wire.PromptResultStatusMaxStepsReached {
+		t.Errorf("expected status %s, got %s", wire.PromptResultStatusMaxStepsReached, status)
+	}
+}
+
+func TestIntegration_WithMaxContentPartBytes(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("echo"),
+		kimi.WithMaxContentPartBytes(1024),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	image := func(size int) wire.ContentPart {
+		data := base64.StdEncoding.EncodeToString(make([]byte, size))
+		return wire.NewImageContentPart("data:image/png;base64," + data)
+	}
+
+	_, err = session.Prompt(context.Background(), wire.NewContent(
+		wire.NewTextContentPart("What is in this image?"),
+		image(1025),
+	))
+	if !errors.Is(err, kimi.ErrContentPartTooLarge) {
+		t.Fatalf("expected ErrContentPartTooLarge, got %v", err)
+	}
+
+	turn, err := session.Prompt(context.Background(), wire.NewContent(
+		wire.NewTextContentPart("What is in this image?"),
+		image(1024),
+	))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	if err := turn.Drain(context.Background()); err != nil {
+		t.Fatalf("Turn error: %v", err)
+	}
+}
+
+func TestIntegration_NewSessionContext_CancelClosesSession(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	session, err := kimi.NewSessionContext(ctx, kimi.WithExecutable(mockPath))
+	if err != nil {
+		cancel()
+		t.Fatalf("NewSessionContext: %v", err)
+	}
+	defer session.Close()
+
+	cancel()
+
+	_, err = session.Prompt(context.Background(), wire.NewStringContent("test"))
+	if !errors.Is(err, kimi.ErrSessionClosed) {
+		t.Fatalf("expected ErrSessionClosed after context cancellation, got %v", err)
+	}
+}
+
+func TestIntegration_Compact(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("compact"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := session.Compact(ctx); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+
+	// The session takes prompts again once the compaction is over.
+	turn, err := session.Prompt(ctx, wire.NewStringContent("Hello"))
+	if err != nil {
+		t.Fatalf("Prompt after Compact: %v", err)
+	}
+	if err := turn.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+}
+
+func TestIntegration_Compact_TurnInFlight(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		withMode("compact"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	turn, err := session.Prompt(ctx, wire.NewStringContent("Hello"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	if err := session.Compact(ctx); !errors.Is(err, kimi.ErrTurnInFlight) {
+		t.Fatalf("expected ErrTurnInFlight while a turn is in flight, got %v", err)
+	}
+	if err := turn.Drain(ctx); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if err := session.Compact(ctx); err != nil {
+		t.Fatalf("Compact once the turn ended: %v", err)
+	}
+}
+
+func TestIntegration_Compact_Unsupported(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	session, err := kimi.NewSession(kimi.WithExecutable(mockPath))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Compact(context.Background()); !errors.Is(err, kimi.ErrCompactionUnsupported) {
+		t.Fatalf("expected ErrCompactionUnsupported, got %v", err)
+	}
+}
+
+func TestIntegration_Restart(t *testing.T) {
+	mockPath := getMockKimiPath(t)
+
+	newTool := func(name string) kimi.Tool {
+		tool, err := kimi.CreateTool(func(args testToolArgs) (testToolResult, error) {
+			return testToolResult(args.Input), nil
+		}, kimi.WithName(name))
+		if err != nil {
+			t.Fatalf("CreateTool: %v", err)
+		}
+		return tool
+	}
+	session, err := kimi.NewSession(
+		kimi.WithExecutable(mockPath),
+		kimi.WithTools(newTool("test_tool")),
+		withMode("crash"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+	added := newTool("added_tool")
+	if err := session.AddTool(&added); err != nil {
+		t.Fatalf("AddTool: %v", err)
+	}
+	id := session.ID()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	turn, err := session.Prompt(ctx, wire.NewStringContent("crash"))
+	if err == nil {
+		err = turn.Wait(ctx)
+	}
+	if err == nil {
+		t.Fatal("expected the crash to fail the turn")
+	}
+
+	if err := session.Restart(ctx); err != nil {
+		t.Fatalf("Restart: %v", err)
+	}
+	if session.ID() != id {
+		t.Errorf("expected the session to keep its ID %s, got %s", id, session.ID())
+	}
+	var advertised []string
+	for _, command := range session.SlashCommands {
+		advertised = append(advertised, command.Name)
+	}
+	if expected := []string{"tool:test_tool", "tool:added_tool"}; !slices.Equal(advertised, expected) {
+		t.Errorf("expected the new process to be given %v, got %v", expected, advertised)
+	}
+
+	turn, err = session.Prompt(ctx, wire.NewStringContent("Hello"))
+	if err != nil {
+		t.Fatalf("Prompt after Restart: %v", err)
+	}
+	text, err := turn.Text(ctx)
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	if text != "Hello from mock kimi!" {
+		t.Errorf("unexpected answer after Restart: %q", text)
+	}
+}
@@ -13,6 +13,16 @@
 //   tool_call - sends ToolCall request and waits for response
 //   tool_rejected - returns rejected external tools in initialize response
 //   turn_end - sends TurnEnd event to explicitly end the turn
+//   unexpected_eof_once - ends the first turn without TurnEnd
+//   echo - answers with the text of the user input
+//   hang - starts a turn, then ignores the prompt and cancel requests
+//   loop - takes steps until --max-steps-per-turn is reached
+//
+// Models: --model accepts any name but "no-such-model", for which it exits
+// with an error, as the CLI does for a model missing from its configuration.
+//
+// Agent files: --agent-file must extend the default agent; its ROLE_ADDITIONAL
+// system prompt argument is reported by the echo mode.
 
 package main
 
@@ -21,12 +31,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"sync/atomic"
 )
 
 var (
 	requestID atomic.Uint64
 	mode      string
+	model     string
+	prompts   int
+	system    string
+	maxSteps  = 100
 )
 
 type Payload struct {
@@ -46,6 +62,7 @@ func main() {
 	// Parse arguments
 	hasWire := false
 	hasInfo := false
+	agentFile := ""
 	for i, arg := range os.Args[1:] {
 		switch arg {
 		case "--wire":
@@ -56,6 +73,18 @@ func main() {
 			if i+1 < len(os.Args)-1 {
 				mode = os.Args[i+2]
 			}
+		case "--model":
+			if i+1 < len(os.Args)-1 {
+				model = os.Args[i+2]
+			}
+		case "--max-steps-per-turn":
+			if i+1 < len(os.Args)-1 {
+				maxSteps, _ = strconv.Atoi(os.Args[i+2])
+			}
+		case "--agent-file":
+			if i+1 < len(os.Args)-1 {
+				agentFile = os.Args[i+2]
+			}
 		}
 	}
 
@@ -70,6 +99,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	if model == "no-such-model" {
+		fmt.Fprintf(os.Stderr, "error: model %q is not configured\n", model)
+		os.Exit(1)
+	}
+
+	if agentFile != "" {
+		spec, err := os.ReadFile(agentFile)
+		if err != nil || !strings.Contains(string(spec), "extend: default") {
+			fmt.Fprintf(os.Stderr, "error: invalid agent file %s\n", agentFile)
+			os.Exit(1)
+		}
+		for _, line := range strings.Split(string(spec), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), "ROLE_ADDITIONAL:"); ok {
+				json.Unmarshal([]byte(strings.TrimSpace(value)), &system)
+			}
+		}
+	}
+
 	scanner := bufio.NewScanner(os.Stdin)
 	encoder := json.NewEncoder(os.Stdout)
 
@@ -81,7 +128,7 @@ func main() {
 
 		switch req.Method {
 		case "initialize":
-			handleInitialize(encoder, req.ID)
+			handleInitialize(encoder, scanner, req.Params, req.ID)
 		case "prompt":
 			switch mode {
 			case "deadlock":
@@ -94,18 +141,75 @@ func main() {
 				handlePromptToolCall(encoder, scanner, req.ID)
 			case "turn_end":
 				handlePromptTurnEnd(encoder, req.ID)
+			case "echo":
+				handlePromptEcho(encoder, req.Params, req.ID)
+			case "hang":
+				handlePromptHang(encoder)
+			case "loop":
+				handlePromptLoop(encoder, req.ID)
+			case "compact":
+				handlePromptCompact(encoder, req.Params, req.ID)
+			case "crash":
+				handlePromptCrash(encoder, req.Params, req.ID)
+			case "unexpected_eof_once":
+				prompts++
+				if prompts == 1 {
+					handlePromptUnexpectedEOF(encoder, req.ID)
+				} else {
+					handlePromptTurnEnd(encoder, req.ID)
+				}
 			default:
 				handlePrompt(encoder, req.ID)
 			}
 		case "cancel":
+			if mode == "hang" {
+				continue
+			}
 			handleCancel(encoder, req.ID)
 		}
 	}
 }
 
-func handleInitialize(encoder *json.Encoder, reqID string) {
+func handleInitialize(encoder *json.Encoder, scanner *bufio.Scanner, params json.RawMessage, reqID string) {
 	var result json.RawMessage
-	if mode == "tool_rejected" {
+	if mode == "early_tool_call" {
+		// Call a tool before answering initialize, and report the SDK's error
+		// message back as the description of a slash command.
+		toolReqID := fmt.Sprintf("req-%d", requestID.Add(1))
+		payloadJSON, _ := json.Marshal(map[string]any{
+			"id":        "call-early",
+			"name":      "test_tool",
+			"arguments": `{"input":"hello"}`,
+		})
+		paramsJSON, _ := json.Marshal(map[string]any{
+			"type":    "ToolCallRequest",
+			"payload": json.RawMessage(payloadJSON),
+		})
+		encoder.Encode(Payload{
+			Version: "2.0",
+			ID:      toolReqID,
+			Method:  "request",
+			Params:  paramsJSON,
+		})
+		var reply struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if scanner.Scan() {
+			json.Unmarshal(scanner.Bytes(), &reply)
+		}
+		slashCommands, _ := json.Marshal([]map[string]any{{
+			"name":        "early_tool_call_error",
+			"description": reply.Error.Message,
+			"aliases":     []string{},
+		}})
+		result = json.RawMessage(fmt.Sprintf(`{
+			"protocol_version": "2",
+			"server": {"name": "mock_kimi", "version": "0.0.1"},
+			"slash_commands": %s
+		}`, slashCommands))
+	} else if mode == "tool_rejected" {
 		result = json.RawMessage(`{
 			"protocol_version": "2",
 			"server": {"name": "mock_kimi", "version": "0.0.1"},
@@ -115,6 +219,35 @@ func handleInitialize(encoder *json.Encoder, reqID string) {
 				"rejected": [{"name": "test_tool", "reason": "conflicts with builtin tool"}]
 			}
 		}`)
+	} else if mode == "crash" {
+		// Report the external tools advertised as slash commands named after
+		// them, so that tests can tell what each process was given.
+		var initialize struct {
+			ExternalTools []struct {
+				Name string `json:"name"`
+			} `json:"external_tools"`
+		}
+		json.Unmarshal(params, &initialize)
+		commands := []map[string]any{}
+		for _, tool := range initialize.ExternalTools {
+			commands = append(commands, map[string]any{
+				"name":        "tool:" + tool.Name,
+				"description": "",
+				"aliases":     []string{},
+			})
+		}
+		slashCommands, _ := json.Marshal(commands)
+		result = json.RawMessage(fmt.Sprintf(`{
+			"protocol_version": "2",
+			"server": {"name": "mock_kimi", "version": "0.0.1"},
+			"slash_commands": %s
+		}`, slashCommands))
+	} else if mode == "compact" {
+		result = json.RawMessage(`{
+			"protocol_version": "2",
+			"server": {"name": "mock_kimi", "version": "0.0.1"},
+			"slash_commands": [{"name": "compact", "description": "Compact the context", "aliases": []}]
+		}`)
 	} else {
 		result = json.RawMessage(`{
 			"protocol_version": "2",
@@ -258,6 +391,9 @@ func handlePromptFlood(encoder *json.Encoder, reqID string) {
 		})
 	}
 
+	// Send TurnEnd event to properly end the turn
+	sendEvent(encoder, "TurnEnd", map[string]any{})
+
 	// Send prompt response
 	encoder.Encode(Payload{
 		Version: "2.0",
@@ -308,6 +444,75 @@ func handlePromptTurnEnd(encoder *json.Encoder, reqID string) {
 	})
 }
 
+// handlePromptEcho answers a prompt with the text of its user input, so that
+// tests can see what was transmitted.
+func handlePromptEcho(encoder *json.Encoder, params json.RawMessage, reqID string) {
+	var prompt PromptParams
+	json.Unmarshal(params, &prompt)
+	var text string
+	if err := json.Unmarshal(prompt.UserInput, &text); err != nil {
+		var parts []struct {
+			Text string `json:"text"`
+		}
+		json.Unmarshal(prompt.UserInput, &parts)
+		for _, part := range parts {
+			text += part.Text
+		}
+	}
+	if system != "" {
+		text = "system: " + system + "\n" + text
+	}
+	sendEvent(encoder, "TurnBegin", map[string]any{
+		"user_input": prompt.UserInput,
+	})
+	sendEvent(encoder, "StepBegin", map[string]any{
+		"n": 1,
+	})
+	sendEvent(encoder, "ContentPart", map[string]any{
+		"type": "text",
+		"text": text,
+	})
+	sendEvent(encoder, "TurnEnd", map[string]any{})
+
+	encoder.Encode(Payload{
+		Version: "2.0",
+		ID:      reqID,
+		Result:  json.RawMessage(`{"status":"finished","steps":1}`),
+	})
+}
+
+// handlePromptHang starts a turn and then stops responding, as a wedged
+// process would: the prompt is never answered and cancel requests are ignored.
+func handlePromptHang(encoder *json.Encoder) {
+	sendEvent(encoder, "TurnBegin", map[string]any{
+		"user_input": "test",
+	})
+	sendEvent(encoder, "StepBegin", map[string]any{
+		"n": 1,
+	})
+}
+
+// handlePromptUnexpectedEOF streams part of a turn and completes the prompt
+// without sending TurnEnd, as when the stream is cut.
+func handlePromptUnexpectedEOF(encoder *json.Encoder, reqID string) {
+	sendEvent(encoder, "TurnBegin", map[string]any{
+		"user_input": "test",
+	})
+	sendEvent(encoder, "StepBegin", map[string]any{
+		"n": 1,
+	})
+	sendEvent(encoder, "ContentPart", map[string]any{
+		"type": "text",
+		"text": "Hello from",
+	})
+
+	encoder.Encode(Payload{
+		Version: "2.0",
+		ID:      reqID,
+		Result:  json.RawMessage(`{"status":"finished","steps":1}`),
+	})
+}
+
 // handlePromptToolCall sends a ToolCall request and waits for response.
 // This tests whether WithTools correctly registers tools and handles tool calls.
 func handlePromptToolCall(encoder *json.Encoder, scanner *bufio.Scanner, reqID string) {
@@ -355,3 +560,64 @@ func handlePromptToolCall(encoder *json.Encoder, scanner *bufio.Scanner, reqID s
 	})
 }
 
+
+// handlePromptCompact compacts the context on the /compact slash command, and
+// answers other prompts like handlePrompt.
+func handlePromptCompact(encoder *json.Encoder, params json.RawMessage, reqID string) {
+	var prompt PromptParams
+	json.Unmarshal(params, &prompt)
+	var text string
+	json.Unmarshal(prompt.UserInput, &text)
+	if text != "/compact" {
+		handlePrompt(encoder, reqID)
+		return
+	}
+	sendEvent(encoder, "TurnBegin", map[string]any{
+		"user_input": text,
+	})
+	sendEvent(encoder, "CompactionBegin", map[string]any{})
+	sendEvent(encoder, "CompactionEnd", map[string]any{})
+	sendEvent(encoder, "TurnEnd", map[string]any{})
+
+	encoder.Encode(Payload{
+		Version: "2.0",
+		ID:      reqID,
+		Result:  json.RawMessage(`{"status":"finished","steps":0}`),
+	})
+}
+
+// handlePromptCrash exits abruptly on the prompt "crash", and answers other
+// prompts like handlePrompt.
+func handlePromptCrash(encoder *json.Encoder, params json.RawMessage, reqID string) {
+	var prompt PromptParams
+	json.Unmarshal(params, &prompt)
+	var text string
+	json.Unmarshal(prompt.UserInput, &text)
+	if text == "crash" {
+		fmt.Fprintln(os.Stderr, "fatal: simulated crash")
+		os.Exit(2)
+	}
+	handlePrompt(encoder, reqID)
+}
+
+func handlePromptLoop(encoder *json.Encoder, reqID string) {
+	sendEvent(encoder, "TurnBegin", map[string]any{
+		"user_input": "test",
+	})
+	for n := 1; n <= maxSteps; n++ {
+		sendEvent(encoder, "StepBegin", map[string]any{
+			"n": n,
+		})
+		sendEvent(encoder, "ContentPart", map[string]any{
+			"type": "text",
+			"text": fmt.Sprintf("step %d", n),
+		})
+	}
+	sendEvent(encoder, "TurnEnd", map[string]any{})
+
+	encoder.Encode(Payload{
+		Version: "2.0",
+		ID:      reqID,
+		Result:  json.RawMessage(fmt.Sprintf(`{"status":"max_steps_reached","steps":%d}`, maxSteps)),
+	})
+}
@@ -1,18 +1,83 @@
 package kimi
 
 import (
+	"context"
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"math"
 	"reflect"
+	"regexp"
 	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
 )
 
 type Tool struct {
-	call func(args json.RawMessage) (string, error)
+	call func(ctx context.Context, args json.RawMessage) (wire.ToolResultReturnValue, error)
 	def  wire.ExternalTool
+
+	// paramType, fieldDescriptions and schemaOptions allow the schema to be regenerated
+	// with other descriptions; paramType is nil when the schema was set with WithSchema.
+	paramType         reflect.Type
+	fieldDescriptions map[string]string
+	schemaOptions     schemaOptions
+
+	// skipped lists the JSON paths of the fields left out of the schema by
+	// WithSkipUnrepresentableFields; they are dropped before decoding.
+	skipped [][]string
+
+	// writePath returns the path of the file a call writes, set with WithFileWrite.
+	writePath func(args json.RawMessage) (string, bool)
+}
+
+// Definition returns the definition of the tool advertised to the model: its
+// name, description and JSON schema of its parameters.
+func (tool Tool) Definition() wire.ExternalTool {
+	def := tool.def
+	def.Parameters = slices.Clone(def.Parameters)
+	return def
+}
+
+// ToolDoc holds the descriptions of a tool, e.g. loaded from a localized catalog.
+// Fields maps Go struct field names (not JSON names) to their descriptions.
+type ToolDoc struct {
+	Description string
+	Fields      map[string]string
+}
+
+// withDoc returns the tool with its descriptions overridden by doc.
+func (tool Tool) withDoc(doc ToolDoc) (Tool, error) {
+	if doc.Description != "" {
+		tool.def.Description = doc.Description
+	}
+	if len(doc.Fields) == 0 {
+		return tool, nil
+	}
+	if tool.paramType == nil {
+		return Tool{}, fmt.Errorf("tool %q: field descriptions cannot be applied to a schema set with WithSchema", tool.def.Name)
+	}
+	fieldDescs := maps.Clone(tool.fieldDescriptions)
+	if fieldDescs == nil {
+		fieldDescs = make(map[string]string, len(doc.Fields))
+	}
+	maps.Copy(fieldDescs, doc.Fields)
+	schema, err := cachedSchema(tool.paramType, fieldDescs, tool.schemaOptions)
+	if err != nil {
+		return Tool{}, err
+	}
+	tool.def.Parameters = schema.json
+	tool.fieldDescriptions = fieldDescs
+	return tool, nil
 }
 
 type ToolOption func(*toolOption)
@@ -22,6 +87,11 @@ type toolOption struct {
 	schema            json.RawMessage
 	description       string
 	fieldDescriptions map[string]string
+	schemaOptions     schemaOptions
+	timeout           time.Duration
+	validateArgs      bool
+	writePathField    string
+	argValidator      any // func(T) error, see WithArgValidator
 }
 
 // WithName sets the tool name (overrides auto-detected name from function).
@@ -47,7 +117,8 @@ func WithDescription(description string) ToolOption {
 }
 
 // WithFieldDescription sets description for a struct field.
-// The fieldName should be the Go struct field name (not the JSON name).
+// The fieldName should be the Go struct field name (not the JSON name). Fields of
+// nested structs are addressed by a dotted path of Go field names, e.g. "User.Name".
 func WithFieldDescription(fieldName, description string) ToolOption {
 	return func(opt *toolOption) {
 		if opt.fieldDescriptions == nil {
@@ -57,10 +128,169 @@ func WithFieldDescription(fieldName, description string) ToolOption {
 	}
 }
 
+// WithTypeSchema sets the JSON schema used for every value of type T in the
+// parameter type, instead of the generated one. Use it for types whose JSON form
+// cannot be inferred by reflection, such as types with a custom MarshalJSON, which
+// otherwise accept any JSON value.
+func WithTypeSchema[T any](schema json.RawMessage) ToolOption {
+	return func(opt *toolOption) {
+		if opt.schemaOptions.types == nil {
+			opt.schemaOptions.types = make(map[reflect.Type]json.RawMessage)
+		}
+		opt.schemaOptions.types[reflect.TypeFor[T]()] = schema
+	}
+}
+
+// WithSchemaOverride replaces the generated schema of a struct field with schema.
+// The fieldName should be the Go struct field name (not the JSON name). Whether the
+// field is required is still decided by its json tag. The schema is used verbatim,
+// so descriptions of the field are not applied.
+func WithSchemaOverride(fieldName string, schema json.RawMessage) ToolOption {
+	return func(opt *toolOption) {
+		if opt.schemaOptions.fields == nil {
+			opt.schemaOptions.fields = make(map[string]json.RawMessage)
+		}
+		opt.schemaOptions.fields[fieldName] = schema
+	}
+}
+
+// WithSkipUnrepresentableFields leaves fields whose type has no JSON schema, such
+// as interface, func and chan fields, out of the generated schema instead of
+// failing. Values the model sends for such fields are dropped before decoding.
+func WithSkipUnrepresentableFields() ToolOption {
+	return func(opt *toolOption) {
+		opt.schemaOptions.skipUnrepresentable = true
+	}
+}
+
+// WithStrictSchema adds "additionalProperties": false to every object schema
+// generated from a struct, including nested ones, so that the model cannot send
+// properties the struct does not declare. Maps keep accepting any key.
+func WithStrictSchema() ToolOption {
+	return func(opt *toolOption) {
+		opt.schemaOptions.strict = true
+	}
+}
+
+// WithUIHints annotates the object schemas generated from structs for UIs that
+// build forms from tool schemas: "x-order" lists the properties in the order of
+// the struct fields, and a field tagged group:"..." gets that name as "x-group".
+// Models ignore these extension keywords.
+func WithUIHints() ToolOption {
+	return func(opt *toolOption) {
+		opt.schemaOptions.uiHints = true
+	}
+}
+
+// WithToolTimeout bounds the time a call of the tool may take. When the
+// function has not returned after d, the model receives a timeout error. The
+// context passed to a function created with CreateToolContext is cancelled at
+// that point; a function that does not honor it keeps running in the
+// background, and its result is discarded.
+func WithToolTimeout(d time.Duration) ToolOption {
+	return func(opt *toolOption) {
+		opt.timeout = d
+	}
+}
+
+// WithArgumentValidation checks the arguments of each call against the tool's
+// schema before calling the function: required fields, types, enum values,
+// numeric bounds, string lengths and patterns. Arguments that do not conform are
+// rejected with an error naming each offending field and the constraint it
+// violates, so that the model can correct the call, instead of being silently
+// zeroed or coerced when decoded. null is accepted for pointer fields, which it
+// leaves nil, as for an omitted optional field.
+func WithArgumentValidation() ToolOption {
+	return func(opt *toolOption) {
+		opt.validateArgs = true
+	}
+}
+
+// WithArgValidator checks the decoded arguments of each call with validate,
+// e.g. to enforce business rules a schema cannot express, before calling the
+// function. If validate returns an error, the function is not called and the
+// model receives the error message as the tool's error result. T must be the
+// parameter type of the function the tool is created from; for a tool created
+// with CreateToolFromSchema, it is json.RawMessage.
+func WithArgValidator[T any](validate func(args T) error) ToolOption {
+	return func(opt *toolOption) {
+		opt.argValidator = validate
+	}
+}
+
+// WithFileWrite declares that the tool writes the file whose path is the
+// argument pathField (its JSON name), so that concurrent calls writing the same
+// file are handled according to the session's WithWriteConflictPolicy.
+func WithFileWrite(pathField string) ToolOption {
+	return func(opt *toolOption) {
+		opt.writePathField = pathField
+	}
+}
+
+// SchemaGenerator generates the JSON schema of a tool's parameter type t, given
+// the field descriptions set with WithFieldDescription or a description catalog,
+// keyed by Go struct field name.
+type SchemaGenerator func(t reflect.Type, fieldDescs map[string]string) (json.RawMessage, error)
+
+// WithSchemaGenerator replaces the built-in schema generator, e.g. to follow
+// another JSON Schema draft or add custom keywords. Arguments are still decoded
+// into the parameter type with encoding/json. The other options shaping the
+// generated schema, such as WithTypeSchema or WithStrictSchema, do not apply.
+func WithSchemaGenerator(generate SchemaGenerator) ToolOption {
+	return func(opt *toolOption) {
+		opt.schemaOptions.generator = generate
+	}
+}
+
 // CreateTool creates a Tool from a function.
-// The function must have signature func(T) (U, error) where T is a struct type.
-// The result U can be: string (returned directly), fmt.Stringer (calls .String()), or any other type (JSON serialized).
+// The function must have signature func(T) (U, error) where T is a struct type,
+// a pointer to a struct type, or a map with string keys.
+// The result U can be: wire.Content (returned to the model as is, e.g. to return images),
+// BinaryResult (binary data, returned as a data URL), string (returned directly),
+// fmt.Stringer (calls .String()), or any other type (JSON serialized).
+// To show display blocks to the user, return a ToolOutput or *ToolOutput wrapping one of these.
+// Map results are always serialized as JSON objects, so a nil map yields "{}" rather than "null".
+//
+// Generic functions must be instantiated before being passed, e.g. CreateTool(Lookup[string]);
+// an uninstantiated generic function is not a value and is rejected by the compiler.
+// The schema is generated from the instantiated parameter type, and the type arguments
+// are omitted from the auto-detected name.
 func CreateTool[T any, U any](function func(T) (U, error), options ...ToolOption) (Tool, error) {
+	return createTool(function, func(_ context.Context, params T) (U, error) {
+		return function(params)
+	}, options)
+}
+
+// CreateToolContext is like CreateTool for a function with signature
+// func(context.Context, T) (U, error). The context is the one passed to the
+// Session.Prompt call during which the model calls the tool, so cancelling the
+// prompt cancels the tool's work. The schema is generated from T.
+func CreateToolContext[T any, U any](function func(context.Context, T) (U, error), options ...ToolOption) (Tool, error) {
+	return createTool(function, function, options)
+}
+
+// CreateToolFromSchema creates a Tool from a JSON schema instead of a Go type,
+// e.g. to proxy a tool defined in an external registry. The schema is advertised
+// as is, and handler receives the raw JSON arguments of each call. Options such
+// as WithToolTimeout and WithArgumentValidation apply as for CreateTool; name,
+// description and schema take precedence over WithName, WithDescription and
+// WithSchema.
+func CreateToolFromSchema(name, description string, schema json.RawMessage, handler func(args json.RawMessage) (string, error), options ...ToolOption) (Tool, error) {
+	if name == "" {
+		return Tool{}, errors.New("tool name must not be empty")
+	}
+	if !json.Valid(schema) {
+		return Tool{}, fmt.Errorf("schema of tool %q is not valid JSON", name)
+	}
+	options = append(slices.Clip(options), WithName(name), WithDescription(description), WithSchema(schema))
+	return createTool(handler, func(_ context.Context, args json.RawMessage) (string, error) {
+		return handler(args)
+	}, options)
+}
+
+// createTool creates a Tool calling function; named is the function passed by
+// the user, from which the tool name is detected.
+func createTool[T any, U any](named any, function func(context.Context, T) (U, error), options []ToolOption) (Tool, error) {
 	opt := &toolOption{}
 	for _, o := range options {
 		if o != nil {
@@ -68,21 +298,38 @@ func CreateTool[T any, U any](function func(T) (U, error), options ...ToolOption
 		}
 	}
 
+	// A nil function would only fail at call time, with a panic.
+	if reflect.ValueOf(named).IsNil() {
+		if opt.name != "" {
+			return Tool{}, fmt.Errorf("tool %q: function must not be nil", opt.name)
+		}
+		return Tool{}, errors.New("tool function must not be nil")
+	}
+
 	// Get function name
 	name := opt.name
 	if name == "" {
-		name = getFunctionName(function)
+		name = getFunctionName(named)
 	}
 	if name == "" {
 		return Tool{}, fmt.Errorf("unable to determine function name; use WithName() to set it explicitly")
 	}
 
 	// Get JSON schema: use provided schema or generate from parameter type
-	var schemaJSON json.RawMessage
+	var (
+		schemaJSON json.RawMessage
+		paramType  reflect.Type
+		skipped    [][]string
+		nullable   [][]string
+	)
 	if opt.schema != nil {
 		schemaJSON = opt.schema
 	} else {
-		paramType := reflect.TypeFor[T]()
+		paramType = reflect.TypeFor[T]()
+		// A pointer to a struct is described by the struct's schema
+		if paramType.Kind() == reflect.Pointer && paramType.Elem().Kind() == reflect.Struct {
+			paramType = paramType.Elem()
+		}
 		// Parameter type must be struct or map[string]T (JSON schema must be object)
 		switch paramType.Kind() {
 		case reflect.Struct:
@@ -94,14 +341,16 @@ func CreateTool[T any, U any](function func(T) (U, error), options ...ToolOption
 		default:
 			return Tool{}, fmt.Errorf("parameter type must be struct or map, got %s", paramType.Kind())
 		}
-		schema, err := generateSchema(paramType, opt.fieldDescriptions)
-		if err != nil {
-			return Tool{}, fmt.Errorf("generate schema: %w", err)
+		if err := opt.schemaOptions.validate(); err != nil {
+			return Tool{}, err
 		}
-		schemaJSON, err = json.Marshal(schema)
+		schema, err := cachedSchema(paramType, opt.fieldDescriptions, opt.schemaOptions)
 		if err != nil {
 			return Tool{}, err
 		}
+		schemaJSON = schema.json
+		skipped = schema.skipped
+		nullable = schema.nullable
 	}
 
 	def := wire.ExternalTool{
@@ -110,19 +359,258 @@ func CreateTool[T any, U any](function func(T) (U, error), options ...ToolOption
 		Parameters:  schemaJSON,
 	}
 
-	fn := func(args json.RawMessage) (string, error) {
-		var params T
-		if err := json.Unmarshal(args, &params); err != nil {
-			return "", err
+	var validator *argSchema
+	if opt.validateArgs {
+		var err error
+		if validator, err = compileArgSchema(schemaJSON); err != nil {
+			return Tool{}, fmt.Errorf("argument validation: %w", err)
+		}
+		for _, path := range nullable {
+			validator.allowNull(path)
 		}
-		result, err := function(params)
+	}
+
+	var validateParams func(T) error
+	if opt.argValidator != nil {
+		var ok bool
+		if validateParams, ok = opt.argValidator.(func(T) error); !ok {
+			return Tool{}, fmt.Errorf("argument validator of tool %q: expected func(%s) error, got %T", name, reflect.TypeFor[T](), opt.argValidator)
+		}
+	}
+
+	invoke := func(ctx context.Context, params T) (_ wire.ToolResultReturnValue, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = panicError(r)
+			}
+		}()
+		result, err := function(ctx, params)
 		if err != nil {
-			return "", err
+			return wire.ToolResultReturnValue{}, err
+		}
+		return returnValue(result)
+	}
+	fn := func(ctx context.Context, args json.RawMessage) (wire.ToolResultReturnValue, error) {
+		if validator != nil {
+			if err := validator.validate(args); err != nil {
+				return wire.ToolResultReturnValue{}, err
+			}
+		}
+		params, err := decodeParams[T](args, skipped)
+		if err != nil {
+			return wire.ToolResultReturnValue{}, err
+		}
+		if validateParams != nil {
+			if err := validateParams(params); err != nil {
+				return wire.ToolResultReturnValue{}, err
+			}
+		}
+		if opt.timeout <= 0 {
+			return invoke(ctx, params)
+		}
+		return invokeWithTimeout(ctx, opt.timeout, func(ctx context.Context) (wire.ToolResultReturnValue, error) {
+			return invoke(ctx, params)
+		})
+	}
+
+	return Tool{
+		call:              fn,
+		def:               def,
+		paramType:         paramType,
+		fieldDescriptions: opt.fieldDescriptions,
+		schemaOptions:     opt.schemaOptions,
+		skipped:           skipped,
+		writePath:         writePathFunc(opt.writePathField),
+	}, nil
+}
+
+// decodeParams decodes the arguments of a call into the parameter type T of a
+// tool function. For a pointer to a struct, the arguments are decoded into a new
+// struct, so that the function never receives nil.
+func decodeParams[T any](raw json.RawMessage, skipped [][]string) (T, error) {
+	var params T
+	into := any(&params)
+	if typ := reflect.TypeFor[T](); typ.Kind() == reflect.Pointer && typ.Elem().Kind() == reflect.Struct {
+		params = reflect.New(typ.Elem()).Interface().(T)
+		into = params
+	}
+	err := decodeArgs(raw, skipped, into)
+	return params, err
+}
+
+// DecodeArgs decodes the arguments of a call to the tool, e.g. those of a
+// wire.ToolCall once all its ToolCallPart fragments have been received, into
+// the value pointed to by into, the way the tool itself decodes them. For a
+// tool created from a function taking T, or *T for a struct T, into must be a
+// *T.
+func (tool Tool) DecodeArgs(raw json.RawMessage, into any) error {
+	if tool.paramType != nil {
+		if typ := reflect.TypeOf(into); typ != reflect.PointerTo(tool.paramType) {
+			return fmt.Errorf("decode %s arguments: expected *%s, got %v", tool.def.Name, tool.paramType, typ)
+		}
+	}
+	if err := decodeArgs(raw, tool.skipped, into); err != nil {
+		return fmt.Errorf("decode %s arguments: %w", tool.def.Name, err)
+	}
+	return nil
+}
+
+func decodeArgs(raw json.RawMessage, skipped [][]string, into any) error {
+	for _, path := range skipped {
+		raw = dropJSONPath(raw, path)
+	}
+	return json.Unmarshal(raw, into)
+}
+
+// invokeWithTimeout runs invoke with a context that expires after timeout, and
+// stops waiting for it then. See WithToolTimeout.
+func invokeWithTimeout(ctx context.Context, timeout time.Duration, invoke func(context.Context) (wire.ToolResultReturnValue, error)) (wire.ToolResultReturnValue, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	type outcome struct {
+		value wire.ToolResultReturnValue
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		value, err := invoke(ctx)
+		done <- outcome{value, err}
+	}()
+	select {
+	case o := <-done:
+		return o.value, o.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return wire.ToolResultReturnValue{}, fmt.Errorf("tool timed out after %s", timeout)
+		}
+		return wire.ToolResultReturnValue{}, ctx.Err()
+	}
+}
+
+// maxPanicStackLines bounds the stack trace included in the error reported for
+// a panicking tool, so that the model is not sent a huge result.
+const maxPanicStackLines = 16
+
+// panicError converts a panic in a tool function into an error carrying the
+// panic value and the start of the stack trace.
+func panicError(value any) error {
+	stack := strings.Split(strings.TrimSpace(string(debug.Stack())), "\n")
+	if len(stack) > maxPanicStackLines {
+		stack = append(stack[:maxPanicStackLines], "...")
+	}
+	return fmt.Errorf("tool panicked: %v\n%s", value, strings.Join(stack, "\n"))
+}
+
+// dropJSONPath removes the value at path from the JSON document data, where a
+// "*" segment stands for every element of an array or value of an object. Data
+// that does not have the expected shape is returned unchanged.
+func dropJSONPath(data json.RawMessage, path []string) json.RawMessage {
+	if len(path) == 0 {
+		return data
+	}
+	if path[0] == "*" {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(data, &elems); err == nil {
+			for i := range elems {
+				elems[i] = dropJSONPath(elems[i], path[1:])
+			}
+			if out, err := json.Marshal(elems); err == nil {
+				return out
+			}
+			return data
+		}
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil || object == nil {
+		return data
+	}
+	if path[0] == "*" {
+		for key, value := range object {
+			object[key] = dropJSONPath(value, path[1:])
+		}
+	} else if value, ok := object[path[0]]; ok {
+		if len(path) == 1 {
+			delete(object, path[0])
+		} else {
+			object[path[0]] = dropJSONPath(value, path[1:])
 		}
-		return stringifyResult(result)
+	} else {
+		return data
+	}
+	out, err := json.Marshal(object)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+// returnValue converts the result of a tool function to the return value of its
+// ToolResult, unwrapping a ToolOutput.
+func returnValue(result any) (wire.ToolResultReturnValue, error) {
+	display := []wire.DisplayBlock{}
+	switch v := result.(type) {
+	case *ToolOutput:
+		if v != nil {
+			return returnValue(*v)
+		}
+		result = ""
+	case ToolOutput:
+		for _, block := range v.Display {
+			display = append(display, block.block)
+		}
+		result = v.Output
+	}
+	output, err := resultContent(result)
+	if err != nil {
+		return wire.ToolResultReturnValue{}, err
+	}
+	return wire.ToolResultReturnValue{Output: output, Display: display}, nil
+}
+
+// BinaryResult is a tool result carrying binary data, such as a generated image
+// or an archive, of the media type MIME. It is sent to the model as a data URL,
+// in an image, audio or video content part according to MIME, or in a text part
+// for other types.
+type BinaryResult struct {
+	MIME string
+	Data []byte
+}
+
+func (r BinaryResult) content() wire.Content {
+	mimeType := r.MIME
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
 	}
+	url := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(r.Data)
+	switch kind, _, _ := strings.Cut(strings.ToLower(mimeType), "/"); kind {
+	case "image":
+		return wire.NewContent(wire.NewImageContentPart(url))
+	case "audio":
+		return wire.NewContent(wire.NewAudioContentPart(url))
+	case "video":
+		return wire.NewContent(wire.NewVideoContentPart(url))
+	default:
+		return wire.NewContent(wire.NewTextContentPart(url))
+	}
+}
 
-	return Tool{call: fn, def: def}, nil
+// resultContent returns the content sent to the model for a tool result.
+func resultContent(result any) (wire.Content, error) {
+	switch v := result.(type) {
+	case wire.Content:
+		return v, nil
+	case BinaryResult:
+		return v.content(), nil
+	case *BinaryResult:
+		if v != nil {
+			return v.content(), nil
+		}
+	}
+	text, err := stringifyResult(result)
+	if err != nil {
+		return wire.Content{}, err
+	}
+	return wire.NewStringContent(text), nil
 }
 
 func stringifyResult(result any) (string, error) {
@@ -132,6 +620,9 @@ func stringifyResult(result any) (string, error) {
 	case fmt.Stringer:
 		return v.String(), nil
 	default:
+		if v := reflect.ValueOf(result); v.Kind() == reflect.Map && v.IsNil() {
+			return "{}", nil
+		}
 		data, err := json.Marshal(result)
 		if err != nil {
 			return "", err
@@ -140,8 +631,13 @@ func stringifyResult(result any) (string, error) {
 	}
 }
 
-var replacer = strings.NewReplacer(".", "_")
+var replacer = strings.NewReplacer(".", "_", "(*", "", "(", "", ")", "")
 
+// getFunctionName derives a tool name from the runtime name of fn, with '.'
+// replaced by '_', e.g. "main_Search" for main.Search. The names of method
+// values and closures, such as "github.com/user/app/service.(*service).Search-fm",
+// are shortened to the last element of their package path, the receiver type and
+// the method name, e.g. "service_service_Search".
 func getFunctionName[T any](fn T) string {
 	fnValue := reflect.ValueOf(fn)
 	fnPtr := fnValue.Pointer()
@@ -150,34 +646,374 @@ func getFunctionName[T any](fn T) string {
 		return ""
 	}
 	fullName := fnInfo.Name()
-	// Remove -fm suffix for method values
-	if dashIdx := strings.Index(fullName, "-"); dashIdx >= 0 {
-		fullName = fullName[:dashIdx]
+	if !strings.HasSuffix(fullName, "-fm") && !closureName.MatchString(fullName) {
+		// Remove anything after a dash, such as the -fm suffix of method values
+		if dashIdx := strings.Index(fullName, "-"); dashIdx >= 0 {
+			fullName = fullName[:dashIdx]
+		}
+		// Remove type arguments of instantiated generic functions
+		// e.g., "main.Lookup[...]" -> "main.Lookup"
+		fullName = strings.ReplaceAll(fullName, "[...]", "")
+		// Replace '.' with '_'
+		// e.g., "main.MyFunction" -> "main_MyFunction"
+		return strings.ReplaceAll(fullName, ".", "_")
 	}
-	// Replace '.' with '_'
-	// e.g., "main.MyFunction" -> "main_MyFunction"
+	// Remove the package path, which may itself contain dots and dashes
+	// e.g., "github.com/user/my-app/service.Search-fm" -> "service.Search-fm"
+	if slashIdx := strings.LastIndex(fullName, "/"); slashIdx >= 0 {
+		fullName = fullName[slashIdx+1:]
+	}
+	// Remove -fm suffix for method values
+	// e.g., "main.(*service).Search-fm" -> "main.(*service).Search"
+	fullName = strings.TrimSuffix(fullName, "-fm")
+	fullName = strings.ReplaceAll(fullName, "[...]", "")
+	// Replace '.' with '_' and drop receiver parentheses
+	// e.g., "main.(*service).Search" -> "main_service_Search"
 	return replacer.Replace(fullName)
 }
 
+// closureName matches the runtime names of closures, e.g. "main.main.func1" or
+// "main.main.func1.2" for a closure nested in another.
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+// schemaCache holds generated schemas so that repeated CreateTool calls for
+// the same parameter type skip reflection. The schemas are cached without the
+// descriptions set with WithFieldDescription, which are applied to a copy
+// afterwards, so the cache holds at most one schema per type and combination
+// of the boolean schema options. Schemas generated with type or field schema
+// overrides are not cached.
+var schemaCache sync.Map // map[schemaCacheKey]*generatedSchema
+
+type schemaCacheKey struct {
+	typ                 reflect.Type
+	skipUnrepresentable bool
+	strict              bool
+	uiHints             bool
+}
+
+// generatedSchema is a marshaled schema together with the JSON paths of the
+// fields left out of it by WithSkipUnrepresentableFields, and of the pointer
+// values that WithArgumentValidation lets be null.
+type generatedSchema struct {
+	schema   *jsonSchema
+	json     json.RawMessage
+	skipped  [][]string
+	nullable [][]string
+}
+
+func cachedSchema(t reflect.Type, fieldDescs map[string]string, opts schemaOptions) (*generatedSchema, error) {
+	if opts.generator != nil {
+		schemaJSON, err := opts.generator(t, fieldDescs)
+		if err != nil {
+			return nil, fmt.Errorf("generate schema: %w", err)
+		}
+		if !json.Valid(schemaJSON) {
+			return nil, fmt.Errorf("generate schema: schema for %s is not valid JSON", t)
+		}
+		return &generatedSchema{json: schemaJSON}, nil
+	}
+	if len(opts.types) > 0 || len(opts.fields) > 0 {
+		return marshalSchema(t, fieldDescs, opts)
+	}
+	key := schemaCacheKey{
+		typ:                 t,
+		skipUnrepresentable: opts.skipUnrepresentable,
+		strict:              opts.strict,
+		uiHints:             opts.uiHints,
+	}
+	cached, ok := schemaCache.Load(key)
+	if !ok {
+		schema, err := marshalSchema(t, nil, opts)
+		if err != nil {
+			return nil, err
+		}
+		cached, _ = schemaCache.LoadOrStore(key, schema)
+	}
+	schema := cached.(*generatedSchema)
+	if len(fieldDescs) == 0 {
+		return schema, nil
+	}
+	schemaJSON, err := json.Marshal(schema.schema.describe(fieldDescs))
+	if err != nil {
+		return nil, err
+	}
+	return &generatedSchema{schema: schema.schema, json: schemaJSON, skipped: schema.skipped, nullable: schema.nullable}, nil
+}
+
+func marshalSchema(t reflect.Type, fieldDescs map[string]string, opts schemaOptions) (*generatedSchema, error) {
+	g := newSchemaGenerator(opts.types)
+	g.skipUnrepresentable = opts.skipUnrepresentable
+	g.strict = opts.strict
+	g.uiHints = opts.uiHints
+	schema, err := g.generate(t, fieldDescs, opts.fields)
+	if err != nil {
+		return nil, fmt.Errorf("generate schema: %w", err)
+	}
+	for name := range opts.fields {
+		if !g.overridden[name] {
+			return nil, fmt.Errorf("schema override: field %s not found", name)
+		}
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedSchema{schema: schema, json: schemaJSON, skipped: g.skipped, nullable: g.nullable}, nil
+}
+
+// schemaOptions holds the CreateTool options that shape the generated schema:
+// the schemas set with WithTypeSchema and WithSchemaOverride,
+// WithSkipUnrepresentableFields, WithStrictSchema, WithUIHints and
+// WithSchemaGenerator.
+type schemaOptions struct {
+	types               map[reflect.Type]json.RawMessage
+	fields              map[string]json.RawMessage
+	skipUnrepresentable bool
+	strict              bool
+	uiHints             bool
+	generator           SchemaGenerator
+}
+
+func (o schemaOptions) validate() error {
+	for typ, schema := range o.types {
+		if !json.Valid(schema) {
+			return fmt.Errorf("schema for type %s is not valid JSON", typ)
+		}
+	}
+	for name, schema := range o.fields {
+		if !json.Valid(schema) {
+			return fmt.Errorf("schema for field %s is not valid JSON", name)
+		}
+	}
+	return nil
+}
+
 type jsonSchema struct {
-	Type        string                 `json:"type,omitempty"`
-	Description string                 `json:"description,omitempty"`
-	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
-	Required    []string               `json:"required,omitempty"`
-	Items       *jsonSchema            `json:"items,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64               `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Order                []string               `json:"x-order,omitempty"`
+	Group                string                 `json:"x-group,omitempty"`
+
+	// raw, when set, is emitted verbatim in place of the fields above.
+	raw json.RawMessage
+	// fields maps the names of the Properties of a struct, including promoted
+	// ones, to the Go names of the fields they describe, for describe.
+	fields map[string]string
+}
+
+// describe returns s with the descriptions of fieldDescs applied to its fields,
+// as the schema generator applies them. The schemas it changes are copied, so
+// that s, which may be cached, is left as is.
+func (s *jsonSchema) describe(fieldDescs map[string]string) *jsonSchema {
+	if len(fieldDescs) == 0 || s.raw != nil {
+		return s
+	}
+	described := *s
+	switch {
+	case s.fields != nil:
+		described.Properties = maps.Clone(s.Properties)
+		for jsonName, goName := range s.fields {
+			desc, ok := fieldDescs[goName]
+			nested := nestedDescriptions(fieldDescs, goName)
+			if !ok && len(nested) == 0 {
+				continue
+			}
+			property := s.Properties[jsonName].describe(nested)
+			if ok {
+				copied := *property
+				copied.Description = desc
+				property = &copied
+			}
+			described.Properties[jsonName] = property
+		}
+	case s.Items != nil:
+		described.Items = s.Items.describe(fieldDescs)
+	case s.AdditionalProperties != nil:
+		described.AdditionalProperties = s.AdditionalProperties.describe(fieldDescs)
+	}
+	return &described
+}
+
+func (s *jsonSchema) MarshalJSON() ([]byte, error) {
+	if s.raw != nil {
+		return s.raw, nil
+	}
+	type plain jsonSchema
+	return json.Marshal((*plain)(s))
+}
+
+var errUnsupportedType = errors.New("unsupported type")
+
+var (
+	timeType            = reflect.TypeFor[time.Time]()
+	rawMessageType      = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType   = reflect.TypeFor[json.Marshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// customJSONMarshaling reports whether t, or *t, implements json.Marshaler or
+// json.Unmarshaler while not having a primitive kind. Such a type may be encoded
+// as any JSON value, so its Go fields say nothing about its schema.
+func customJSONMarshaling(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Ptr, reflect.Interface:
+		return false
+	}
+	for _, typ := range []reflect.Type{t, reflect.PointerTo(t)} {
+		if typ.Implements(jsonMarshalerType) || typ.Implements(jsonUnmarshalerType) {
+			return true
+		}
+	}
+	return false
+}
+
+// marshalsAsText reports whether encoding/json encodes t, or *t, through
+// encoding.TextMarshaler, that is, as a JSON string.
+func marshalsAsText(t reflect.Type) bool {
+	for _, typ := range []reflect.Type{t, reflect.PointerTo(t)} {
+		if typ.Implements(jsonMarshalerType) {
+			return false
+		}
+		if typ.Implements(textMarshalerType) {
+			return true
+		}
+	}
+	return false
 }
 
+// generateSchema builds the JSON schema of t. time.Time, which marshals to an
+// RFC 3339 string, is described as a date-time string. time.Duration keeps the
+// encoding/json representation: an integer number of nanoseconds.
+// json.RawMessage accepts any JSON value and gets the empty schema, while other
+// byte slices are base64 strings, as encoding/json encodes them. Maps describe
+// their value type with additionalProperties, except map[string]any. The
+// fields of embedded structs are promoted into the parent, as encoding/json does.
+// Types implementing encoding.TextMarshaler, such as net.IP, are strings, while
+// other non-primitive types with custom JSON (un)marshaling accept any value
+// unless their schema is set with WithTypeSchema.
+// Recursive types cannot be expressed without $ref and are rejected.
 func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema, error) {
+	return newSchemaGenerator(nil).generate(t, fieldDescs, nil)
+}
+
+// schemaGenerator holds the state of one schema generation.
+type schemaGenerator struct {
+	typeSchemas map[reflect.Type]json.RawMessage // schemas set with WithTypeSchema
+	visiting    map[reflect.Type]bool            // struct types on the recursion stack
+	overridden  map[string]bool                  // fields whose schema was set with WithSchemaOverride
+
+	// With skipUnrepresentable, fields of unsupported types are left out and their
+	// JSON paths recorded in skipped. path is the JSON path of the current value,
+	// where "*" stands for any element of an array or value of a map.
+	skipUnrepresentable bool
+	path                []string
+	skipped             [][]string
+	nullable            [][]string // JSON paths of pointers, which decode null as nil
+
+	strict  bool // forbid unknown properties in struct objects
+	uiHints bool // emit x-order and x-group for form builders
+}
+
+func newSchemaGenerator(typeSchemas map[reflect.Type]json.RawMessage) *schemaGenerator {
+	return &schemaGenerator{
+		typeSchemas: typeSchemas,
+		visiting:    make(map[reflect.Type]bool),
+		overridden:  make(map[string]bool),
+	}
+}
+
+// generate builds the schema of t. fieldDescs and fieldSchemas apply to the fields
+// of t itself, including promoted ones; descriptions keyed by a dotted path, such
+// as "User.Name", reach the fields of nested structs, through slices and maps too.
+func (g *schemaGenerator) generate(t reflect.Type, fieldDescs map[string]string, fieldSchemas map[string]json.RawMessage) (*jsonSchema, error) {
 	schema := &jsonSchema{}
 
+	if raw, ok := g.typeSchemas[t]; ok {
+		schema.raw = raw
+		return schema, nil
+	}
+
+	switch {
+	case t == timeType:
+		schema.Type = "string"
+		schema.Format = "date-time"
+		return schema, nil
+	case t == rawMessageType:
+		return schema, nil
+	case t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && marshalsAsText(t):
+		schema.Type = "string"
+		return schema, nil
+	case customJSONMarshaling(t):
+		return schema, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		schema.Type = "string"
+		schema.ContentEncoding = "base64"
+		return schema, nil
+	}
+
 	switch t.Kind() {
 	case reflect.Struct:
+		if g.visiting[t] {
+			return nil, fmt.Errorf("cyclic type detected: %s", t)
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
 		schema.Type = "object"
 		schema.Properties = make(map[string]*jsonSchema)
-		var required []string
+		schema.fields = make(map[string]string)
+		var required, order []string
+		// promoted holds the properties taken from embedded structs; the
+		// parent's own fields take precedence over them, as in encoding/json.
+		promoted := make(map[string]bool)
 
 		for i := 0; i < t.NumField(); i++ {
 			field := t.Field(i)
+			if embedded, ok := flattenedEmbed(field); ok {
+				embeddedSchema, err := g.generate(embedded, fieldDescs, fieldSchemas)
+				if err != nil {
+					return nil, fmt.Errorf("embedded %s: %w", field.Name, err)
+				}
+				for name, prop := range embeddedSchema.Properties {
+					if _, exists := schema.Properties[name]; !exists {
+						schema.Properties[name] = prop
+						promoted[name] = true
+						if goName, ok := embeddedSchema.fields[name]; ok {
+							schema.fields[name] = goName
+						}
+					}
+				}
+				for _, name := range embeddedSchema.Order {
+					if promoted[name] && !slices.Contains(order, name) {
+						order = append(order, name)
+					}
+				}
+				// The fields of a nil embedded pointer are omitted, so they are optional.
+				if field.Type.Kind() != reflect.Ptr {
+					for _, name := range embeddedSchema.Required {
+						if promoted[name] && !slices.Contains(required, name) {
+							required = append(required, name)
+						}
+					}
+				}
+				continue
+			}
 			if !field.IsExported() {
 				continue
 			}
@@ -186,9 +1022,35 @@ func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema,
 			if jsonName == "-" {
 				continue
 			}
+			if promoted[jsonName] {
+				delete(promoted, jsonName)
+				required = slices.DeleteFunc(required, func(name string) bool { return name == jsonName })
+				order = slices.DeleteFunc(order, func(name string) bool { return name == jsonName })
+			}
 
-			fieldSchema, err := generateSchema(field.Type, nil)
+			if raw, ok := fieldSchemas[field.Name]; ok {
+				g.overridden[field.Name] = true
+				schema.Properties[jsonName] = &jsonSchema{raw: raw}
+				delete(schema.fields, jsonName)
+				order = append(order, jsonName)
+				if isRequired {
+					required = append(required, jsonName)
+				}
+				continue
+			}
+
+			g.path = append(g.path, jsonName)
+			fieldSchema, err := g.generate(field.Type, nestedDescriptions(fieldDescs, field.Name), nil)
+			g.path = g.path[:len(g.path)-1]
 			if err != nil {
+				if g.skipUnrepresentable && errors.Is(err, errUnsupportedType) {
+					g.skipped = append(g.skipped, append(slices.Clone(g.path), jsonName))
+					continue
+				}
+				return nil, fmt.Errorf("field %s: %w", field.Name, err)
+			}
+
+			if err := applyConstraintTags(field, fieldSchema); err != nil {
 				return nil, fmt.Errorf("field %s: %w", field.Name, err)
 			}
 
@@ -199,7 +1061,13 @@ func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema,
 				fieldSchema.Description = desc
 			}
 
+			if g.uiHints {
+				fieldSchema.Group = field.Tag.Get("group")
+			}
+
 			schema.Properties[jsonName] = fieldSchema
+			schema.fields[jsonName] = field.Name
+			order = append(order, jsonName)
 
 			if isRequired {
 				required = append(required, jsonName)
@@ -209,13 +1077,22 @@ func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema,
 		if len(required) > 0 {
 			schema.Required = required
 		}
+		if g.uiHints && len(order) > 0 {
+			schema.Order = order
+		}
+		if g.strict {
+			schema.AdditionalProperties = &jsonSchema{raw: json.RawMessage("false")}
+		}
 
 	case reflect.Ptr:
-		return generateSchema(t.Elem(), fieldDescs)
+		g.nullable = append(g.nullable, slices.Clone(g.path))
+		return g.generate(t.Elem(), fieldDescs, fieldSchemas)
 
 	case reflect.Slice, reflect.Array:
 		schema.Type = "array"
-		items, err := generateSchema(t.Elem(), nil)
+		g.path = append(g.path, "*")
+		items, err := g.generate(t.Elem(), fieldDescs, nil)
+		g.path = g.path[:len(g.path)-1]
 		if err != nil {
 			return nil, fmt.Errorf("array element: %w", err)
 		}
@@ -226,6 +1103,17 @@ func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema,
 			return nil, fmt.Errorf("map key must be string, got %s", t.Key().Kind())
 		}
 		schema.Type = "object"
+		if t.Elem().Kind() == reflect.Interface {
+			// map[string]any accepts any value; there is nothing to describe.
+			break
+		}
+		g.path = append(g.path, "*")
+		values, err := g.generate(t.Elem(), fieldDescs, nil)
+		g.path = g.path[:len(g.path)-1]
+		if err != nil {
+			return nil, fmt.Errorf("map value: %w", err)
+		}
+		schema.AdditionalProperties = values
 
 	case reflect.Bool:
 		schema.Type = "boolean"
@@ -241,12 +1129,129 @@ func generateSchema(t reflect.Type, fieldDescs map[string]string) (*jsonSchema,
 		schema.Type = "string"
 
 	default:
-		return nil, fmt.Errorf("unsupported type: %s", t.Kind())
+		return nil, fmt.Errorf("%w: %s", errUnsupportedType, t.Kind())
 	}
 
 	return schema, nil
 }
 
+// flattenedEmbed reports whether field is an embedded struct whose fields
+// encoding/json promotes into the parent object, and returns the struct type.
+// An embed with a json name in its tag is encoded as a nested object instead.
+func flattenedEmbed(field reflect.StructField) (reflect.Type, bool) {
+	if !field.Anonymous {
+		return nil, false
+	}
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return nil, false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		if !field.IsExported() {
+			return nil, false
+		}
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType {
+		return nil, false
+	}
+	return typ, true
+}
+
+// schemaFormats are the values accepted by the format struct tag: the string
+// formats defined by JSON Schema.
+var schemaFormats = []string{
+	"date-time", "date", "time", "duration",
+	"email", "idn-email", "hostname", "idn-hostname", "ipv4", "ipv6",
+	"uri", "uri-reference", "iri", "iri-reference", "uri-template", "uuid",
+	"json-pointer", "relative-json-pointer", "regex",
+}
+
+// applyConstraintTags sets the validation keywords given by the field's struct
+// tags: minimum, maximum, exclusiveMinimum and exclusiveMaximum for numbers, and
+// format, minLength, maxLength and pattern for strings. A tag on a field of the
+// wrong type, or with an invalid value, is an error.
+func applyConstraintTags(field reflect.StructField, schema *jsonSchema) error {
+	isString := schema.Type == "string"
+	if format, ok := field.Tag.Lookup("format"); ok {
+		if !isString {
+			return fmt.Errorf("format tag requires a string type, got %s", field.Type)
+		}
+		if !slices.Contains(schemaFormats, format) {
+			return fmt.Errorf("unknown format %q", format)
+		}
+		schema.Format = format
+	}
+	for _, length := range []struct {
+		tag string
+		dst **int
+	}{
+		{"minLength", &schema.MinLength},
+		{"maxLength", &schema.MaxLength},
+	} {
+		value, ok := field.Tag.Lookup(length.tag)
+		if !ok {
+			continue
+		}
+		if !isString {
+			return fmt.Errorf("%s tag requires a string type, got %s", length.tag, field.Type)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid %s tag %q: not a non-negative integer", length.tag, value)
+		}
+		*length.dst = &n
+	}
+	if pattern, ok := field.Tag.Lookup("pattern"); ok {
+		if !isString {
+			return fmt.Errorf("pattern tag requires a string type, got %s", field.Type)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern tag: %w", err)
+		}
+		schema.Pattern = pattern
+	}
+	numeric := schema.Type == "integer" || schema.Type == "number"
+	for _, bound := range []struct {
+		tag string
+		dst **float64
+	}{
+		{"minimum", &schema.Minimum},
+		{"maximum", &schema.Maximum},
+		{"exclusiveMinimum", &schema.ExclusiveMinimum},
+		{"exclusiveMaximum", &schema.ExclusiveMaximum},
+	} {
+		value, ok := field.Tag.Lookup(bound.tag)
+		if !ok {
+			continue
+		}
+		if !numeric {
+			return fmt.Errorf("%s tag requires a numeric type, got %s", bound.tag, field.Type)
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			return fmt.Errorf("invalid %s tag %q: not a finite number", bound.tag, value)
+		}
+		*bound.dst = &n
+	}
+	return nil
+}
+
+// nestedDescriptions returns the descriptions addressed to the fields nested in
+// the struct field name, keyed by their path relative to it.
+func nestedDescriptions(fieldDescs map[string]string, name string) map[string]string {
+	var nested map[string]string
+	for path, desc := range fieldDescs {
+		if rest, ok := strings.CutPrefix(path, name+"."); ok {
+			if nested == nil {
+				nested = make(map[string]string)
+			}
+			nested[rest] = desc
+		}
+	}
+	return nested
+}
+
 func parseFieldTags(field reflect.StructField) (jsonName, description string, required bool) {
 	jsonTag := field.Tag.Get("json")
 	if jsonTag == "-" {
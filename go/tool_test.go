@@ -1,9 +1,18 @@
 package kimi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
 )
 
 // StringResult implements fmt.Stringer for test return values
@@ -42,6 +51,95 @@ func TestCreateTool_Basic(t *testing.T) {
 	}
 }
 
+// searchService is a tool implementation with dependencies, registered through
+// its method values.
+type searchService struct {
+	index []string
+}
+
+func (s *searchService) Search(params SearchParams) (JSONResult, error) {
+	var results []string
+	for _, doc := range s.index {
+		if strings.Contains(doc, params.Query) {
+			results = append(results, doc)
+		}
+	}
+	return JSONResult{"results": results}, nil
+}
+
+func (s searchService) Count(params SearchParams) (int, error) {
+	return len(s.index), nil
+}
+
+func TestCreateTool_MethodValue(t *testing.T) {
+	reference, err := CreateTool(Search)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	service := &searchService{index: []string{"go tools", "rust tools", "go modules"}}
+
+	tests := []struct {
+		name     string
+		fn       func() (Tool, error)
+		expected string
+		result   string
+	}{
+		{"pointer receiver", func() (Tool, error) { return CreateTool(service.Search) }, "go_searchService_Search", `{"results":["go tools","go modules"]}`},
+		{"value receiver", func() (Tool, error) { return CreateTool(service.Count) }, "go_searchService_Count", "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, err := tt.fn()
+			if err != nil {
+				t.Fatalf("CreateTool failed: %v", err)
+			}
+			if tool.def.Name != tt.expected {
+				t.Errorf("expected name %s, got %s", tt.expected, tool.def.Name)
+			}
+			if got, want := string(tool.def.Parameters), string(reference.def.Parameters); got != want {
+				t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, want)
+			}
+			result, err := callText(context.Background(), tool, json.RawMessage(`{"query":"go"}`))
+			if err != nil || result != tt.result {
+				t.Errorf("expected %s, got %q, %v", tt.result, result, err)
+			}
+		})
+	}
+}
+
+func TestCreateTool_Closure(t *testing.T) {
+	reference, err := CreateTool(Search)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	calls := 0
+	prefix := "result for "
+	tool, err := CreateTool(func(params SearchParams) (string, error) {
+		calls++
+		return prefix + params.Query, nil
+	})
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	if tool.def.Name == "" || strings.ContainsAny(tool.def.Name, "./") {
+		t.Errorf("expected a name without dots or slashes, got %s", tool.def.Name)
+	}
+	if got, want := string(tool.def.Parameters), string(reference.def.Parameters); got != want {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	prefix = "results for "
+	for range 2 {
+		result, err := callText(context.Background(), tool, json.RawMessage(`{"query":"go"}`))
+		if err != nil || result != "results for go" {
+			t.Errorf("expected the captured prefix, got %q, %v", result, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected the captured counter to reach 2, got %d", calls)
+	}
+}
+
 func TestCreateTool_WithOptions(t *testing.T) {
 	tool, err := CreateTool(Search,
 		WithName("custom_search"),
@@ -116,7 +214,7 @@ func TestCreateTool_Call(t *testing.T) {
 	}
 
 	args := json.RawMessage(`{"query":"test","limit":10}`)
-	result, err := tool.call(args)
+	result, err := callText(context.Background(), tool, args)
 	if err != nil {
 		t.Fatalf("call failed: %v", err)
 	}
@@ -135,6 +233,51 @@ func TestCreateTool_Call(t *testing.T) {
 	}
 }
 
+func TestCreateTool_PointerParams(t *testing.T) {
+	var received *SearchParams
+	search := func(params *SearchParams) (string, error) {
+		received = params
+		return params.Query, nil
+	}
+	pointerTool, err := CreateTool(search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	valueTool, err := CreateTool(Search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if string(pointerTool.def.Parameters) != string(valueTool.def.Parameters) {
+		t.Errorf("expected the schema of the value parameter:\ngot:  %s\nwant: %s", pointerTool.def.Parameters, valueTool.def.Parameters)
+	}
+
+	result, err := callText(context.Background(), pointerTool, json.RawMessage(`{"query":"test","limit":10}`))
+	if err != nil || result != "test" {
+		t.Fatalf("expected test, got %q, %v", result, err)
+	}
+	if received == nil || *received != (SearchParams{Query: "test", Limit: 10}) {
+		t.Errorf("unexpected parameters: %+v", received)
+	}
+
+	// Each call decodes into a new value, never nil.
+	previous := received
+	if _, err := callText(context.Background(), pointerTool, json.RawMessage(`null`)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if received == nil || received == previous || *received != (SearchParams{}) {
+		t.Errorf("expected a new zero value, got %+v", received)
+	}
+
+	var params *SearchParams
+	if err := pointerTool.DecodeArgs(json.RawMessage(`{"query":"go"}`), &params); err == nil {
+		t.Error("expected DecodeArgs to reject a **SearchParams")
+	}
+	var decoded SearchParams
+	if err := pointerTool.DecodeArgs(json.RawMessage(`{"query":"go"}`), &decoded); err != nil || decoded.Query != "go" {
+		t.Errorf("expected DecodeArgs to decode into a *SearchParams, got %+v, %v", decoded, err)
+	}
+}
+
 type NestedParams struct {
 	User    UserInfo `json:"user"`
 	Tags    []string `json:"tags,omitempty"`
@@ -344,6 +487,12 @@ func TestCreateTool_NonStructParam(t *testing.T) {
 	}
 }
 
+// callText calls tool and returns the text of its result.
+func callText(ctx context.Context, tool Tool, args json.RawMessage) (string, error) {
+	returnValue, err := tool.call(ctx, args)
+	return returnValue.Output.Text.Value, err
+}
+
 // Test stringifyResult with different return types
 
 type SimpleArgs struct {
@@ -361,7 +510,7 @@ func TestCreateTool_ReturnString(t *testing.T) {
 		t.Fatalf("CreateTool failed: %v", err)
 	}
 
-	result, err := tool.call(json.RawMessage(`{"input":"test"}`))
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"input":"test"}`))
 	if err != nil {
 		t.Fatalf("call failed: %v", err)
 	}
@@ -383,7 +532,7 @@ func TestCreateTool_ReturnStringer(t *testing.T) {
 		t.Fatalf("CreateTool failed: %v", err)
 	}
 
-	result, err := tool.call(json.RawMessage(`{"input":"test"}`))
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"input":"test"}`))
 	if err != nil {
 		t.Fatalf("call failed: %v", err)
 	}
@@ -410,7 +559,7 @@ func TestCreateTool_ReturnStruct(t *testing.T) {
 		t.Fatalf("CreateTool failed: %v", err)
 	}
 
-	result, err := tool.call(json.RawMessage(`{"input":"hello"}`))
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"input":"hello"}`))
 	if err != nil {
 		t.Fatalf("call failed: %v", err)
 	}
@@ -428,6 +577,115 @@ func TestCreateTool_ReturnStruct(t *testing.T) {
 	}
 }
 
+func TestCreateTool_ReturnBinary(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	tests := []struct {
+		name     string
+		result   any
+		expected wire.Content
+	}{
+		{"image", BinaryResult{MIME: "image/png", Data: png}, wire.NewContent(wire.NewImageContentPart("data:image/png;base64,iVBORw0KGgo="))},
+		{"pointer", &BinaryResult{MIME: "image/png", Data: png}, wire.NewContent(wire.NewImageContentPart("data:image/png;base64,iVBORw0KGgo="))},
+		{"audio", BinaryResult{MIME: "audio/wav", Data: []byte("RIFF")}, wire.NewContent(wire.NewAudioContentPart("data:audio/wav;base64,UklGRg=="))},
+		{"archive", BinaryResult{MIME: "application/zip", Data: []byte("PK")}, wire.NewContent(wire.NewTextContentPart("data:application/zip;base64,UEs="))},
+		{"no type", BinaryResult{Data: []byte("PK")}, wire.NewContent(wire.NewTextContentPart("data:application/octet-stream;base64,UEs="))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, err := CreateTool(func(args SimpleArgs) (any, error) {
+				return tt.result, nil
+			}, WithName("render"))
+			if err != nil {
+				t.Fatalf("CreateTool failed: %v", err)
+			}
+			returnValue, err := tool.call(context.Background(), json.RawMessage(`{"input":"x"}`))
+			if err != nil {
+				t.Fatalf("call failed: %v", err)
+			}
+			if !reflect.DeepEqual(returnValue.Output, tt.expected) {
+				t.Errorf("output mismatch:\ngot:  %+v\nwant: %+v", returnValue.Output, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCreateTool_ReturnNilMap(t *testing.T) {
+	tool, err := CreateTool(func(args SimpleArgs) (map[string]int, error) {
+		return nil, nil
+	}, WithName("counts"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"input":"hello"}`))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if result != "{}" {
+		t.Errorf("expected nil map to serialize as {}, got %s", result)
+	}
+}
+
+type GenericArgs[T any] struct {
+	Value T      `json:"value" description:"The value to echo"`
+	Note  string `json:"note,omitempty"`
+}
+
+func EchoGeneric[T any](args GenericArgs[T]) (T, error) {
+	return args.Value, nil
+}
+
+func TestCreateTool_InstantiatedGeneric(t *testing.T) {
+	tool, err := CreateTool(EchoGeneric[int], WithName("echo_int"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+
+	expected := `{"type":"object","properties":{"note":{"type":"string"},"value":{"type":"integer","description":"The value to echo"}},"required":["value"]}`
+	if got := string(tool.def.Parameters); got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"value":42}`))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if result != "42" {
+		t.Errorf("expected result=42, got %s", result)
+	}
+}
+
+func TestCreateTool_InstantiatedGeneric_DistinctInstantiations(t *testing.T) {
+	strTool, err := CreateTool(EchoGeneric[string], WithName("echo_string"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	sliceTool, err := CreateTool(EchoGeneric[[]string], WithName("echo_strings"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+
+	if got, want := string(strTool.def.Parameters), `{"type":"object","properties":{"note":{"type":"string"},"value":{"type":"string","description":"The value to echo"}},"required":["value"]}`; got != want {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, want)
+	}
+	if got, want := string(sliceTool.def.Parameters), `{"type":"object","properties":{"note":{"type":"string"},"value":{"type":"array","description":"The value to echo","items":{"type":"string"}}},"required":["value"]}`; got != want {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestCreateTool_InstantiatedGeneric_AutoName(t *testing.T) {
+	tool, err := CreateTool(EchoGeneric[string])
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	if tool.def.Name == "" {
+		t.Fatal("expected non-empty name")
+	}
+	if strings.ContainsAny(tool.def.Name, "[]") {
+		t.Errorf("expected type arguments to be stripped from name, got %s", tool.def.Name)
+	}
+}
+
 // ============================================================================
 // generateSchema tests - direct JSON schema string comparison
 // ============================================================================
@@ -598,152 +856,1199 @@ func TestGenerateSchema_Pointer(t *testing.T) {
 	}
 }
 
-func TestGenerateSchema_PointerAlwaysOptional(t *testing.T) {
-	type StructWithPointer struct {
-		Required string  `json:"required"`
-		Optional *string `json:"optional"`
+func TestGenerateSchema_Time(t *testing.T) {
+	expected := `{"type":"string","format":"date-time"}`
+	for _, typ := range []reflect.Type{reflect.TypeFor[time.Time](), reflect.TypeFor[*time.Time]()} {
+		if got := mustMarshalSchema(t, typ, nil); got != expected {
+			t.Errorf("%s schema mismatch:\ngot:  %s\nwant: %s", typ, got, expected)
+		}
 	}
+}
 
-	got := mustMarshalSchema(t, reflect.TypeFor[StructWithPointer](), nil)
-	expected := `{"type":"object","properties":{"optional":{"type":"string"},"required":{"type":"string"}},"required":["required"]}`
+func TestGenerateSchema_Duration(t *testing.T) {
+	got := mustMarshalSchema(t, reflect.TypeFor[time.Duration](), nil)
+	expected := `{"type":"integer"}`
 
 	if got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
 }
 
-func TestGenerateSchema_MapStringKey(t *testing.T) {
-	got := mustMarshalSchema(t, reflect.TypeFor[map[string]int](), nil)
-	expected := `{"type":"object"}`
+func TestCreateTool_TimeFields(t *testing.T) {
+	type ScheduleArgs struct {
+		At       time.Time     `json:"at" description:"When to run"`
+		Until    *time.Time    `json:"until"`
+		Interval time.Duration `json:"interval"`
+	}
+	tool, err := CreateTool(func(args ScheduleArgs) (string, error) {
+		return args.At.Add(args.Interval).Format(time.RFC3339), nil
+	}, WithName("schedule"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
 
-	if got != expected {
+	expected := `{"type":"object","properties":{"at":{"type":"string","format":"date-time","description":"When to run"},"interval":{"type":"integer"},"until":{"type":"string","format":"date-time"}},"required":["at","interval"]}`
+	if got := string(tool.def.Parameters); got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
-}
 
-func TestGenerateSchema_MapNonStringKey(t *testing.T) {
-	_, err := generateSchema(reflect.TypeFor[map[int]string](), nil)
-	if err == nil {
-		t.Error("expected error for map with non-string key, got nil")
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"at":"2026-01-02T03:04:05Z","interval":60000000000}`))
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if result != "2026-01-02T03:05:05Z" {
+		t.Errorf("unexpected result: %s", result)
 	}
 }
 
-func TestGenerateSchema_NestedStruct(t *testing.T) {
-	type Inner struct {
-		Value string `json:"value"`
-	}
-	type Outer struct {
-		Inner Inner `json:"inner"`
+type logLevel int
+
+func (l logLevel) MarshalText() ([]byte, error) {
+	return []byte([]string{"debug", "info", "error"}[l]), nil
+}
+
+func (l *logLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 0
+	case "info":
+		*l = 1
+	case "error":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %q", text)
+	}
+	return nil
+}
+
+type semver struct {
+	Major, Minor, Patch int
+}
+
+func (v *semver) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "%d.%d.%d", v.Major, v.Minor, v.Patch), nil
+}
+
+func (v *semver) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%d.%d.%d", &v.Major, &v.Minor, &v.Patch)
+	return err
+}
+
+func TestGenerateSchema_TextMarshaler(t *testing.T) {
+	type Args struct {
+		Host    net.IP     `json:"host"`
+		Addr    netip.Addr `json:"addr"`
+		Level   logLevel   `json:"level"`
+		Version semver     `json:"version"`
+		Backup  *net.IP    `json:"backup"`
 	}
 
-	got := mustMarshalSchema(t, reflect.TypeFor[Outer](), nil)
-	expected := `{"type":"object","properties":{"inner":{"type":"object","properties":{"value":{"type":"string"}},"required":["value"]}},"required":["inner"]}`
+	got := mustMarshalSchema(t, reflect.TypeFor[Args](), nil)
+	expected := `{"type":"object","properties":{"addr":{"type":"string"},"backup":{"type":"string"},"host":{"type":"string"},"level":{"type":"string"},"version":{"type":"string"}},"required":["host","addr","level","version"]}`
 
 	if got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
 }
 
-func TestGenerateSchema_DeepNested(t *testing.T) {
-	type Level3 struct {
-		Data string `json:"data"`
+func TestCreateTool_TextMarshalerArgs(t *testing.T) {
+	type Args struct {
+		Host    net.IP   `json:"host"`
+		Level   logLevel `json:"level"`
+		Version semver   `json:"version"`
 	}
-	type Level2 struct {
-		Level3 Level3 `json:"level3"`
+	tool, err := CreateTool(func(args Args) (string, error) {
+		return fmt.Sprintf("%s %d %d.%d.%d", args.Host, args.Level, args.Version.Major, args.Version.Minor, args.Version.Patch), nil
+	}, WithName("text_args"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
 	}
-	type Level1 struct {
-		Level2 Level2 `json:"level2"`
+
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"host":"10.0.0.1","level":"error","version":"1.2.3"}`))
+	if err != nil {
+		t.Fatalf("call: %v", err)
 	}
-	type Root struct {
-		Level1 Level1 `json:"level1"`
+	if result != "10.0.0.1 2 1.2.3" {
+		t.Errorf("unexpected result %q", result)
 	}
+}
 
-	got := mustMarshalSchema(t, reflect.TypeFor[Root](), nil)
-	expected := `{"type":"object","properties":{"level1":{"type":"object","properties":{"level2":{"type":"object","properties":{"level3":{"type":"object","properties":{"data":{"type":"string"}},"required":["data"]}},"required":["level3"]}},"required":["level2"]}},"required":["level1"]}`
+// money marshals to a string such as "12.50 EUR", which its fields do not reveal.
+type money struct {
+	Cents    int64
+	Currency string
+}
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency))
+}
+
+// priority is an integer with custom JSON; its primitive schema is kept.
+type priority int
+
+func (p *priority) UnmarshalJSON(data []byte) error {
+	var n int
+	err := json.Unmarshal(data, &n)
+	*p = priority(n)
+	return err
+}
+
+func TestGenerateSchema_JSONMarshaler(t *testing.T) {
+	type Args struct {
+		Price    money    `json:"price"`
+		Priority priority `json:"priority"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Args](), nil)
+	expected := `{"type":"object","properties":{"price":{},"priority":{"type":"integer"}},"required":["price","priority"]}`
 
 	if got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
 }
 
-func TestGenerateSchema_SliceOfStructs(t *testing.T) {
-	type Item struct {
-		Name string `json:"name"`
+func TestCreateTool_WithTypeSchema(t *testing.T) {
+	type Args struct {
+		Price  money   `json:"price" description:"Unit price"`
+		Extras []money `json:"extras,omitempty"`
+	}
+	tool, err := CreateTool(func(args Args) (string, error) { return "", nil },
+		WithName("pricing"),
+		WithTypeSchema[money](json.RawMessage(`{"type": "string", "pattern": "^[0-9]+\\.[0-9]{2} [A-Z]{3}$"}`)),
+	)
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	expected := `{"type":"object","properties":{"extras":{"type":"array","items":{"type":"string","pattern":"^[0-9]+\\.[0-9]{2} [A-Z]{3}$"}},"price":{"type":"string","pattern":"^[0-9]+\\.[0-9]{2} [A-Z]{3}$"}},"required":["price"]}`
+	if got := string(tool.def.Parameters); got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
 
-	got := mustMarshalSchema(t, reflect.TypeFor[[]Item](), nil)
-	expected := `{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}}`
+	if _, err := CreateTool(func(args Args) (string, error) { return "", nil },
+		WithName("pricing"),
+		WithTypeSchema[money](json.RawMessage(`{"type":`)),
+	); err == nil {
+		t.Error("expected an error for an invalid type schema")
+	}
+}
 
-	if got != expected {
+func TestCreateTool_WithSchemaOverride(t *testing.T) {
+	type Args struct {
+		Target any    `json:"target"`
+		Unit   string `json:"unit,omitempty" description:"Length unit"`
+		Query  string `json:"query" description:"Search query"`
+	}
+	tool, err := CreateTool(func(args Args) (string, error) { return "", nil },
+		WithName("measure"),
+		WithSchemaOverride("Target", json.RawMessage(`{"oneOf": [{"type": "string"}, {"type": "integer"}]}`)),
+		WithSchemaOverride("Unit", json.RawMessage(`{"enum": ["cm", "in"]}`)),
+	)
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	expected := `{"type":"object","properties":{"query":{"type":"string","description":"Search query"},"target":{"oneOf":[{"type":"string"},{"type":"integer"}]},"unit":{"enum":["cm","in"]}},"required":["target","query"]}`
+	if got := string(tool.def.Parameters); got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
-}
 
-func TestGenerateSchema_UnsupportedTypes(t *testing.T) {
 	tests := []struct {
-		name string
-		typ  reflect.Type
+		name   string
+		option ToolOption
+		want   string
 	}{
-		{"interface", reflect.TypeFor[any]()},
-		{"func", reflect.TypeFor[func()]()},
-		{"chan", reflect.TypeFor[chan int]()},
-		{"complex64", reflect.TypeFor[complex64]()},
-		{"complex128", reflect.TypeFor[complex128]()},
+		{"unknown field", WithSchemaOverride("Missing", json.RawMessage(`{}`)), "field Missing not found"},
+		{"invalid JSON", WithSchemaOverride("Target", json.RawMessage(`{"type"`)), "schema for field Target is not valid JSON"},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := generateSchema(tt.typ, nil)
-			if err == nil {
-				t.Errorf("expected error for unsupported type %s, got nil", tt.name)
+			_, err := CreateTool(func(args Args) (string, error) { return "", nil },
+				WithName("measure"),
+				WithSchemaOverride("Target", json.RawMessage(`{}`)),
+				tt.option,
+			)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
 			}
 		})
 	}
 }
 
-func TestGenerateSchema_FieldDescsOverride(t *testing.T) {
-	type StructWithDesc struct {
-		Field string `json:"field" description:"original"`
+func TestCreateTool_WithSkipUnrepresentableFields(t *testing.T) {
+	type Item struct {
+		Name    string `json:"name"`
+		Handler func() `json:"handler"`
 	}
-
-	fieldDescs := map[string]string{
-		"Field": "overridden",
+	type Args struct {
+		Query    string `json:"query"`
+		Metadata any    `json:"metadata"`
+		Items    []Item `json:"items"`
 	}
 
-	got := mustMarshalSchema(t, reflect.TypeFor[StructWithDesc](), fieldDescs)
-	expected := `{"type":"object","properties":{"field":{"type":"string","description":"overridden"}},"required":["field"]}`
+	if _, err := CreateTool(func(args Args) (string, error) { return "", nil }, WithName("skip")); err == nil {
+		t.Fatal("expected an error without WithSkipUnrepresentableFields")
+	}
 
-	if got != expected {
+	tool, err := CreateTool(func(args Args) (string, error) {
+		return fmt.Sprintf("%s %v %d", args.Query, args.Metadata, len(args.Items)), nil
+	}, WithName("skip"), WithSkipUnrepresentableFields())
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	expected := `{"type":"object","properties":{"items":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}},"query":{"type":"string"}},"required":["query","items"]}`
+	if got := string(tool.def.Parameters); got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
-}
 
-func TestGenerateSchema_FieldDescsNotPassedToNested(t *testing.T) {
-	type Inner struct {
-		Value string `json:"value" description:"inner desc"`
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"query":"q","metadata":{"a":1},"items":[{"name":"x","handler":"noop"}]}`))
+	if err != nil {
+		t.Fatalf("call: %v", err)
 	}
-	type Outer struct {
-		Inner Inner `json:"inner"`
+	if result != "q <nil> 1" {
+		t.Errorf("expected skipped fields to be ignored when decoding, got %q", result)
 	}
+}
 
-	fieldDescs := map[string]string{
-		"Value": "should not apply to nested",
+func TestCreateTool_WithStrictSchema(t *testing.T) {
+	type Filter struct {
+		Field string `json:"field"`
 	}
+	type Args struct {
+		Query   string            `json:"query"`
+		Filters []Filter          `json:"filters"`
+		Labels  map[string]string `json:"labels,omitempty"`
+	}
+	fn := func(args Args) (string, error) { return "", nil }
 
-	got := mustMarshalSchema(t, reflect.TypeFor[Outer](), fieldDescs)
-	// Inner.Value should keep "inner desc" since fieldDescs is not passed to nested
-	expected := `{"type":"object","properties":{"inner":{"type":"object","properties":{"value":{"type":"string","description":"inner desc"}},"required":["value"]}},"required":["inner"]}`
-
-	if got != expected {
+	tool, err := CreateTool(fn, WithName("strict"), WithStrictSchema())
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	expected := `{"type":"object","properties":{"filters":{"type":"array","items":{"type":"object","properties":{"field":{"type":"string"}},"required":["field"],"additionalProperties":false}},"labels":{"type":"object","additionalProperties":{"type":"string"}},"query":{"type":"string"}},"required":["query","filters"],"additionalProperties":false}`
+	if got := string(tool.def.Parameters); got != expected {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
+
+	tool, err = CreateTool(fn, WithName("lenient"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if strings.Contains(string(tool.def.Parameters), `"additionalProperties":false`) {
+		t.Errorf("expected the default schema to allow additional properties, got %s", tool.def.Parameters)
+	}
 }
 
-func TestGenerateSchema_ComplexStruct(t *testing.T) {
+func TestCreateTool_WithUIHints(t *testing.T) {
 	type Address struct {
-		City string `json:"city"`
+		Street string `json:"street" group:"address"`
+		City   string `json:"city" group:"address"`
 	}
-	type Person struct {
+	type Args struct {
+		Name string `json:"name" group:"contact"`
+		Address
+		Email string  `json:"email" group:"contact"`
+		Notes *string `json:"notes"`
+	}
+	fn := func(args Args) (string, error) { return "", nil }
+
+	tool, err := CreateTool(fn, WithName("form"), WithUIHints())
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	expected := `{"type":"object","properties":{"city":{"type":"string","x-group":"address"},"email":{"type":"string","x-group":"contact"},"name":{"type":"string","x-group":"contact"},"notes":{"type":"string"},"street":{"type":"string","x-group":"address"}},"required":["name","street","city","email"],"x-order":["name","street","city","email","notes"]}`
+	if got := string(tool.def.Parameters); got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+
+	tool, err = CreateTool(fn, WithName("plain"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if got := string(tool.def.Parameters); strings.Contains(got, "x-order") || strings.Contains(got, "x-group") {
+		t.Errorf("expected no UI hints without WithUIHints, got %s", got)
+	}
+}
+
+type contextKey struct{}
+
+func LookupWithContext(ctx context.Context, args SimpleArgs) (string, error) {
+	return ctx.Value(contextKey{}).(string) + ":" + args.Input, nil
+}
+
+func TestCreateToolContext(t *testing.T) {
+	tool, err := CreateToolContext(LookupWithContext, WithName("lookup"))
+	if err != nil {
+		t.Fatalf("CreateToolContext: %v", err)
+	}
+	expected := mustMarshalSchema(t, reflect.TypeFor[SimpleArgs](), nil)
+	if got := string(tool.def.Parameters); got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+
+	ctx := context.WithValue(context.Background(), contextKey{}, "turn")
+	result, err := callText(ctx, tool, json.RawMessage(`{"input":"x"}`))
+	if err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	if result != "turn:x" {
+		t.Errorf("expected the context to be passed to the function, got %q", result)
+	}
+}
+
+func TestCreateTool_WithToolTimeout(t *testing.T) {
+	cancelled := make(chan error, 1)
+	honoring, err := CreateToolContext(func(ctx context.Context, args SimpleArgs) (string, error) {
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+		return "", ctx.Err()
+	}, WithName("hang"), WithToolTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("CreateToolContext: %v", err)
+	}
+	if _, err := callText(context.Background(), honoring, json.RawMessage(`{"input":"x"}`)); err == nil || !strings.Contains(err.Error(), "timed out after 20ms") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the function to observe the deadline, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the function's context to be cancelled")
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	ignoring, err := CreateTool(func(args SimpleArgs) (string, error) {
+		<-release
+		return "late", nil
+	}, WithName("stuck"), WithToolTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	start := time.Now()
+	if _, err := callText(context.Background(), ignoring, json.RawMessage(`{"input":"x"}`)); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the call to return at the timeout, took %s", elapsed)
+	}
+
+	fast, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return args.Input, nil
+	}, WithName("fast"), WithToolTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if result, err := callText(context.Background(), fast, json.RawMessage(`{"input":"x"}`)); err != nil || result != "x" {
+		t.Errorf("expected the result within the timeout, got %q, %v", result, err)
+	}
+}
+
+func TestCreateTool_WithArgumentValidation(t *testing.T) {
+	type Filter struct {
+		Field string `json:"field"`
+		Op    string `json:"op"`
+	}
+	type SearchArgs struct {
+		Query   string   `json:"query" minLength:"1"`
+		Limit   int      `json:"limit" minimum:"1" maximum:"100"`
+		Order   string   `json:"order,omitempty"`
+		Filters []Filter `json:"filters,omitempty"`
+	}
+	called := false
+	search := func(args SearchArgs) (string, error) {
+		called = true
+		return args.Query, nil
+	}
+	tool, err := CreateTool(search, WithName("search"), WithArgumentValidation(),
+		WithSchemaOverride("Order", json.RawMessage(`{"type":"string","enum":["asc","desc"]}`)))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		args       string
+		violations []string
+	}{
+		{"valid", `{"query":"go","limit":10,"order":"asc","filters":[{"field":"lang","op":"eq"}]}`, nil},
+		{"missing required field", `{"query":"go"}`, []string{`arguments: missing required field "limit"`}},
+		{"wrong type", `{"query":"go","limit":"ten"}`, []string{"limit: expected integer, got string"}},
+		{"not an integer", `{"query":"go","limit":1.5}`, []string{"limit: expected integer, got number"}},
+		{"numeric bound", `{"query":"go","limit":500}`, []string{"limit: must be <= 100, got 500"}},
+		{"string length", `{"query":"","limit":1}`, []string{"query: must be at least 1 characters long, got 0"}},
+		{"enum", `{"query":"go","limit":1,"order":"random"}`, []string{`order: must be one of ["asc","desc"]`}},
+		{"nested field", `{"query":"go","limit":1,"filters":[{"field":"lang","op":1}]}`, []string{"filters[0].op: expected string, got number"}},
+		{"several violations", `{"limit":0,"filters":[{"op":"eq"}]}`, []string{
+			`arguments: missing required field "query"`,
+			`filters[0]: missing required field "field"`,
+			"limit: must be >= 1, got 0",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			_, err := callText(context.Background(), tool, json.RawMessage(tt.args))
+			if tt.violations == nil {
+				if err != nil || !called {
+					t.Fatalf("expected the call to go through, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected a validation error")
+			}
+			if called {
+				t.Error("expected the function not to be called")
+			}
+			if expected := "invalid arguments:\n- " + strings.Join(tt.violations, "\n- "); err.Error() != expected {
+				t.Errorf("error mismatch:\ngot:  %s\nwant: %s", err, expected)
+			}
+		})
+	}
+
+	lenient, err := CreateTool(search, WithName("search"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if _, err := callText(context.Background(), lenient, json.RawMessage(`{"query":"go"}`)); err != nil {
+		t.Errorf("expected arguments not to be validated by default, got %v", err)
+	}
+}
+
+func TestCreateTool_WithArgumentValidation_NullPointer(t *testing.T) {
+	type Page struct {
+		Size *int `json:"size,omitempty"`
+	}
+	type ListArgs struct {
+		Query  string             `json:"query"`
+		Limit  *int               `json:"limit,omitempty"`
+		Page   *Page              `json:"page,omitempty"`
+		Labels []*string          `json:"labels,omitempty"`
+		Extra  map[string]*string `json:"extra,omitempty"`
+	}
+	tool, err := CreateTool(func(args ListArgs) (string, error) {
+		return args.Query, nil
+	}, WithName("list"), WithArgumentValidation())
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	for _, args := range []string{
+		`{"query":"go","limit":null}`,
+		`{"query":"go","page":null}`,
+		`{"query":"go","page":{"size":null}}`,
+		`{"query":"go","labels":["a",null]}`,
+		`{"query":"go","extra":{"a":null}}`,
+	} {
+		if _, err := callText(context.Background(), tool, json.RawMessage(args)); err != nil {
+			t.Errorf("expected null to be accepted for a pointer in %s, got %v", args, err)
+		}
+	}
+	_, err = callText(context.Background(), tool, json.RawMessage(`{"query":null}`))
+	if err == nil || !strings.Contains(err.Error(), "query: expected string, got null") {
+		t.Errorf("expected null to be rejected for a non-pointer field, got %v", err)
+	}
+}
+
+func TestCreateTool_WithArgValidator(t *testing.T) {
+	type TransferArgs struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		Amount int    `json:"amount"`
+	}
+	called := false
+	transfer := func(args TransferArgs) (string, error) {
+		called = true
+		return "transferred", nil
+	}
+	tool, err := CreateTool(transfer, WithName("transfer"), WithArgValidator(func(args TransferArgs) error {
+		if args.From == args.To {
+			return errors.New("cannot transfer to the same account")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	if result, err := callText(context.Background(), tool, json.RawMessage(`{"from":"a","to":"b","amount":1}`)); err != nil || result != "transferred" || !called {
+		t.Fatalf("expected the call to go through, got %q, %v", result, err)
+	}
+	called = false
+	if _, err := callText(context.Background(), tool, json.RawMessage(`{"from":"a","to":"a","amount":1}`)); err == nil || err.Error() != "cannot transfer to the same account" {
+		t.Errorf("expected the validation error, got %v", err)
+	}
+	if called {
+		t.Error("expected the function not to be called")
+	}
+
+	if _, err := CreateTool(transfer, WithArgValidator(func(args SimpleArgs) error { return nil })); err == nil {
+		t.Error("expected an error for a validator of another type")
+	}
+}
+
+func TestCreateTool_NilFunction(t *testing.T) {
+	var search func(SearchParams) (string, error)
+	if _, err := CreateTool(search); err == nil || err.Error() != "tool function must not be nil" {
+		t.Errorf("expected a nil function error, got %v", err)
+	}
+	if _, err := CreateTool(search, WithName("search")); err == nil || err.Error() != `tool "search": function must not be nil` {
+		t.Errorf("expected a nil function error naming the tool, got %v", err)
+	}
+
+	var searchContext func(context.Context, SearchParams) (string, error)
+	if _, err := CreateToolContext(searchContext, WithName("search")); err == nil {
+		t.Error("expected an error for a nil function passed to CreateToolContext")
+	}
+	if _, err := CreateToolFromSchema("search", "", json.RawMessage(`{"type":"object"}`), nil); err == nil {
+		t.Error("expected an error for a nil handler passed to CreateToolFromSchema")
+	}
+}
+
+func TestCreateToolFromSchema(t *testing.T) {
+	schema := json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"},"days":{"type":"integer","minimum":1}},"required":["city"]}`)
+	var received json.RawMessage
+	tool, err := CreateToolFromSchema("forecast", "Get the weather forecast", schema, func(args json.RawMessage) (string, error) {
+		received = args
+		return "sunny", nil
+	}, WithArgumentValidation())
+	if err != nil {
+		t.Fatalf("CreateToolFromSchema: %v", err)
+	}
+	if tool.def.Name != "forecast" || tool.def.Description != "Get the weather forecast" {
+		t.Errorf("unexpected definition: %+v", tool.def)
+	}
+	if string(tool.def.Parameters) != string(schema) {
+		t.Errorf("expected the schema as is:\ngot:  %s\nwant: %s", tool.def.Parameters, schema)
+	}
+
+	args := json.RawMessage(`{"city":"Paris","days":3,"units":"metric"}`)
+	result, err := callText(context.Background(), tool, args)
+	if err != nil || result != "sunny" {
+		t.Errorf("expected sunny, got %q, %v", result, err)
+	}
+	if string(received) != string(args) {
+		t.Errorf("expected the raw arguments %s, got %s", args, received)
+	}
+	if _, err := callText(context.Background(), tool, json.RawMessage(`{"days":0}`)); err == nil || !strings.Contains(err.Error(), `missing required field "city"`) {
+		t.Errorf("expected the arguments to be validated against the schema, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		name, toolName string
+		schema         json.RawMessage
+		expectedErr    string
+	}{
+		{"empty name", "", schema, "name must not be empty"},
+		{"invalid schema", "forecast", json.RawMessage(`{"type"`), "not valid JSON"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CreateToolFromSchema(tt.toolName, "", tt.schema, func(json.RawMessage) (string, error) { return "", nil })
+			if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestTool_DecodeArgs(t *testing.T) {
+	type WriteArgs struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+		Hook    func() `json:"hook,omitempty"`
+	}
+	tool, err := CreateTool(func(args WriteArgs) (string, error) {
+		return "", nil
+	}, WithName("write_file"), WithSkipUnrepresentableFields())
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+
+	// Assemble the arguments of a streamed tool call from its fragments.
+	call := wire.ToolCall{
+		ID:       "call-1",
+		Function: wire.ToolCallFunction{Name: "write_file", Arguments: wire.Optional[string]{Value: `{"path":`, Valid: true}},
+	}
+	parts := []wire.ToolCallPart{
+		{ArgumentsPart: wire.Optional[string]{Value: `"/tmp/a.txt","content":"hel`, Valid: true}},
+		{ArgumentsPart: wire.Optional[string]{Value: `lo","hook":"noop"}`, Valid: true}},
+	}
+	var raw strings.Builder
+	raw.WriteString(call.Function.Arguments.Value)
+	for _, part := range parts {
+		raw.WriteString(part.ArgumentsPart.Value)
+	}
+
+	var args WriteArgs
+	if err := tool.DecodeArgs(json.RawMessage(raw.String()), &args); err != nil {
+		t.Fatalf("DecodeArgs: %v", err)
+	}
+	if args.Path != "/tmp/a.txt" || args.Content != "hello" {
+		t.Errorf("unexpected arguments: %+v", args)
+	}
+
+	var other struct{ Path string }
+	if err := tool.DecodeArgs(json.RawMessage(`{"path":"/tmp/a.txt"}`), &other); err == nil {
+		t.Error("expected an error when decoding into another type")
+	}
+	if err := tool.DecodeArgs(json.RawMessage(`{"path":`), &args); err == nil {
+		t.Error("expected an error for incomplete arguments")
+	}
+}
+
+func TestCreateTool_WithSchemaGenerator(t *testing.T) {
+	var gotType reflect.Type
+	var gotDescs map[string]string
+	generate := func(typ reflect.Type, fieldDescs map[string]string) (json.RawMessage, error) {
+		gotType, gotDescs = typ, fieldDescs
+		return json.RawMessage(`{"$schema":"https://json-schema.org/draft-07/schema","type":"object","x-kind":"custom"}`), nil
+	}
+	tool, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return args.Input, nil
+	}, WithName("custom"), WithSchemaGenerator(generate), WithFieldDescription("Input", "The input"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	if got := string(tool.def.Parameters); got != `{"$schema":"https://json-schema.org/draft-07/schema","type":"object","x-kind":"custom"}` {
+		t.Errorf("expected the custom schema, got %s", got)
+	}
+	if gotType != reflect.TypeFor[SimpleArgs]() || gotDescs["Input"] != "The input" {
+		t.Errorf("unexpected generator arguments: %v, %v", gotType, gotDescs)
+	}
+
+	result, err := callText(context.Background(), tool, json.RawMessage(`{"input":"hi"}`))
+	if err != nil || result != "hi" {
+		t.Errorf("expected arguments to be decoded as usual, got %q, %v", result, err)
+	}
+
+	if _, err := tool.withDoc(ToolDoc{Fields: map[string]string{"Input": "Localized"}}); err != nil {
+		t.Fatalf("withDoc: %v", err)
+	}
+	if gotDescs["Input"] != "Localized" {
+		t.Errorf("expected catalog descriptions to reach the generator, got %v", gotDescs)
+	}
+
+	failing := func(reflect.Type, map[string]string) (json.RawMessage, error) {
+		return nil, errors.New("unsupported")
+	}
+	if _, err := CreateTool(func(args SimpleArgs) (string, error) { return "", nil }, WithName("failing"), WithSchemaGenerator(failing)); err == nil {
+		t.Error("expected the generator error to be returned")
+	}
+}
+
+func TestGenerateSchema_RawMessage(t *testing.T) {
+	got := mustMarshalSchema(t, reflect.TypeFor[json.RawMessage](), nil)
+	if got != `{}` {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: {}", got)
+	}
+}
+
+func TestGenerateSchema_Bytes(t *testing.T) {
+	got := mustMarshalSchema(t, reflect.TypeFor[[]byte](), nil)
+	expected := `{"type":"string","contentEncoding":"base64"}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestCreateTool_RawMessagePassthrough(t *testing.T) {
+	type WebhookArgs struct {
+		URL     string          `json:"url"`
+		Payload json.RawMessage `json:"payload" description:"Any JSON value"`
+	}
+	var received json.RawMessage
+	tool, err := CreateTool(func(args WebhookArgs) (string, error) {
+		received = args.Payload
+		return "ok", nil
+	}, WithName("webhook"))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+
+	expected := `{"type":"object","properties":{"payload":{"description":"Any JSON value"},"url":{"type":"string"}},"required":["url","payload"]}`
+	if got := string(tool.def.Parameters); got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+
+	payload := `{ "z": 1, "a": [true, null, "\u00e9"] }`
+	if _, err := callText(context.Background(), tool, json.RawMessage(`{"url":"https://example.com","payload":`+payload+`}`)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if string(received) != payload {
+		t.Errorf("expected payload bytes to pass through unchanged:\ngot:  %s\nwant: %s", received, payload)
+	}
+}
+
+type TreeNode struct {
+	Name     string     `json:"name"`
+	Children []TreeNode `json:"children"`
+}
+
+type ListNode struct {
+	Value int       `json:"value"`
+	Next  *ListNode `json:"next"`
+}
+
+type MutualA struct {
+	B *MutualB `json:"b"`
+}
+
+type MutualB struct {
+	A []MutualA `json:"a"`
+}
+
+func TestGenerateSchema_CyclicTypes(t *testing.T) {
+	tests := []struct {
+		typ  reflect.Type
+		want string
+	}{
+		{reflect.TypeFor[TreeNode](), "cyclic type detected: kimi.TreeNode"},
+		{reflect.TypeFor[ListNode](), "cyclic type detected: kimi.ListNode"},
+		{reflect.TypeFor[MutualA](), "cyclic type detected: kimi.MutualA"},
+	}
+	for _, tt := range tests {
+		_, err := generateSchema(tt.typ, nil)
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.typ)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.typ, tt.want, err)
+		}
+	}
+
+	if _, err := CreateTool(func(args TreeNode) (string, error) { return "", nil }, WithName("tree")); err == nil {
+		t.Error("expected CreateTool to reject a cyclic parameter type")
+	}
+}
+
+func TestGenerateSchema_RepeatedTypeIsNotCyclic(t *testing.T) {
+	type Point struct {
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+	type Segment struct {
+		From Point   `json:"from"`
+		To   Point   `json:"to"`
+		Via  []Point `json:"via"`
+	}
+	if _, err := generateSchema(reflect.TypeFor[Segment](), nil); err != nil {
+		t.Errorf("expected sibling fields of the same type to be accepted, got %v", err)
+	}
+}
+
+func TestGenerateSchema_PointerAlwaysOptional(t *testing.T) {
+	type StructWithPointer struct {
+		Required string  `json:"required"`
+		Optional *string `json:"optional"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[StructWithPointer](), nil)
+	expected := `{"type":"object","properties":{"optional":{"type":"string"},"required":{"type":"string"}},"required":["required"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_MapStringKey(t *testing.T) {
+	got := mustMarshalSchema(t, reflect.TypeFor[map[string]int](), nil)
+	expected := `{"type":"object","additionalProperties":{"type":"integer"}}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_MapStructValue(t *testing.T) {
+	type Price struct {
+		Amount   float64 `json:"amount"`
+		Currency string  `json:"currency,omitempty"`
+	}
+	got := mustMarshalSchema(t, reflect.TypeFor[map[string]Price](), nil)
+	expected := `{"type":"object","additionalProperties":{"type":"object","properties":{"amount":{"type":"number"},"currency":{"type":"string"}},"required":["amount"]}}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_MapAnyValue(t *testing.T) {
+	got := mustMarshalSchema(t, reflect.TypeFor[map[string]any](), nil)
+	expected := `{"type":"object"}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_MapNonStringKey(t *testing.T) {
+	_, err := generateSchema(reflect.TypeFor[map[int]string](), nil)
+	if err == nil {
+		t.Error("expected error for map with non-string key, got nil")
+	}
+}
+
+func TestGenerateSchema_NumericBounds(t *testing.T) {
+	type PageArgs struct {
+		Limit  int     `json:"limit" minimum:"1" maximum:"100"`
+		Offset *int    `json:"offset" minimum:"0"`
+		Ratio  float64 `json:"ratio" exclusiveMinimum:"0" exclusiveMaximum:"1.5"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[PageArgs](), nil)
+	expected := `{"type":"object","properties":{"limit":{"type":"integer","minimum":1,"maximum":100},"offset":{"type":"integer","minimum":0},"ratio":{"type":"number","exclusiveMinimum":0,"exclusiveMaximum":1.5}},"required":["limit","ratio"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestCreateTool_InvalidNumericBounds(t *testing.T) {
+	type NonNumeric struct {
+		Name string `json:"name" minimum:"1"`
+	}
+	type Unparsable struct {
+		Limit int `json:"limit" maximum:"lots"`
+	}
+	type Infinite struct {
+		Limit int `json:"limit" exclusiveMaximum:"+Inf"`
+	}
+
+	tests := []struct {
+		name   string
+		create func() (Tool, error)
+		want   string
+	}{
+		{"non-numeric field", func() (Tool, error) {
+			return CreateTool(func(args NonNumeric) (string, error) { return "", nil }, WithName("bounds"))
+		}, "minimum tag requires a numeric type"},
+		{"unparsable value", func() (Tool, error) {
+			return CreateTool(func(args Unparsable) (string, error) { return "", nil }, WithName("bounds"))
+		}, `invalid maximum tag "lots"`},
+		{"infinite value", func() (Tool, error) {
+			return CreateTool(func(args Infinite) (string, error) { return "", nil }, WithName("bounds"))
+		}, `invalid exclusiveMaximum tag "+Inf"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.create()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGenerateSchema_FormatTag(t *testing.T) {
+	type ContactArgs struct {
+		Email   string  `json:"email" format:"email"`
+		Website *string `json:"website" format:"uri"`
+		ID      string  `json:"id" format:"uuid"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[ContactArgs](), nil)
+	expected := `{"type":"object","properties":{"email":{"type":"string","format":"email"},"id":{"type":"string","format":"uuid"},"website":{"type":"string","format":"uri"}},"required":["email","id"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_FormatTagWithDescription(t *testing.T) {
+	type NotifyArgs struct {
+		Address string `json:"address" format:"email" description:"Recipient address"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[NotifyArgs](), map[string]string{})
+	expected := `{"type":"object","properties":{"address":{"type":"string","format":"email","description":"Recipient address"}},"required":["address"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestCreateTool_InvalidFormatTag(t *testing.T) {
+	type UnknownFormat struct {
+		Phone string `json:"phone" format:"phone"`
+	}
+	type NonString struct {
+		Count int `json:"count" format:"email"`
+	}
+
+	if _, err := CreateTool(func(args UnknownFormat) (string, error) { return "", nil }, WithName("format")); err == nil ||
+		!strings.Contains(err.Error(), `unknown format "phone"`) {
+		t.Errorf("expected unknown format error, got %v", err)
+	}
+	if _, err := CreateTool(func(args NonString) (string, error) { return "", nil }, WithName("format")); err == nil ||
+		!strings.Contains(err.Error(), "format tag requires a string type") {
+		t.Errorf("expected string type error, got %v", err)
+	}
+}
+
+func TestGenerateSchema_StringLengthAndPattern(t *testing.T) {
+	type CountryArgs struct {
+		Code string `json:"code" minLength:"2" maxLength:"2"`
+		Slug string `json:"slug,omitempty" pattern:"^[a-z0-9-]+$" minLength:"0"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[CountryArgs](), nil)
+	expected := `{"type":"object","properties":{"code":{"type":"string","minLength":2,"maxLength":2},"slug":{"type":"string","minLength":0,"pattern":"^[a-z0-9-]+$"}},"required":["code"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestCreateTool_InvalidStringConstraintTags(t *testing.T) {
+	type BadPattern struct {
+		Slug string `json:"slug" pattern:"[a-z"`
+	}
+	type NegativeLength struct {
+		Code string `json:"code" maxLength:"-1"`
+	}
+	type NonString struct {
+		Count int `json:"count" minLength:"1"`
+	}
+
+	tests := []struct {
+		name   string
+		create func() (Tool, error)
+		want   string
+	}{
+		{"uncompilable pattern", func() (Tool, error) {
+			return CreateTool(func(args BadPattern) (string, error) { return "", nil }, WithName("strings"))
+		}, "invalid pattern tag"},
+		{"negative length", func() (Tool, error) {
+			return CreateTool(func(args NegativeLength) (string, error) { return "", nil }, WithName("strings"))
+		}, `invalid maxLength tag "-1"`},
+		{"non-string field", func() (Tool, error) {
+			return CreateTool(func(args NonString) (string, error) { return "", nil }, WithName("strings"))
+		}, "minLength tag requires a string type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.create()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGenerateSchema_NestedStruct(t *testing.T) {
+	type Inner struct {
+		Value string `json:"value"`
+	}
+	type Outer struct {
+		Inner Inner `json:"inner"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Outer](), nil)
+	expected := `{"type":"object","properties":{"inner":{"type":"object","properties":{"value":{"type":"string"}},"required":["value"]}},"required":["inner"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+type embeddedBase struct {
+	RequestID string `json:"request_id" description:"Request identifier"`
+	Trace     string `json:"trace,omitempty"`
+}
+
+type EmbeddedBase struct {
+	ID string `json:"id"`
+}
+
+func TestGenerateSchema_EmbeddedStruct(t *testing.T) {
+	type Params struct {
+		embeddedBase
+		Query string `json:"query"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Params](), nil)
+	expected := `{"type":"object","properties":{"query":{"type":"string"},"request_id":{"type":"string","description":"Request identifier"},"trace":{"type":"string"}},"required":["request_id","query"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_EmbeddedStructVariants(t *testing.T) {
+	type Tagged struct {
+		EmbeddedBase `json:"base"`
+	}
+	type Pointer struct {
+		*EmbeddedBase
+		Query string `json:"query"`
+	}
+	type Shadowed struct {
+		embeddedBase
+		RequestID int `json:"request_id,omitempty"`
+	}
+
+	tests := []struct {
+		name     string
+		typ      reflect.Type
+		expected string
+	}{
+		{
+			name:     "tagged embed stays nested",
+			typ:      reflect.TypeFor[Tagged](),
+			expected: `{"type":"object","properties":{"base":{"type":"object","properties":{"id":{"type":"string"}},"required":["id"]}},"required":["base"]}`,
+		},
+		{
+			name:     "pointer embed fields are optional",
+			typ:      reflect.TypeFor[Pointer](),
+			expected: `{"type":"object","properties":{"id":{"type":"string"},"query":{"type":"string"}},"required":["query"]}`,
+		},
+		{
+			name:     "parent field shadows promoted field",
+			typ:      reflect.TypeFor[Shadowed](),
+			expected: `{"type":"object","properties":{"request_id":{"type":"integer"},"trace":{"type":"string"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustMarshalSchema(t, tt.typ, nil)
+			if got != tt.expected {
+				t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGenerateSchema_DeepNested(t *testing.T) {
+	type Level3 struct {
+		Data string `json:"data"`
+	}
+	type Level2 struct {
+		Level3 Level3 `json:"level3"`
+	}
+	type Level1 struct {
+		Level2 Level2 `json:"level2"`
+	}
+	type Root struct {
+		Level1 Level1 `json:"level1"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Root](), nil)
+	expected := `{"type":"object","properties":{"level1":{"type":"object","properties":{"level2":{"type":"object","properties":{"level3":{"type":"object","properties":{"data":{"type":"string"}},"required":["data"]}},"required":["level3"]}},"required":["level2"]}},"required":["level1"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_SliceOfStructs(t *testing.T) {
+	type Item struct {
+		Name string `json:"name"`
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[[]Item](), nil)
+	expected := `{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_UnsupportedTypes(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  reflect.Type
+	}{
+		{"interface", reflect.TypeFor[any]()},
+		{"func", reflect.TypeFor[func()]()},
+		{"chan", reflect.TypeFor[chan int]()},
+		{"complex64", reflect.TypeFor[complex64]()},
+		{"complex128", reflect.TypeFor[complex128]()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := generateSchema(tt.typ, nil)
+			if err == nil {
+				t.Errorf("expected error for unsupported type %s, got nil", tt.name)
+			}
+		})
+	}
+}
+
+func TestGenerateSchema_FieldDescsOverride(t *testing.T) {
+	type StructWithDesc struct {
+		Field string `json:"field" description:"original"`
+	}
+
+	fieldDescs := map[string]string{
+		"Field": "overridden",
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[StructWithDesc](), fieldDescs)
+	expected := `{"type":"object","properties":{"field":{"type":"string","description":"overridden"}},"required":["field"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_FieldDescsNotPassedToNested(t *testing.T) {
+	type Inner struct {
+		Value string `json:"value" description:"inner desc"`
+	}
+	type Outer struct {
+		Inner Inner `json:"inner"`
+	}
+
+	fieldDescs := map[string]string{
+		"Value": "should not apply to nested",
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Outer](), fieldDescs)
+	// Inner.Value should keep "inner desc" since fieldDescs is not passed to nested
+	expected := `{"type":"object","properties":{"inner":{"type":"object","properties":{"value":{"type":"string","description":"inner desc"}},"required":["value"]}},"required":["inner"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_FieldDescsDottedPaths(t *testing.T) {
+	type Address struct {
+		City string `json:"city" description:"tag desc"`
+	}
+	type User struct {
+		Name      string    `json:"name"`
+		Addresses []Address `json:"addresses"`
+	}
+	type Args struct {
+		User User   `json:"user"`
+		Name string `json:"name"`
+	}
+
+	fieldDescs := map[string]string{
+		"Name":                "top-level name",
+		"User":                "the user",
+		"User.Name":           "the user's full name",
+		"User.Addresses.City": "city of residence",
+	}
+
+	got := mustMarshalSchema(t, reflect.TypeFor[Args](), fieldDescs)
+	expected := `{"type":"object","properties":{"name":{"type":"string","description":"top-level name"},"user":{"type":"object","description":"the user","properties":{"addresses":{"type":"array","items":{"type":"object","properties":{"city":{"type":"string","description":"city of residence"}},"required":["city"]}},"name":{"type":"string","description":"the user's full name"}},"required":["name","addresses"]}},"required":["user","name"]}`
+
+	if got != expected {
+		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
+	}
+}
+
+func TestGenerateSchema_ComplexStruct(t *testing.T) {
+	type Address struct {
+		City string `json:"city"`
+	}
+	type Person struct {
 		Name     string         `json:"name" description:"Person's name"`
 		Age      int            `json:"age,omitempty"`
 		Tags     []string       `json:"tags,omitempty"`
@@ -758,3 +2063,157 @@ func TestGenerateSchema_ComplexStruct(t *testing.T) {
 		t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got, expected)
 	}
 }
+
+func TestCreateTool_SchemaCache(t *testing.T) {
+	first, err := CreateTool(Search)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	second, err := CreateTool(Search)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	if &first.def.Parameters[0] != &second.def.Parameters[0] {
+		t.Error("expected identical CreateTool calls to reuse the cached schema")
+	}
+
+	for _, desc := range []string{"cached query", "another query"} {
+		described, err := CreateTool(Search, WithFieldDescription("Query", desc))
+		if err != nil {
+			t.Fatalf("CreateTool failed: %v", err)
+		}
+		var schema map[string]any
+		if err := json.Unmarshal(described.def.Parameters, &schema); err != nil {
+			t.Fatalf("failed to unmarshal schema: %v", err)
+		}
+		queryProp := schema["properties"].(map[string]any)["query"].(map[string]any)
+		if queryProp["description"] != desc {
+			t.Errorf("expected description=%q, got %v", desc, queryProp["description"])
+		}
+	}
+
+	// Descriptions are applied to a copy: the cached schema is left as is, and
+	// a single schema is cached for the type whatever the descriptions.
+	third, err := CreateTool(Search)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	if string(third.def.Parameters) != string(first.def.Parameters) {
+		t.Errorf("expected the cached schema to be left as is, got %s", third.def.Parameters)
+	}
+	var cached int
+	schemaCache.Range(func(key, _ any) bool {
+		if key.(schemaCacheKey).typ == reflect.TypeFor[SearchParams]() {
+			cached++
+		}
+		return true
+	})
+	if cached != 1 {
+		t.Errorf("expected 1 cached schema for the type, got %d", cached)
+	}
+}
+
+func TestCachedSchema_Descriptions(t *testing.T) {
+	type Params struct {
+		embeddedBase
+		User    UserInfo            `json:"user"`
+		Users   []UserInfo          `json:"users"`
+		ByName  map[string]UserInfo `json:"by_name"`
+		Options *Options            `json:"options,omitempty"`
+	}
+	descs := map[string]string{
+		"RequestID":     "Promoted field",
+		"User":          "The user",
+		"User.Name":     "Nested field",
+		"Users.Age":     "Through a slice",
+		"ByName.Name":   "Through a map",
+		"Options.Debug": "Through a pointer",
+	}
+	for _, opts := range []schemaOptions{{}, {strict: true, uiHints: true}} {
+		expected, err := marshalSchema(reflect.TypeFor[Params](), descs, opts)
+		if err != nil {
+			t.Fatalf("marshalSchema: %v", err)
+		}
+		got, err := cachedSchema(reflect.TypeFor[Params](), descs, opts)
+		if err != nil {
+			t.Fatalf("cachedSchema: %v", err)
+		}
+		if string(got.json) != string(expected.json) {
+			t.Errorf("schema mismatch:\ngot:  %s\nwant: %s", got.json, expected.json)
+		}
+	}
+}
+
+func BenchmarkCreateTool(b *testing.B) {
+	for b.Loop() {
+		if _, err := CreateTool(Search, WithFieldDescription("Query", "benchmark query")); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateSchema(b *testing.B) {
+	paramType := reflect.TypeFor[SearchParams]()
+	descs := map[string]string{"Query": "benchmark query"}
+	for b.Loop() {
+		if _, err := generateSchema(paramType, descs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTool_WithDoc_OverridesTagDescriptions(t *testing.T) {
+	tool, err := CreateTool(Search,
+		WithName("search"),
+		WithDescription("Search things"),
+		WithFieldDescription("Limit", "Option description"),
+	)
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+
+	documented, err := tool.withDoc(ToolDoc{
+		Description: "Rechercher",
+		Fields:      map[string]string{"Query": "La requête", "Limit": "Nombre maximum de résultats"},
+	})
+	if err != nil {
+		t.Fatalf("withDoc failed: %v", err)
+	}
+	if documented.def.Description != "Rechercher" {
+		t.Errorf("expected catalog tool description, got %q", documented.def.Description)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(documented.def.Parameters, &schema); err != nil {
+		t.Fatalf("failed to unmarshal schema: %v", err)
+	}
+	props := schema["properties"].(map[string]any)
+	if got := props["query"].(map[string]any)["description"]; got != "La requête" {
+		t.Errorf("expected catalog description to override the tag, got %v", got)
+	}
+	if got := props["limit"].(map[string]any)["description"]; got != "Nombre maximum de résultats" {
+		t.Errorf("expected catalog description to override the option, got %v", got)
+	}
+
+	// The original tool is left untouched.
+	if tool.def.Description != "Search things" || strings.Contains(string(tool.def.Parameters), "requête") {
+		t.Error("expected withDoc not to modify the original tool")
+	}
+}
+
+func TestTool_WithDoc_DescriptionOnly(t *testing.T) {
+	tool, err := CreateTool(Search, WithName("search"), WithSchema(json.RawMessage(`{"type":"object"}`)))
+	if err != nil {
+		t.Fatalf("CreateTool failed: %v", err)
+	}
+	documented, err := tool.withDoc(ToolDoc{Description: "Rechercher"})
+	if err != nil {
+		t.Fatalf("withDoc failed: %v", err)
+	}
+	if documented.def.Description != "Rechercher" || string(documented.def.Parameters) != `{"type":"object"}` {
+		t.Errorf("unexpected tool definition: %+v", documented.def)
+	}
+
+	if _, err := tool.withDoc(ToolDoc{Fields: map[string]string{"Query": "x"}}); err == nil {
+		t.Error("expected field descriptions on a WithSchema tool to be rejected")
+	}
+}
@@ -0,0 +1,50 @@
+package kimi
+
+import (
+	"strings"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+// ToolCallAssembler reassembles the arguments of the tool calls read from
+// Step.Messages, which are streamed as a wire.ToolCall followed by
+// wire.ToolCallPart fragments, so that consumers can show the fragments live and
+// still get each call whole. Fragments carry no call ID; they continue the most
+// recent call, which is complete once any other message follows it, or once its
+// step ends. The zero value is ready to use; an assembler must not be used
+// concurrently.
+type ToolCallAssembler struct {
+	pending *wire.ToolCall
+	args    strings.Builder
+}
+
+// Add feeds the next message of a step to the assembler. It returns the call
+// that msg completes, with its arguments whole, if any.
+func (a *ToolCallAssembler) Add(msg wire.Message) (wire.ToolCall, bool) {
+	if part, ok := msg.(wire.ToolCallPart); ok {
+		if a.pending != nil && part.ArgumentsPart.Valid {
+			a.args.WriteString(part.ArgumentsPart.Value)
+			a.pending.Function.Arguments.Valid = true
+		}
+		return wire.ToolCall{}, false
+	}
+	call, complete := a.Flush()
+	if next, ok := msg.(wire.ToolCall); ok {
+		a.pending = &next
+		a.args.WriteString(next.Function.Arguments.Value)
+	}
+	return call, complete
+}
+
+// Flush returns the call still being assembled, if any, as complete, e.g. once
+// the Messages of its step are closed, and resets the assembler.
+func (a *ToolCallAssembler) Flush() (wire.ToolCall, bool) {
+	if a.pending == nil {
+		return wire.ToolCall{}, false
+	}
+	call := *a.pending
+	call.Function.Arguments.Value = a.args.String()
+	a.pending = nil
+	a.args.Reset()
+	return call, true
+}
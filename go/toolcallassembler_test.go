@@ -0,0 +1,54 @@
+package kimi
+
+import (
+	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+)
+
+func TestToolCallAssembler(t *testing.T) {
+	fragment := func(s string) wire.ToolCallPart {
+		return wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: s, Valid: true}}
+	}
+	messages := []wire.Message{
+		wire.NewTextContentPart("Let me write it."),
+		wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "write_file"}},
+		fragment(`{"path":"/tmp/a.txt",`),
+		fragment(`"content":"hel`),
+		fragment(`lo, \"world\""}`),
+		wire.ToolCall{ID: "call-2", Function: wire.ToolCallFunction{Name: "read_file", Arguments: wire.Optional[string]{Value: `{"path":`, Valid: true}}},
+		fragment(`"/tmp/a.txt"}`),
+		wire.ToolResult{ToolCallID: "call-1"},
+		wire.ToolCall{ID: "call-3", Function: wire.ToolCallFunction{Name: "list"}},
+		fragment(`{"dir":"/tmp"`),
+	}
+
+	var a ToolCallAssembler
+	var completed []wire.ToolCall
+	for _, msg := range messages {
+		if call, ok := a.Add(msg); ok {
+			completed = append(completed, call)
+		}
+	}
+	if len(completed) != 2 {
+		t.Fatalf("expected 2 calls completed by the messages, got %d", len(completed))
+	}
+	if got := completed[0]; got.ID != "call-1" || got.Function.Arguments.Value != `{"path":"/tmp/a.txt","content":"hello, \"world\""}` {
+		t.Errorf("unexpected first call: %+v", got)
+	}
+	if got := completed[1]; got.ID != "call-2" || got.Function.Arguments.Value != `{"path":"/tmp/a.txt"}` {
+		t.Errorf("unexpected second call: %+v", got)
+	}
+
+	// The last call is still open when the step ends; Flush returns it as is.
+	call, ok := a.Flush()
+	if !ok || call.ID != "call-3" || call.Function.Arguments.Value != `{"dir":"/tmp"` {
+		t.Errorf("Flush() = %+v, %v", call, ok)
+	}
+	if _, ok := a.Flush(); ok {
+		t.Error("expected nothing to flush after Flush")
+	}
+	if _, ok := a.Add(fragment(`"stray"`)); ok {
+		t.Error("expected a fragment without a call to complete nothing")
+	}
+}
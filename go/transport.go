@@ -0,0 +1,18 @@
+package kimi
+
+import "github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
+
+// TransportWireProtocolVersion is the wire protocol version of the sessions
+// over a transport set with WithTransport: the agent behind the transport
+// must speak it.
+const TransportWireProtocolVersion = "1.2"
+
+// TransportBinder is implemented by the transports passed to WithTransport
+// that deliver the agent's events and requests to the session. Bind is called
+// once, before Initialize, with the session's end of the connection: while a
+// prompt is in flight, the transport passes each event the agent emits to its
+// Event method, and each request, such as an approval request or an external
+// tool call, to its Request method, which returns the response.
+type TransportBinder interface {
+	Bind(session transport.Transport)
+}
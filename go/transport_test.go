@@ -0,0 +1,135 @@
+package kimi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
+	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
+)
+
+// inProcessAgent is an agent running in the process, reached through
+// WithTransport. Each prompt calls the "upper" tool on the user input and
+// answers with its result.
+type inProcessAgent struct {
+	session  transport.Transport
+	protocol string
+	tools    []string
+	closed   bool
+}
+
+func (a *inProcessAgent) Bind(session transport.Transport) {
+	a.session = session
+}
+
+func (a *inProcessAgent) Initialize(params *wire.InitializeParams) (*wire.InitializeResult, error) {
+	a.protocol = params.ProtocolVersion
+	a.tools = toolNames(params.ExternalTools)
+	return &wire.InitializeResult{ProtocolVersion: params.ProtocolVersion}, nil
+}
+
+func (a *inProcessAgent) Prompt(params *wire.PromptParams) (*wire.PromptResult, error) {
+	emit := func(event wire.Event) error {
+		_, err := a.session.Event(&wire.EventParams{Type: event.EventType(), Payload: event})
+		return err
+	}
+	if err := emit(wire.TurnBegin{UserInput: params.UserInput}); err != nil {
+		return nil, err
+	}
+	if err := emit(wire.StepBegin{N: 1}); err != nil {
+		return nil, err
+	}
+	result, err := a.session.Request(&wire.RequestParams{
+		Type: wire.RequestTypeToolCallRequest,
+		Payload: wire.ToolCallRequest{
+			ID:        "call-1",
+			Name:      "upper",
+			Arguments: wire.Optional[string]{Value: `{"input":"` + params.UserInput.Text.Value + `"}`, Valid: true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := emit(wire.NewTextContentPart(result.(*wire.ToolResult).ReturnValue.Output.Text.Value)); err != nil {
+		return nil, err
+	}
+	if err := emit(wire.TurnEnd{}); err != nil {
+		return nil, err
+	}
+	return &wire.PromptResult{Status: wire.PromptResultStatusFinished, Steps: wire.Optional[int]{Value: 1, Valid: true}}, nil
+}
+
+func (a *inProcessAgent) Cancel(*wire.CancelParams) (*wire.CancelResult, error) {
+	return &wire.CancelResult{}, nil
+}
+
+func (a *inProcessAgent) Event(*wire.EventParams) (*wire.EventResult, error) {
+	return nil, errors.New("not an agent method")
+}
+
+func (a *inProcessAgent) Request(*wire.RequestParams) (wire.RequestResult, error) {
+	return nil, errors.New("not an agent method")
+}
+
+func (a *inProcessAgent) Close() error {
+	a.closed = true
+	return nil
+}
+
+func TestWithTransport(t *testing.T) {
+	upper, err := CreateTool(func(args SimpleArgs) (string, error) {
+		return strings.ToUpper(args.Input), nil
+	}, WithName("upper"))
+	if err != nil {
+		t.Fatalf("CreateTool: %v", err)
+	}
+	agent := &inProcessAgent{}
+	session, err := NewSession(
+		WithTransport(agent),
+		WithTools(upper),
+		WithExecutable("/nonexistent/kimi"),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	if agent.protocol != TransportWireProtocolVersion {
+		t.Errorf("expected protocol version %s, got %q", TransportWireProtocolVersion, agent.protocol)
+	}
+	if len(agent.tools) != 1 || agent.tools[0] != "upper" {
+		t.Errorf("expected the upper tool to be advertised, got %v", agent.tools)
+	}
+
+	turn, err := session.Prompt(context.Background(), wire.NewStringContent("hello"))
+	if err != nil {
+		t.Fatalf("Prompt: %v", err)
+	}
+	var text strings.Builder
+	for step := range turn.Steps {
+		for msg := range step.Messages {
+			if part, ok := msg.(wire.ContentPart); ok && part.Type == wire.ContentPartTypeText {
+				text.WriteString(part.Text.Value)
+			}
+		}
+	}
+	if err := turn.Err(); err != nil {
+		t.Fatalf("Turn error: %v", err)
+	}
+	if text.String() != "HELLO" {
+		t.Errorf("expected %q, got %q", "HELLO", text.String())
+	}
+	if status := turn.Result().Status; status != wire.PromptResultStatusFinished {
+		t.Errorf("expected status finished, got %s", status)
+	}
+
+	if err := session.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if !agent.closed {
+		t.Error("expected Close to close the transport")
+	}
+	if _, err := session.Prompt(context.Background(), wire.NewStringContent("again")); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("expected ErrSessionClosed after Close, got %v", err)
+	}
+}
@@ -4,7 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/MoonshotAI/kimi-agent-sdk/go/wire"
 	"github.com/MoonshotAI/kimi-agent-sdk/go/wire/transport"
@@ -24,6 +30,7 @@ func turnBegin(
 	wireMessageChan <-chan wire.Message,
 	wireRequestResponseChan chan<- wire.RequestResponse,
 	exit func(error) error,
+	options ...turnOption,
 ) *Turn {
 	parent, cancel := context.WithCancel(ctx)
 	current, stop := context.WithCancel(context.Background())
@@ -41,13 +48,19 @@ func turnBegin(
 		wireProtocolVersion:     wireProtocolVersion,
 		wireRequestResponseChan: wireRequestResponseChan,
 		Steps:                   steps,
+		begin:                   time.Now(),
 	}
 	turn.usage.Store(&Usage{})
+	for _, apply := range options {
+		apply(turn)
+	}
 	go turn.traverse(wireMessageChan, steps)
 	go turn.watch(parent)
 	return turn
 }
 
+type turnOption func(*Turn)
+
 type Turn struct {
 	id            uint64
 	tp            transport.Transport
@@ -59,11 +72,54 @@ type Turn struct {
 	cancel  context.CancelFunc
 	exit    func(error) error
 
-	Steps <-chan *Step
-	usage atomic.Pointer[Usage]
+	Steps     <-chan *Step
+	delivered atomic.Pointer[Step] // the last step sent, or about to be sent, on Steps
+	usage     atomic.Pointer[Usage]
+
+	contextTruncated atomic.Bool
+
+	begin     time.Time
+	end       atomic.Pointer[time.Time]
+	nsteps    atomic.Int64
+	toollock  sync.Mutex
+	toolcalls []*inflightToolCall // all calls, in call order
+	inflight  []*inflightToolCall // calls without a result yet, in call order
+	argRepair bool
+	media     *mediaSaver
+
+	classifyError AgentErrorClassifier
+	errorlock     sync.Mutex
+	agentErrors   []AgentError
+
+	input          wire.Content
+	onEchoMismatch EchoMismatchFunc
+
+	coalescer textCoalescer
+
+	textlock      sync.Mutex
+	text          strings.Builder
+	lastEventType wire.EventType
+	hasContent    bool // a non-empty text or media content part was received
+	think         strings.Builder
+	thinkHidden   bool // a think part carried only an encrypted payload
+
+	compacting          bool
+	compactionEvents    []wire.Event
+	compacted           atomic.Bool // a CompactionEnd was received
+	summarizeCompaction CompactionSummaryFunc
+	onCompactionSummary func(summary string)
+
+	sinklock    sync.Mutex
+	sinks       []*sinkRunner
+	sinksClosed bool
+	sinkOwner   *Turn // the turn this one retries, whose sinks receive its events
 
 	wireProtocolVersion     string
 	wireRequestResponseChan chan<- wire.RequestResponse
+
+	retry     func(options ...turnOption) (*Turn, error) // starts a retry of the turn, or returns nil when none should be made
+	next      atomic.Pointer[Turn]                       // the retry, once started
+	cancelled atomic.Bool                                // the caller cancelled the turn, which must not be retried then
 }
 
 func (t *Turn) watch(parent context.Context) {
@@ -78,17 +134,25 @@ func (t *Turn) watch(parent context.Context) {
 
 func (t *Turn) traverse(incoming <-chan wire.Message, steps chan<- *Step) {
 	defer close(steps)
+	defer t.closeSinks()
+	defer t.retryUnexpectedEOF(steps)
 	defer close(t.wireRequestResponseChan)
-	defer t.Cancel()
+	defer t.shutdown()
 	var (
 		outgoing chan wire.Message
+		step     *Step // the current step, which status updates are attributed to
 		turnEnd  bool
 	)
 	defer func() {
+		end := time.Now()
+		t.end.Store(&end)
+		if t.media != nil {
+			t.media.wait()
+		}
 		if outgoing != nil {
 			close(outgoing)
 		}
-		if t.wireProtocolVersion >= "1.2" && !turnEnd {
+		if featuresFor(t.wireProtocolVersion).SupportsTurnEnd && !turnEnd {
 			t.resultPointer.Store(&wire.PromptResult{Status: wire.PromptResultStatusUnexpectedEOF})
 		}
 	}()
@@ -97,19 +161,39 @@ func (t *Turn) traverse(incoming <-chan wire.Message, steps chan<- *Step) {
 		if !ok {
 			return
 		}
-		if _, is := msg.(wire.TurnBegin); !is {
+		begin, is := msg.(wire.TurnBegin)
+		if !is {
 			t.errorPointer.Store(&ErrTurnNotFound)
 			return
 		}
+		t.verifyEcho(begin)
 	case <-t.current.Done():
 		return
 	}
-	for msg := range incoming {
+	for {
+		var msg wire.Message
+		select {
+		case m, ok := <-incoming:
+			if !ok {
+				t.flushText(outgoing)
+				return
+			}
+			msg = m
+		case <-t.coalescer.due():
+			if !t.flushText(outgoing) {
+				return
+			}
+			continue
+		}
 		switch x := msg.(type) {
 		case wire.TurnEnd:
 			turnEnd = true
+			t.flushText(outgoing)
 			return
 		case wire.Request:
+			if !t.flushText(outgoing) {
+				return
+			}
 			if outgoing != nil {
 				select {
 				case outgoing <- x:
@@ -118,46 +202,54 @@ func (t *Turn) traverse(incoming <-chan wire.Message, steps chan<- *Step) {
 				}
 			}
 		case wire.Event:
+			t.trackText(x)
 			switch x.EventType() {
 			case wire.EventTypeTurnBegin:
 				panic("wire.TurnBegin event should not be received")
 			case wire.EventTypeStepBegin:
+				if !t.flushText(outgoing) {
+					return
+				}
 				if outgoing != nil {
 					close(outgoing)
 				}
 				outgoing = make(chan wire.Message)
+				t.nsteps.Add(1)
+				step = &Step{n: x.(wire.StepBegin).N, Messages: outgoing}
+				step.usage.Store(&Usage{})
+				t.delivered.Store(step)
 				select {
-				case steps <- &Step{n: x.(wire.StepBegin).N, Messages: outgoing}:
+				case steps <- step:
 				case <-t.current.Done():
 					return
 				}
 			case wire.EventTypeStatusUpdate:
 				update := x.(wire.StatusUpdate)
-			CAS:
-				for {
-					oldUsage := t.usage.Load()
-					newUsage := &Usage{Tokens: oldUsage.Tokens}
-					if update.ContextUsage.Valid {
-						newUsage.Context = update.ContextUsage.Value
-					}
-					if update.TokenUsage.Valid {
-						tokens := update.TokenUsage.Value
-						newUsage.Tokens.InputOther += tokens.InputOther
-						newUsage.Tokens.Output += tokens.Output
-						newUsage.Tokens.InputCacheRead += tokens.InputCacheRead
-						newUsage.Tokens.InputCacheCreation += tokens.InputCacheCreation
-					}
-					if t.usage.CompareAndSwap(oldUsage, newUsage) {
-						break CAS
-					}
+				if update.ContextUsage.Valid && update.ContextUsage.Value >= 1 {
+					t.contextTruncated.Store(true)
+				}
+				addUsage(&t.usage, update)
+				if step != nil {
+					addUsage(&step.usage, update)
 				}
 			default:
-				if outgoing != nil {
-					select {
-					case outgoing <- x:
-					case <-t.current.Done():
-						return
-					}
+				t.trackToolCall(x)
+				t.trackAgentError(x)
+				t.trackCompaction(x)
+				t.dispatchToSinks(x)
+				if t.media != nil {
+					t.media.save(t.current, x)
+				}
+				if outgoing == nil || t.coalescer.add(x) {
+					break
+				}
+				if !t.flushText(outgoing) {
+					return
+				}
+				select {
+				case outgoing <- x:
+				case <-t.current.Done():
+					return
 				}
 			}
 		default:
@@ -170,11 +262,85 @@ func (t *Turn) ID() uint64 {
 	return t.id
 }
 
+// Err returns the error the turn failed with, or nil. A turn whose stream ended
+// without TurnEnd (PromptResultStatusUnexpectedEOF) fails with io.ErrUnexpectedEOF.
+// Errors are returned as *TurnError, which carries a snapshot of the partial output,
+// so compare them with errors.Is rather than ==.
 func (t *Turn) Err() error {
-	if err := t.errorPointer.Load(); err != nil && *err != nil {
-		return *err
+	var err error
+	if p := t.errorPointer.Load(); p != nil && *p != nil {
+		err = *p
+	}
+	status := t.Result().Status
+	if err == nil {
+		if status != wire.PromptResultStatusUnexpectedEOF {
+			return nil
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	t.textlock.Lock()
+	defer t.textlock.Unlock()
+	return &TurnError{
+		Status:        status,
+		PartialText:   t.text.String(),
+		LastEventType: t.lastEventType,
+		Err:           err,
+	}
+}
+
+// TurnError is the error returned by Turn.Err. It wraps the underlying error
+// together with what the turn had produced before it failed.
+type TurnError struct {
+	Status        wire.PromptResultStatus
+	PartialText   string         // text streamed by the assistant before the failure
+	LastEventType wire.EventType // type of the last event received, or "" if there was none
+	Err           error
+}
+
+func (e *TurnError) Error() string {
+	lastEventType := e.LastEventType
+	if lastEventType == "" {
+		lastEventType = "none"
+	}
+	return fmt.Sprintf("%v (status %s, last event %s, %d bytes of partial text)",
+		e.Err, e.Status, lastEventType, len(e.PartialText))
+}
+
+func (e *TurnError) Unwrap() error {
+	return e.Err
+}
+
+func (t *Turn) trackText(event wire.Event) {
+	t.textlock.Lock()
+	defer t.textlock.Unlock()
+	t.lastEventType = event.EventType()
+	part, ok := event.(wire.ContentPart)
+	if !ok {
+		return
+	}
+	switch part.Type {
+	case wire.ContentPartTypeText:
+		t.text.WriteString(part.Text.Value)
+		t.hasContent = t.hasContent || part.Text.Value != ""
+	case wire.ContentPartTypeThink:
+		t.think.WriteString(part.Think.Value)
+		t.thinkHidden = t.thinkHidden || (part.Encrypted.Valid && part.Think.Value == "")
+	case wire.ContentPartTypeImageURL, wire.ContentPartTypeAudioURL, wire.ContentPartTypeVideoURL:
+		t.hasContent = true
 	}
-	return nil
+}
+
+// IsEmpty reports whether the assistant has produced nothing during the turn:
+// no text, no media and no tool calls. Thinking parts and empty text parts do
+// not count. A turn that finished empty may have had its response dropped, so
+// callers can retry or warn rather than treat it as an empty answer.
+func (t *Turn) IsEmpty() bool {
+	t.textlock.Lock()
+	hasContent := t.hasContent
+	t.textlock.Unlock()
+	t.toollock.Lock()
+	defer t.toollock.Unlock()
+	return !hasContent && len(t.toolcalls) == 0
 }
 
 func (t *Turn) Result() wire.PromptResult {
@@ -185,18 +351,328 @@ func (t *Turn) Usage() *Usage {
 	return t.usage.Load()
 }
 
+// ContextTruncated reports whether the context window filled up during the turn,
+// that is, a status update reported a context usage of 1.0 or more. At that point
+// the backend has to drop earlier messages to continue. The wire protocol has no
+// dedicated truncation signal and does not report which messages were dropped.
+func (t *Turn) ContextTruncated() bool {
+	return t.contextTruncated.Load()
+}
+
+// ContextUsagePercent returns the context usage last reported for the turn, see
+// Usage, as a percentage of the context window rounded to the nearest integer.
+func (t *Turn) ContextUsagePercent() int {
+	return int(math.Round(t.Usage().Context * 100))
+}
+
+// ContextUsageString returns ContextUsagePercent formatted for display, e.g. "75%".
+func (t *Turn) ContextUsageString() string {
+	return fmt.Sprintf("%d%%", t.ContextUsagePercent())
+}
+
+// inflightToolCall is a tool call with the fragments of its arguments received
+// so far, and its result once received.
+type inflightToolCall struct {
+	call   wire.ToolCall
+	args   strings.Builder
+	result *wire.ToolResult
+}
+
+func (t *Turn) trackToolCall(event wire.Event) {
+	t.toollock.Lock()
+	defer t.toollock.Unlock()
+	switch x := event.(type) {
+	case wire.ToolCall:
+		call := &inflightToolCall{call: x}
+		call.args.WriteString(x.Function.Arguments.Value)
+		t.toolcalls = append(t.toolcalls, call)
+		t.inflight = append(t.inflight, call)
+	case wire.ToolCallPart:
+		// Fragments carry no call ID; they continue the most recent call.
+		if n := len(t.inflight); n > 0 && x.ArgumentsPart.Valid {
+			t.inflight[n-1].args.WriteString(x.ArgumentsPart.Value)
+		}
+	case wire.ToolResult:
+		// Calls run concurrently, so results may arrive in any order.
+		t.inflight = slices.DeleteFunc(t.inflight, func(call *inflightToolCall) bool {
+			if call.call.ID != x.ToolCallID {
+				return false
+			}
+			call.result = &x
+			return true
+		})
+	}
+}
+
+// TruncatedToolCall returns the tool call that was still in progress when the
+// stream of the turn stopped without TurnEnd, with PromptResultStatusUnexpectedEOF.
+// A turn that ended otherwise, e.g. cancelled while a call was running, has no
+// truncated call. When several calls were awaiting their results, it is the
+// most recent one.
+// Its arguments are the fragments received so far. With WithArgRepair, they are
+// closed into valid JSON when possible so they can be inspected or logged;
+// the repaired arguments must never be used to execute the tool.
+func (t *Turn) TruncatedToolCall() (wire.ToolCall, bool) {
+	if t.end.Load() == nil || t.Result().Status != wire.PromptResultStatusUnexpectedEOF {
+		return wire.ToolCall{}, false
+	}
+	t.toollock.Lock()
+	defer t.toollock.Unlock()
+	if len(t.inflight) == 0 {
+		return wire.ToolCall{}, false
+	}
+	inflight := t.inflight[len(t.inflight)-1]
+	call := inflight.call
+	args := inflight.args.String()
+	if t.argRepair {
+		if repaired, ok := repairJSON(args); ok {
+			args = repaired
+		}
+	}
+	call.Function.Arguments = wire.Optional[string]{Value: args, Valid: true}
+	return call, true
+}
+
+// ToolCallRecord is a tool call made during a turn, paired with its result.
+type ToolCallRecord struct {
+	// Call is the tool call, with its arguments reassembled from the
+	// ToolCallPart fragments they were streamed in.
+	Call wire.ToolCall
+	// Result is the result of the call, or nil if none was received, e.g.
+	// because the turn was cancelled while the tool ran.
+	Result *wire.ToolResult
+}
+
+// ToolCalls consumes the remaining steps of the turn and their messages until
+// the turn ends, like Drain, and returns the tool calls made during the whole
+// turn, in call order, each paired with its result, along with the error of
+// the turn. It can be called after the turn was otherwise consumed. If ctx is
+// done first, the turn is cancelled and ToolCalls returns the calls made so far
+// and ctx.Err().
+func (t *Turn) ToolCalls(ctx context.Context) ([]ToolCallRecord, error) {
+	err := t.consume(ctx, func(*Step, wire.Message) {})
+	t.toollock.Lock()
+	defer t.toollock.Unlock()
+	records := make([]ToolCallRecord, 0, len(t.toolcalls))
+	for _, inflight := range t.toolcalls {
+		call := inflight.call
+		call.Function.Arguments = wire.Optional[string]{Value: inflight.args.String(), Valid: true}
+		records = append(records, ToolCallRecord{Call: call, Result: inflight.result})
+	}
+	return records, err
+}
+
+// TurnSummary is a compact overview of a turn, suitable for one-line logging.
+type TurnSummary struct {
+	ID        uint64
+	Status    wire.PromptResultStatus
+	Steps     int
+	ToolCalls []string // names of the tools invoked, in call order
+	// ToolCallArguments holds the arguments of the calls in ToolCalls, in the
+	// same order, as the JSON documents the agent sent.
+	ToolCallArguments []string
+	Usage             Usage
+	Duration          time.Duration
+	Cancelled         bool
+	Err               error
+}
+
+// Summary assembles a TurnSummary from the state the turn has tracked so far.
+// It is most meaningful once all steps have been consumed; before that,
+// Duration is measured up to the current time.
+func (t *Turn) Summary() TurnSummary {
+	result := t.Result()
+	err := t.Err()
+	summary := TurnSummary{
+		ID:     t.id,
+		Status: result.Status,
+		Steps:  int(t.nsteps.Load()),
+		Usage:  *t.Usage(),
+		Err:    err,
+	}
+	if result.Steps.Valid {
+		summary.Steps = result.Steps.Value
+	}
+	t.toollock.Lock()
+	for _, call := range t.toolcalls {
+		summary.ToolCalls = append(summary.ToolCalls, call.call.Function.Name)
+		summary.ToolCallArguments = append(summary.ToolCallArguments, call.args.String())
+	}
+	t.toollock.Unlock()
+	if end := t.end.Load(); end != nil {
+		summary.Duration = end.Sub(t.begin)
+	} else {
+		summary.Duration = time.Since(t.begin)
+	}
+	summary.Cancelled = result.Status == wire.PromptResultStatusCancelled || errors.Is(err, context.Canceled)
+	return summary
+}
+
+// Drain consumes the remaining steps of the turn and their messages until the
+// turn ends, discarding them, e.g. for a turn whose output is not needed, and
+// returns the error of the turn as Err does. Approval requests are rejected.
+// If ctx is done first, the turn is cancelled and Drain returns ctx.Err() once
+// it has ended. Unlike Events, which hands messages over, Drain reads Steps
+// itself, so it must not be called while Steps is consumed elsewhere.
+func (t *Turn) Drain(ctx context.Context) error {
+	return t.consume(ctx, func(*Step, wire.Message) {})
+}
+
+// Text consumes the remaining steps of the turn and their messages until the
+// turn ends, like Drain, and returns the text content parts received during the
+// whole turn, joined in order, along with the error of the turn, the same way
+// Think returns the reasoning: parts already read from Steps are included. Think
+// parts and media are left out, and approval requests are rejected. If ctx is
+// done first, the turn is cancelled and Text returns the text received so far
+// and ctx.Err().
+func (t *Turn) Text(ctx context.Context) (string, error) {
+	err := t.consume(ctx, func(*Step, wire.Message) {})
+	t.textlock.Lock()
+	defer t.textlock.Unlock()
+	return t.text.String(), err
+}
+
+// Think consumes the remaining steps of the turn and their messages until the
+// turn ends, like Drain, and returns the reasoning the model streamed in think
+// parts during the whole turn, joined in order, along with the error of the
+// turn. It can be called after Text, or after the turn was otherwise consumed.
+// Reasoning that the CLI only passes on encrypted is not readable and is left
+// out; ThinkEncrypted reports whether there was any. If ctx is done first, the
+// turn is cancelled and Think returns the reasoning received so far and
+// ctx.Err().
+//
+// The reasoning is the model's intermediate output: it may restate the prompt,
+// including data the user shared, and is not reviewed like the answer. Only
+// show or log it where the user and the model provider's terms allow.
+func (t *Turn) Think(ctx context.Context) (string, error) {
+	err := t.consume(ctx, func(*Step, wire.Message) {})
+	t.textlock.Lock()
+	defer t.textlock.Unlock()
+	return t.think.String(), err
+}
+
+// ThinkEncrypted reports whether a think part received during the turn carried
+// its reasoning encrypted only, so that Think could not return it.
+func (t *Turn) ThinkEncrypted() bool {
+	t.textlock.Lock()
+	defer t.textlock.Unlock()
+	return t.thinkHidden
+}
+
+// Wait is Drain: it blocks until the turn completes, discarding the messages
+// not read yet, and returns the error of the turn as Err does, e.g. to run a
+// turn without streaming it and then read Result and Usage.
+func (t *Turn) Wait(ctx context.Context) error {
+	return t.Drain(ctx)
+}
+
+// consume passes the messages of the remaining steps to handle, along with the
+// step they belong to, until the turn ends, rejecting approval requests, see
+// Drain. It starts with the rest of the last step sent on Steps, if any, so
+// that a step abandoned half-read does not block the turn. That step is read
+// along with Steps, as it may not have been received yet; a step's messages end
+// before the next step is sent.
+func (t *Turn) consume(ctx context.Context, handle func(*Step, wire.Message)) error {
+	stop := context.AfterFunc(ctx, t.abort)
+	defer stop()
+	var messages <-chan wire.Message
+	current := t.delivered.Load()
+	if current != nil {
+		messages = current.Messages
+	}
+	steps := t.Steps
+	for messages != nil || steps != nil {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				messages = nil
+				continue
+			}
+			if req, ok := msg.(wire.ApprovalRequest); ok {
+				req.Reject() //nolint:errcheck
+			}
+			handle(current, msg)
+		case step, ok := <-steps:
+			if !ok {
+				steps = nil
+				continue
+			}
+			current = step
+			messages = step.Messages
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.Err()
+}
+
 func (t *Turn) Cancel() error {
+	t.cancelled.Store(true)
+	return t.shutdown()
+}
+
+// shutdown ends the turn, and its retry if one was started, as Cancel does,
+// without marking it as cancelled by the caller.
+func (t *Turn) shutdown() error {
 	t.cancel()
 	<-t.current.Done()
+	if next := t.next.Load(); next != nil {
+		return next.Cancel()
+	}
 	return t.exit(nil)
 }
 
+// abort cancels the turn on behalf of the caller, e.g. once the context passed
+// to Drain is done, without waiting for it to end.
+func (t *Turn) abort() {
+	t.cancelled.Store(true)
+	t.cancel()
+	if next := t.next.Load(); next != nil {
+		next.abort()
+	}
+}
+
 type Step struct {
 	n        int
 	Messages <-chan wire.Message
+	usage    atomic.Pointer[Usage]
+}
+
+// Usage returns the token usage reported by the status updates received within
+// the step so far, computed as Turn.Usage is for the whole turn: the tokens are
+// summed and Context is the context usage of the last update. Status updates
+// received before the first step belong to no step, so the tokens of the turn
+// are the sum over its steps plus those of such updates.
+func (s *Step) Usage() *Usage {
+	if u := s.usage.Load(); u != nil {
+		return u
+	}
+	return &Usage{}
 }
 
 type Usage struct {
 	Context float64
 	Tokens  wire.TokenUsage
 }
+
+// addUsage adds the usage reported by update to the usage stored in p.
+func addUsage(p *atomic.Pointer[Usage], update wire.StatusUpdate) {
+	for {
+		oldUsage := p.Load()
+		newUsage := &Usage{Tokens: oldUsage.Tokens}
+		if update.ContextUsage.Valid {
+			newUsage.Context = update.ContextUsage.Value
+		}
+		if update.TokenUsage.Valid {
+			tokens := update.TokenUsage.Value
+			newUsage.Tokens.InputOther += tokens.InputOther
+			newUsage.Tokens.Output += tokens.Output
+			newUsage.Tokens.InputCacheRead += tokens.InputCacheRead
+			newUsage.Tokens.InputCacheCreation += tokens.InputCacheCreation
+		}
+		if p.CompareAndSwap(oldUsage, newUsage) {
+			return
+		}
+	}
+}
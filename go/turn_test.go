@@ -2,8 +2,15 @@ package kimi
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"reflect"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
@@ -249,6 +256,95 @@ func TestTurn_traverse_StatusUpdate_ContextUsage(t *testing.T) {
 	}
 }
 
+func TestStep_Usage(t *testing.T) {
+	turn, _, msgs, _, cleanup := setupTurn(t)
+	defer cleanup()
+
+	tokens := func(input, output int) wire.Optional[wire.TokenUsage] {
+		return wire.Optional[wire.TokenUsage]{Valid: true, Value: wire.TokenUsage{InputOther: input, Output: output}}
+	}
+	nextStep := func() *Step {
+		select {
+		case step := <-turn.Steps:
+			return step
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for step")
+			return nil
+		}
+	}
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	first := nextStep()
+	msgs <- wire.StatusUpdate{TokenUsage: tokens(100, 10)}
+	msgs <- wire.StatusUpdate{TokenUsage: tokens(50, 5)}
+	msgs <- wire.StepBegin{N: 2}
+	second := nextStep()
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.5},
+		TokenUsage:   tokens(1000, 200),
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if got := first.Usage(); got.Tokens.InputOther != 150 || got.Tokens.Output != 15 {
+		t.Errorf("expected first step usage 150/15, got %+v", got.Tokens)
+	}
+	if got := second.Usage(); got.Tokens.InputOther != 1000 || got.Tokens.Output != 200 || got.Context != 0.5 {
+		t.Errorf("expected second step usage 1000/200 at 0.5, got %+v", got)
+	}
+	if got := turn.Usage(); got.Tokens.InputOther != 1150 || got.Tokens.Output != 215 {
+		t.Errorf("expected turn usage to be the sum 1150/215, got %+v", got.Tokens)
+	}
+}
+
+func TestTurn_ContextUsagePercent(t *testing.T) {
+	turn, _, msgs, _, cleanup := setupTurn(t)
+	defer cleanup()
+
+	if percent := turn.ContextUsagePercent(); percent != 0 {
+		t.Errorf("expected 0 before any status update, got %d", percent)
+	}
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.756},
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if percent := turn.ContextUsagePercent(); percent != 76 {
+		t.Errorf("expected 76, got %d", percent)
+	}
+	if s := turn.ContextUsageString(); s != "76%" {
+		t.Errorf("expected %q, got %q", "76%", s)
+	}
+}
+
+func TestTurn_ContextTruncated(t *testing.T) {
+	turn, _, msgs, _, cleanup := setupTurn(t)
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.9},
+	}
+	time.Sleep(100 * time.Millisecond)
+	if turn.ContextTruncated() {
+		t.Error("expected ContextTruncated=false below a full context")
+	}
+
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 1},
+	}
+	// A later update with lower usage does not clear the flag.
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.4},
+	}
+	time.Sleep(100 * time.Millisecond)
+	if !turn.ContextTruncated() {
+		t.Error("expected ContextTruncated=true after the context filled up")
+	}
+}
+
 func TestTurn_traverse_StatusUpdate_TokenUsage(t *testing.T) {
 	turn, _, msgs, _, cleanup := setupTurn(t)
 	defer cleanup()
@@ -467,3 +563,835 @@ func TestTurn_traverse_NoUnexpectedEOF_WireVersion11(t *testing.T) {
 		t.Error("expected status to NOT be UnexpectedEOF for wire version < 1.2")
 	}
 }
+
+func TestTurn_Summary(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.25},
+		TokenUsage:   wire.Optional[wire.TokenUsage]{Valid: true, Value: wire.TokenUsage{InputOther: 10, Output: 5}},
+	}
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.ToolCall{ID: "call-2", Function: wire.ToolCallFunction{Name: "fetch", Arguments: wire.Optional[string]{Valid: true, Value: `{"url":`}}}
+	msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Valid: true, Value: `"https://go.dev"}`}}
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	summary := turn.Summary()
+	if summary.Status != wire.PromptResultStatusPending {
+		t.Errorf("expected status pending, got %s", summary.Status)
+	}
+	if summary.Steps != 2 {
+		t.Errorf("expected Steps=2, got %d", summary.Steps)
+	}
+	if !reflect.DeepEqual(summary.ToolCalls, []string{"search", "fetch"}) {
+		t.Errorf("expected ToolCalls=[search fetch], got %v", summary.ToolCalls)
+	}
+	if !reflect.DeepEqual(summary.ToolCallArguments, []string{"", `{"url":"https://go.dev"}`}) {
+		t.Errorf("unexpected ToolCallArguments: %q", summary.ToolCallArguments)
+	}
+	if summary.Usage.Context != 0.25 || summary.Usage.Tokens.InputOther != 10 || summary.Usage.Tokens.Output != 5 {
+		t.Errorf("unexpected usage: %+v", summary.Usage)
+	}
+	if summary.Duration <= 0 {
+		t.Errorf("expected positive duration, got %s", summary.Duration)
+	}
+	if summary.Cancelled {
+		t.Error("expected Cancelled=false")
+	}
+	if summary.Err != nil {
+		t.Errorf("expected nil Err, got %v", summary.Err)
+	}
+}
+
+func TestTurn_Summary_Cancelled(t *testing.T) {
+	turn, _, _, _, cleanup := setupTurn(t)
+	defer cleanup()
+
+	turn.resultPointer.Store(&wire.PromptResult{
+		Status: wire.PromptResultStatusCancelled,
+		Steps:  wire.Optional[int]{Valid: true, Value: 4},
+	})
+
+	summary := turn.Summary()
+	if !summary.Cancelled {
+		t.Error("expected Cancelled=true")
+	}
+	if summary.Steps != 4 {
+		t.Errorf("expected Steps=4 from result, got %d", summary.Steps)
+	}
+}
+
+func TestTurn_TruncatedToolCall_ArgRepair(t *testing.T) {
+	for _, argRepair := range []bool{false, true} {
+		turn, _, msgs, cancel, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+		turn.argRepair = argRepair
+
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.ToolCall{
+			ID:       "call-1",
+			Function: wire.ToolCallFunction{Name: "write_file", Arguments: wire.Optional[string]{Value: `{"path":`, Valid: true}},
+		}
+		msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `"/tmp/a.txt","content":"hel`, Valid: true}}
+		closeMsgs()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for step := range turn.Steps {
+				for range step.Messages {
+				}
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			cancel()
+			t.Fatal("timeout waiting for turn to finish")
+		}
+
+		if status := turn.Result().Status; status != wire.PromptResultStatusUnexpectedEOF {
+			t.Errorf("expected status UnexpectedEOF, got %s", status)
+		}
+		call, ok := turn.TruncatedToolCall()
+		if !ok {
+			t.Fatal("expected a truncated tool call")
+		}
+		if call.ID != "call-1" || call.Function.Name != "write_file" {
+			t.Errorf("unexpected tool call: %+v", call)
+		}
+		args := call.Function.Arguments.Value
+		if argRepair {
+			if args != `{"path":"/tmp/a.txt","content":"hel"}` {
+				t.Errorf("unexpected repaired arguments: %s", args)
+			}
+		} else if args != `{"path":"/tmp/a.txt","content":"hel` {
+			t.Errorf("unexpected raw arguments: %s", args)
+		}
+		cleanup()
+	}
+}
+
+func TestTurn_IsEmpty(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		messages []wire.Message
+		empty    bool
+	}{
+		{"no content", nil, true},
+		{"empty text and thinking", []wire.Message{wire.NewTextContentPart(""), wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "hmm", Valid: true}}}, true},
+		{"text", []wire.Message{wire.NewTextContentPart("Done.")}, false},
+		{"image", []wire.Message{wire.NewImageContentPart("https://example.com/chart.png")}, false},
+		{"tool call", []wire.Message{wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}, wire.ToolResult{ToolCallID: "call-1"}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+			defer cleanup()
+
+			go func() {
+				msgs <- wire.TurnBegin{}
+				msgs <- wire.StepBegin{N: 1}
+				for _, msg := range tc.messages {
+					msgs <- msg
+				}
+				msgs <- wire.TurnEnd{}
+			}()
+			collectStepMessages(t, turn, cancel)
+
+			if got := turn.IsEmpty(); got != tc.empty {
+				t.Errorf("IsEmpty() = %v, want %v", got, tc.empty)
+			}
+		})
+	}
+}
+
+func TestTurn_TruncatedToolCall_CompletedCall(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search"}}
+	msgs <- wire.ToolResult{ToolCallID: "call-1"}
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	if call, ok := turn.TruncatedToolCall(); ok {
+		t.Errorf("expected no truncated tool call, got %+v", call)
+	}
+}
+
+func TestTurn_TruncatedToolCall_TurnEnded(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	go func() {
+		msgs <- wire.TurnBegin{}
+		msgs <- wire.StepBegin{N: 1}
+		msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "search", Arguments: wire.Optional[string]{Value: `{"query":`, Valid: true}}}
+		msgs <- wire.TurnEnd{}
+	}()
+	collectStepMessages(t, turn, cancel)
+
+	if call, ok := turn.TruncatedToolCall(); ok {
+		t.Errorf("expected no truncated tool call for a turn that ended, got %+v", call)
+	}
+}
+
+func TestTurn_TruncatedToolCall_OutOfOrderResults(t *testing.T) {
+	turn, _, msgs, cancel, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "fetch", Arguments: wire.Optional[string]{Value: `{"url":`, Valid: true}}}
+	msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `"https://example.com"}`, Valid: true}}
+	msgs <- wire.ToolCall{ID: "call-2", Function: wire.ToolCallFunction{Name: "search", Arguments: wire.Optional[string]{Value: `{"query":"go"}`, Valid: true}}}
+	msgs <- wire.ToolResult{ToolCallID: "call-2"}
+	closeMsgs()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	call, ok := turn.TruncatedToolCall()
+	if !ok {
+		t.Fatal("expected the slow call to still be in progress")
+	}
+	if call.ID != "call-1" || call.Function.Arguments.Value != `{"url":"https://example.com"}` {
+		t.Errorf("unexpected tool call: %+v", call)
+	}
+}
+
+func TestTurn_AgentErrors(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ToolResult{ToolCallID: "call-1", ReturnValue: wire.ToolResultReturnValue{
+		Output: wire.NewStringContent("ok"),
+	}}
+	msgs <- wire.ToolResult{ToolCallID: "call-2", ReturnValue: wire.ToolResultReturnValue{
+		IsError: true,
+		Output:  wire.NewStringContent("permission denied"),
+	}}
+	msgs <- wire.ToolResult{ToolCallID: "call-3", ReturnValue: wire.ToolResultReturnValue{
+		IsError: true,
+		Message: "timed out",
+		Output:  wire.NewContent(wire.NewTextContentPart("partial")),
+	}}
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	errs := turn.AgentErrors()
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 agent errors, got %d: %+v", len(errs), errs)
+	}
+	if errs[0].Kind != AgentErrorKindTool || errs[0].ToolCallID != "call-2" || errs[0].Message != "permission denied" {
+		t.Errorf("unexpected first agent error: %+v", errs[0])
+	}
+	if errs[1].ToolCallID != "call-3" || errs[1].Message != "timed out" {
+		t.Errorf("unexpected second agent error: %+v", errs[1])
+	}
+}
+
+func TestTurn_AgentErrors_CustomClassifier(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+	turn.classifyError = func(event wire.Event) (AgentError, bool) {
+		if subagent, ok := event.(wire.SubagentEvent); ok {
+			return AgentError{Kind: "subagent", Event: subagent}, true
+		}
+		return ClassifyAgentError(event)
+	}
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.SubagentEvent{}
+	msgs <- wire.ToolResult{ToolCallID: "call-1", ReturnValue: wire.ToolResultReturnValue{IsError: true, Message: "boom"}}
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	errs := turn.AgentErrors()
+	if len(errs) != 2 || errs[0].Kind != "subagent" || errs[1].Kind != AgentErrorKindTool {
+		t.Errorf("unexpected agent errors: %+v", errs)
+	}
+}
+
+func TestTurn_VerifyEcho(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     wire.Content
+		echoed   wire.Content
+		mismatch bool
+	}{
+		{"identical", wire.NewStringContent("hello"), wire.NewStringContent("hello"), false},
+		{"text as part", wire.NewStringContent("hello"), wire.NewContent(wire.NewTextContentPart("hello")), false},
+		{"altered", wire.NewStringContent("hello"), wire.NewStringContent("hell"), true},
+		{
+			"dropped image",
+			wire.NewContent(wire.NewTextContentPart("what is this?"), wire.NewImageContentPart("data:image/png;base64,AAAA")),
+			wire.NewContent(wire.NewTextContentPart("what is this?")),
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+			defer cleanup()
+			var warnings []wire.Content
+			turn.input = tt.sent
+			turn.onEchoMismatch = func(sent, echoed wire.Content) {
+				warnings = append(warnings, echoed)
+			}
+
+			msgs <- wire.TurnBegin{UserInput: tt.echoed}
+			msgs <- wire.TurnEnd{}
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for step := range turn.Steps {
+					for range step.Messages {
+					}
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				cancel()
+				t.Fatal("timeout waiting for turn to finish")
+			}
+
+			if got := len(warnings) == 1; got != tt.mismatch {
+				t.Errorf("expected mismatch=%v, got %d warnings", tt.mismatch, len(warnings))
+			}
+		})
+	}
+}
+
+func TestTurn_Err_UnexpectedEOFCarriesPartialOutput(t *testing.T) {
+	turn, _, msgs, cancel, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("The answer ")
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "hmm", Valid: true}}
+	msgs <- wire.NewTextContentPart("is")
+	msgs <- wire.StatusUpdate{}
+	closeMsgs()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	err := turn.Err()
+	var turnErr *TurnError
+	if !errors.As(err, &turnErr) {
+		t.Fatalf("expected *TurnError, got %T: %v", err, err)
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected error to wrap io.ErrUnexpectedEOF, got %v", err)
+	}
+	if turnErr.Status != wire.PromptResultStatusUnexpectedEOF {
+		t.Errorf("expected status UnexpectedEOF, got %s", turnErr.Status)
+	}
+	if turnErr.PartialText != "The answer is" {
+		t.Errorf("unexpected partial text: %q", turnErr.PartialText)
+	}
+	if turnErr.LastEventType != wire.EventTypeStatusUpdate {
+		t.Errorf("expected last event StatusUpdate, got %s", turnErr.LastEventType)
+	}
+}
+
+func TestTurn_Err_NilOnTurnEnd(t *testing.T) {
+	turn, _, msgs, cancel, _, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("done")
+	msgs <- wire.TurnEnd{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for step := range turn.Steps {
+			for range step.Messages {
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		cancel()
+		t.Fatal("timeout waiting for turn to finish")
+	}
+
+	if err := turn.Err(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestTurn_Drain(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.1")
+	defer cleanup()
+
+	var response wire.RequestResponse
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("Warming up")
+	msgs <- wire.ApprovalRequest{
+		ID:     "approval-1",
+		Action: "run command",
+		Responder: ResponderFunc(func(r wire.RequestResponse) error {
+			response = r
+			return nil
+		}),
+	}
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.NewTextContentPart("Done")
+	closeMsgs()
+
+	if err := turn.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	if response != wire.ApprovalRequestResponseReject {
+		t.Errorf("expected the approval request to be rejected, got %v", response)
+	}
+	if _, ok := <-turn.Steps; ok {
+		t.Error("expected Steps to be closed after Drain")
+	}
+	if got := turn.Summary().Steps; got != 2 {
+		t.Errorf("expected 2 steps to be consumed, got %d", got)
+	}
+}
+
+func TestTurn_Text(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "Let me think", Valid: true}}
+	msgs <- wire.NewTextContentPart("Hello, ")
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.NewTextContentPart("world!")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	text, err := turn.Text(context.Background())
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	if text != "Hello, world!" {
+		t.Errorf("expected %q, got %q", "Hello, world!", text)
+	}
+}
+
+func TestTurn_Text_PartiallyConsumed(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "Greet first.", Valid: true}}
+	msgs <- wire.NewTextContentPart("Hello, ")
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.NewTextContentPart("world!")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	// Read the first step before handing the turn over to Text and Think.
+	step := <-turn.Steps
+	for range step.Messages {
+	}
+	text, err := turn.Text(context.Background())
+	if err != nil || text != "Hello, world!" {
+		t.Errorf("expected the text of the whole turn, got %q, %v", text, err)
+	}
+	think, err := turn.Think(context.Background())
+	if err != nil || think != "Greet first." {
+		t.Errorf("expected the reasoning of the whole turn, got %q, %v", think, err)
+	}
+}
+
+func TestTurn_Think(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "The user greets. ", Valid: true}}
+	msgs <- wire.NewTextContentPart("Hello!")
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "Say goodbye.", Valid: true}}
+	msgs <- wire.NewTextContentPart(" Bye!")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	text, err := turn.Text(context.Background())
+	if err != nil || text != "Hello! Bye!" {
+		t.Fatalf("expected the answer, got %q, %v", text, err)
+	}
+	// The reasoning is still available once the turn was consumed.
+	think, err := turn.Think(context.Background())
+	if err != nil {
+		t.Fatalf("Think: %v", err)
+	}
+	if think != "The user greets. Say goodbye." {
+		t.Errorf("expected %q, got %q", "The user greets. Say goodbye.", think)
+	}
+	if turn.ThinkEncrypted() {
+		t.Error("expected ThinkEncrypted=false without encrypted think parts")
+	}
+}
+
+func TestTurn_Think_Encrypted(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ContentPart{Type: wire.ContentPartTypeThink, Think: wire.Optional[string]{Value: "", Valid: true}, Encrypted: wire.Optional[string]{Value: "gAAAAB...", Valid: true}}
+	msgs <- wire.NewTextContentPart("42")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	think, err := turn.Think(context.Background())
+	if err != nil {
+		t.Fatalf("Think: %v", err)
+	}
+	if think != "" {
+		t.Errorf("expected no readable reasoning, got %q", think)
+	}
+	if !turn.ThinkEncrypted() {
+		t.Error("expected ThinkEncrypted=true after an encrypted think part")
+	}
+}
+
+func TestTurn_ToolCalls(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.ToolCall{ID: "call-1", Function: wire.ToolCallFunction{Name: "fetch", Arguments: wire.Optional[string]{Value: `{"url":`, Valid: true}}}
+	msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `"https://go.dev"`, Valid: true}}
+	msgs <- wire.ToolCallPart{ArgumentsPart: wire.Optional[string]{Value: `}`, Valid: true}}
+	msgs <- wire.ToolCall{ID: "call-2", Function: wire.ToolCallFunction{Name: "search", Arguments: wire.Optional[string]{Value: `{"q":"go"}`, Valid: true}}}
+	// Results may arrive in any order.
+	msgs <- wire.ToolResult{ToolCallID: "call-2", ReturnValue: wire.ToolResultReturnValue{Output: wire.NewStringContent("3 hits")}}
+	msgs <- wire.ToolResult{ToolCallID: "call-1", ReturnValue: wire.ToolResultReturnValue{IsError: true, Output: wire.NewStringContent("timeout")}}
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.ToolCall{ID: "call-3", Function: wire.ToolCallFunction{Name: "fetch", Arguments: wire.Optional[string]{Value: `{"url":"https://pkg.go.dev"}`, Valid: true}}}
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	records, err := turn.ToolCalls(context.Background())
+	if err != nil {
+		t.Fatalf("ToolCalls: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	if got := records[0].Call.Function.Arguments.Value; got != `{"url":"https://go.dev"}` {
+		t.Errorf("expected the arguments reassembled, got %q", got)
+	}
+	if records[0].Result == nil || !records[0].Result.ReturnValue.IsError {
+		t.Errorf("expected call-1 paired with its error result, got %+v", records[0].Result)
+	}
+	if records[1].Call.ID != "call-2" || records[1].Result == nil || records[1].Result.ToolCallID != "call-2" {
+		t.Errorf("expected call-2 paired with its result, got %+v", records[1])
+	}
+	if records[2].Call.ID != "call-3" || records[2].Result != nil {
+		t.Errorf("expected call-3 without a result, got %+v", records[2])
+	}
+}
+
+func TestTurn_Wait_PartiallyConsumed(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("first")
+	msgs <- wire.NewTextContentPart("second")
+	msgs <- wire.StatusUpdate{
+		ContextUsage: wire.Optional[float64]{Valid: true, Value: 0.5},
+	}
+	msgs <- wire.StepBegin{N: 2}
+	msgs <- wire.NewTextContentPart("third")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	// Read the first message of the first step only, then abandon it.
+	step := <-turn.Steps
+	if msg := <-step.Messages; msg.(wire.ContentPart).Text.Value != "first" {
+		t.Fatalf("unexpected first message: %v", msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := turn.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if _, ok := <-turn.Steps; ok {
+		t.Error("expected Steps to be closed after Wait")
+	}
+	if got := turn.Summary().Steps; got != 2 {
+		t.Errorf("expected 2 steps, got %d", got)
+	}
+	if usage := turn.Usage(); usage.Context != 0.5 {
+		t.Errorf("expected Context=0.5, got %f", usage.Context)
+	}
+	if status := turn.Result().Status; status == wire.PromptResultStatusUnexpectedEOF {
+		t.Errorf("expected the turn to end with TurnEnd, got status %s", status)
+	}
+}
+
+func TestTurn_Wait_StepNotReceived(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+	msgs <- wire.NewTextContentPart("unread")
+	msgs <- wire.TurnEnd{}
+	closeMsgs()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := turn.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+}
+
+func TestTurn_Drain_ContextDone(t *testing.T) {
+	turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.1")
+	defer cleanup()
+
+	msgs <- wire.TurnBegin{}
+	msgs <- wire.StepBegin{N: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- turn.Drain(ctx) }()
+	// The agent ends the stream once the turn is cancelled.
+	<-ctx.Done()
+	closeMsgs()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain did not return after its context was done")
+	}
+	if _, ok := <-turn.Steps; ok {
+		t.Error("expected Steps to be closed after Drain")
+	}
+}
+
+func TestTurn_RetryUnexpectedEOF_SkippedAfterCancel(t *testing.T) {
+	for _, cancelled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("cancelled=%v", cancelled), func(t *testing.T) {
+			turn, _, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+			defer cleanup()
+
+			var retries atomic.Int32
+			turn.retry = func(...turnOption) (*Turn, error) {
+				retries.Add(1)
+				return nil, nil
+			}
+			msgs <- wire.TurnBegin{}
+			msgs <- wire.StepBegin{N: 1}
+			if cancelled {
+				done := make(chan error, 1)
+				go func() { done <- turn.Cancel() }()
+				// The agent ends the stream without TurnEnd once the turn is cancelled.
+				closeMsgs()
+				<-done
+			} else {
+				closeMsgs()
+			}
+			for step := range turn.Steps {
+				for range step.Messages {
+				}
+			}
+
+			if got := turn.Result().Status; got != wire.PromptResultStatusUnexpectedEOF {
+				t.Fatalf("expected status %q, got %q", wire.PromptResultStatusUnexpectedEOF, got)
+			}
+			want := int32(1)
+			if cancelled {
+				want = 0
+			}
+			if got := retries.Load(); got != want {
+				t.Errorf("expected %d retries, got %d", want, got)
+			}
+		})
+	}
+}
+
+func TestTurn_RetryUnexpectedEOF_CancelWithStepsUnread(t *testing.T) {
+	turn, mockTP, msgs, _, closeMsgs, cleanup := setupTurnWithVersion(t, "1.2")
+	defer cleanup()
+
+	retryMsgs := make(chan wire.Message, 10)
+	retryResult := new(atomic.Pointer[wire.PromptResult])
+	turn.retry = func(options ...turnOption) (*Turn, error) {
+		exit := func(err error) error { return err }
+		return turnBegin(context.Background(), 1, mockTP, new(atomic.Pointer[error]), retryResult, "1.2", retryMsgs, make(chan wire.RequestResponse, 1), exit, options...), nil
+	}
+	msgs <- wire.TurnBegin{}
+	closeMsgs()
+	retryMsgs <- wire.TurnBegin{}
+	retryMsgs <- wire.StepBegin{N: 1}
+
+	// Steps is never read, so the step of the retry cannot be delivered.
+	time.Sleep(50 * time.Millisecond)
+	if err := turn.Cancel(); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	// The agent ends the stream once the turn is cancelled.
+	close(retryMsgs)
+	deadline := time.Now().Add(5 * time.Second)
+	for turn.resultPointer.Load() != retryResult.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the turn to end once cancelled, with its steps unread")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name   string
+		status wire.PromptResultStatus
+		err    error
+		want   bool
+	}{
+		{"finished", wire.PromptResultStatusFinished, nil, false},
+		{"cancelled", wire.PromptResultStatusCancelled, nil, false},
+		{"max steps reached", wire.PromptResultStatusMaxStepsReached, nil, false},
+		{"unexpected EOF", wire.PromptResultStatusUnexpectedEOF, nil, true},
+		{"pending without error", wire.PromptResultStatusPending, nil, false},
+		{"connection shut down", wire.PromptResultStatusPending, rpc.ErrShutdown, true},
+		{"broken pipe", wire.PromptResultStatusPending, fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{"network error", wire.PromptResultStatusPending, &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"stream cut", wire.PromptResultStatusPending, io.ErrUnexpectedEOF, true},
+		{"context cancelled", wire.PromptResultStatusPending, context.Canceled, false},
+		{"deadline exceeded", wire.PromptResultStatusPending, fmt.Errorf("prompt: %w", context.DeadlineExceeded), false},
+		{"session closed", wire.PromptResultStatusPending, ErrSessionClosed, false},
+		{"turn not found", wire.PromptResultStatusPending, ErrTurnNotFound, false},
+		{"agent error", wire.PromptResultStatusPending, rpc.ServerError(`{"code":-32603,"message":"LLM is not set"}`), false},
+		{"finished with error", wire.PromptResultStatusFinished, io.ErrUnexpectedEOF, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			turn := &Turn{
+				errorPointer:  new(atomic.Pointer[error]),
+				resultPointer: new(atomic.Pointer[wire.PromptResult]),
+			}
+			turn.resultPointer.Store(&wire.PromptResult{Status: tt.status})
+			if tt.err != nil {
+				turn.errorPointer.Store(&tt.err)
+			}
+			if got := IsRetryable(turn); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if IsRetryable(nil) {
+		t.Error("expected a nil turn not to be retryable")
+	}
+}
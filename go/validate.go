@@ -0,0 +1,256 @@
+package kimi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// argSchema is a compiled JSON schema against which tool arguments are checked.
+// It supports the keywords the schema generator emits, plus enum: type,
+// properties, required, items, additionalProperties, enum, the numeric bounds,
+// minLength, maxLength and pattern. Other keywords are ignored.
+type argSchema struct {
+	reject   bool // the schema is false: no value is valid
+	nullable bool // null is valid too, e.g. for a pointer field
+
+	types                []string
+	properties           map[string]*argSchema
+	required             []string
+	items                *argSchema
+	additionalProperties *argSchema
+	enum                 []any
+	minimum              *float64
+	maximum              *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	minLength            *int
+	maxLength            *int
+	pattern              *regexp.Regexp
+}
+
+func compileArgSchema(raw json.RawMessage) (*argSchema, error) {
+	raw = bytes.TrimSpace(raw)
+	switch string(raw) {
+	case "true":
+		return &argSchema{}, nil
+	case "false":
+		return &argSchema{reject: true}, nil
+	}
+	var keywords struct {
+		Type                 json.RawMessage            `json:"type"`
+		Properties           map[string]json.RawMessage `json:"properties"`
+		Required             []string                   `json:"required"`
+		Items                json.RawMessage            `json:"items"`
+		AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+		Enum                 []any                      `json:"enum"`
+		Minimum              *float64                   `json:"minimum"`
+		Maximum              *float64                   `json:"maximum"`
+		ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+		ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+		MinLength            *int                       `json:"minLength"`
+		MaxLength            *int                       `json:"maxLength"`
+		Pattern              string                     `json:"pattern"`
+	}
+	if err := json.Unmarshal(raw, &keywords); err != nil {
+		return nil, err
+	}
+	schema := &argSchema{
+		required:         keywords.Required,
+		enum:             keywords.Enum,
+		minimum:          keywords.Minimum,
+		maximum:          keywords.Maximum,
+		exclusiveMinimum: keywords.ExclusiveMinimum,
+		exclusiveMaximum: keywords.ExclusiveMaximum,
+		minLength:        keywords.MinLength,
+		maxLength:        keywords.MaxLength,
+	}
+	if len(keywords.Type) > 0 {
+		var typ string
+		if err := json.Unmarshal(keywords.Type, &typ); err == nil {
+			schema.types = []string{typ}
+		} else if err := json.Unmarshal(keywords.Type, &schema.types); err != nil {
+			return nil, fmt.Errorf("type: %w", err)
+		}
+	}
+	if len(keywords.Properties) > 0 {
+		schema.properties = make(map[string]*argSchema, len(keywords.Properties))
+		for name, property := range keywords.Properties {
+			compiled, err := compileArgSchema(property)
+			if err != nil {
+				return nil, fmt.Errorf("property %s: %w", name, err)
+			}
+			schema.properties[name] = compiled
+		}
+	}
+	var err error
+	if len(keywords.Items) > 0 {
+		if schema.items, err = compileArgSchema(keywords.Items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+	if len(keywords.AdditionalProperties) > 0 {
+		if schema.additionalProperties, err = compileArgSchema(keywords.AdditionalProperties); err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+	}
+	if keywords.Pattern != "" {
+		if schema.pattern, err = regexp.Compile(keywords.Pattern); err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+	}
+	return schema, nil
+}
+
+// allowNull makes null valid for the value at path, a JSON path as recorded by
+// the schema generator, where "*" stands for any element of an array or value
+// of a map.
+func (s *argSchema) allowNull(path []string) {
+	for _, name := range path {
+		switch {
+		case name == "*" && s.items != nil:
+			s = s.items
+		case name == "*":
+			s = s.additionalProperties
+		default:
+			s = s.properties[name]
+		}
+		if s == nil {
+			return
+		}
+	}
+	s.nullable = true
+}
+
+// validate checks the tool arguments args against the schema. The error lists
+// every violation, naming the offending field and the constraint it breaks.
+func (s *argSchema) validate(args json.RawMessage) error {
+	var value any
+	if err := json.Unmarshal(args, &value); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	var violations []string
+	s.check("", value, &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid arguments:\n- %s", strings.Join(violations, "\n- "))
+}
+
+func (s *argSchema) check(path string, value any, violations *[]string) {
+	violate := func(format string, args ...any) {
+		field := path
+		if field == "" {
+			field = "arguments"
+		}
+		*violations = append(*violations, fmt.Sprintf("%s: ", field)+fmt.Sprintf(format, args...))
+	}
+	if s.reject {
+		violate("unexpected field")
+		return
+	}
+	if value == nil && s.nullable {
+		return
+	}
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(typ string) bool { return hasJSONType(value, typ) }) {
+		violate("expected %s, got %s", strings.Join(s.types, " or "), jsonTypeName(value))
+		return
+	}
+	if len(s.enum) > 0 && !slices.ContainsFunc(s.enum, func(allowed any) bool { return reflect.DeepEqual(allowed, value) }) {
+		allowed, _ := json.Marshal(s.enum)
+		violate("must be one of %s", allowed)
+	}
+	switch v := value.(type) {
+	case float64:
+		number := strconv.FormatFloat(v, 'g', -1, 64)
+		if s.minimum != nil && v < *s.minimum {
+			violate("must be >= %v, got %s", *s.minimum, number)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			violate("must be <= %v, got %s", *s.maximum, number)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			violate("must be > %v, got %s", *s.exclusiveMinimum, number)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			violate("must be < %v, got %s", *s.exclusiveMaximum, number)
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			violate("must be at least %d characters long, got %d", *s.minLength, length)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			violate("must be at most %d characters long, got %d", *s.maxLength, length)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			violate("must match the pattern %s", s.pattern)
+		}
+	case []any:
+		if s.items != nil {
+			for i, item := range v {
+				s.items.check(fmt.Sprintf("%s[%d]", path, i), item, violations)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				violate("missing required field %q", name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(v)) {
+			field := name
+			if path != "" {
+				field = path + "." + name
+			}
+			if property, ok := s.properties[name]; ok {
+				property.check(field, v[name], violations)
+			} else if s.additionalProperties != nil {
+				s.additionalProperties.check(field, v[name], violations)
+			}
+		}
+	}
+}
+
+func hasJSONType(value any, typ string) bool {
+	switch v := value.(type) {
+	case nil:
+		return typ == "null"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || typ == "integer" && v == math.Trunc(v)
+	case string:
+		return typ == "string"
+	case []any:
+		return typ == "array"
+	case map[string]any:
+		return typ == "object"
+	}
+	return false
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
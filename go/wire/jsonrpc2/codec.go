@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net/rpc"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,6 +18,14 @@ import (
 
 const JSONRPC2Version = "2.0"
 
+// writeChunkSize bounds how much of a request frame is written before the codec
+// checks again whether the write has been interrupted.
+const writeChunkSize = 32 << 10
+
+// ErrWriteInterrupted is the error a call fails with when InterruptWrite abandons
+// its request frame. Match it with ParseError.
+var ErrWriteInterrupted = Error{Code: ErrorCodeInternalError, Message: "request write interrupted"}
+
 func NewCodec(rwc io.ReadWriteCloser, options ...CodecOption) *Codec {
 	donectx, cancel := context.WithCancel(context.Background())
 	codec := &Codec{
@@ -30,6 +40,8 @@ func NewCodec(rwc io.ReadWriteCloser, options ...CodecOption) *Codec {
 		outpls:         make(chan *Payload),
 		inreqs:         make(chan Request),
 		inress:         make(chan Response),
+		writes:         make(map[any]*interruptibleWrite),
+		interrupted:    make(chan Response),
 		senders:        make(map[string]<-chan json.RawMessage),
 		senderwaker:    make(chan string),
 		receivers:      make(map[string]chan<- json.RawMessage),
@@ -77,6 +89,24 @@ func WaitStreamTimeout(timeout time.Duration) CodecOption {
 	}
 }
 
+// LenientJSON makes the codec tolerate common non-standard JSON in inbound frames,
+// such as trailing commas and // or /* */ comments. Outbound frames are always strict.
+func LenientJSON() CodecOption {
+	return func(codec *Codec) {
+		codec.dec = json.NewDecoder(newLenientReader(codec.rwc))
+	}
+}
+
+// FrameLogger logs each frame the codec sends or receives to logger at level,
+// with its direction, ID, method and JSON encoding. Frames are only encoded for
+// the log when logger is enabled for level.
+func FrameLogger(logger *slog.Logger, level slog.Level) CodecOption {
+	return func(codec *Codec) {
+		codec.logger = logger
+		codec.loglevel = level
+	}
+}
+
 type Codec struct {
 	// --- Configuration ---
 	// Configurable options for method renaming, ID generation, and timeouts.
@@ -85,6 +115,8 @@ type Codec struct {
 	jsonidGenerator     Generator[string] // Generates JSON-RPC request IDs.
 	shutdownTimeout     time.Duration     // Graceful shutdown timeout (default 15s).
 	waitStreamTimeout   time.Duration     // Stream idle wait timeout (default 30s).
+	logger              *slog.Logger      // Logs the frames sent and received, if set.
+	loglevel            slog.Level        // Level of the frame logs.
 
 	// --- Lifecycle control ---
 	// Context and wait group for managing goroutine lifecycle.
@@ -99,6 +131,12 @@ type Codec struct {
 	dec *json.Decoder      // JSON decoder (used by recv goroutine).
 	err atomic.Value       // Stores the first I/O error atomically.
 
+	// --- Interruptible writes ---
+	// The client request frames not written yet, which InterruptWrite can abandon.
+	writelock   sync.Mutex                  // Mutex protecting writes.
+	writes      map[any]*interruptibleWrite // Maps the argument of a call -> its request frame.
+	interrupted chan Response               // Synthesized error responses for interrupted requests.
+
 	// --- Request flight counting ---
 	// Tracks requests that have been decoded but not yet registered.
 	// inflight counts decoded requests that have not yet been registered in srvreqids.
@@ -241,7 +279,14 @@ func (c *Codec) send() {
 			}
 			payload = out
 		}
-		if err := c.enc.Encode(payload); err != nil {
+		c.logFrame("send", payload)
+		var err error
+		if payload.Method != "" && payload.ID != "" {
+			err = c.writeRequest(payload)
+		} else {
+			err = c.enc.Encode(payload)
+		}
+		if err != nil {
 			c.cancel()
 			c.err.CompareAndSwap(nil, &wraperror{err})
 			return
@@ -249,6 +294,119 @@ func (c *Codec) send() {
 	}
 }
 
+// logFrame logs payload, sent or received according to direction, if the codec
+// has a logger enabled for its level.
+func (c *Codec) logFrame(direction string, payload *Payload) {
+	if c.logger == nil || !c.logger.Enabled(context.Background(), c.loglevel) {
+		return
+	}
+	frame, _ := json.Marshal(payload)
+	c.logger.Log(context.Background(), c.loglevel, "jsonrpc2 frame",
+		"direction", direction, "id", payload.ID, "method", payload.Method, "frame", string(frame))
+}
+
+// interruptibleWrite is the frame of a client request, from the call to
+// WriteRequest until it has been written.
+type interruptibleWrite struct {
+	args any
+	once sync.Once
+	done chan struct{}
+}
+
+// interrupted returns a channel closed once InterruptWrite abandons the frame,
+// or nil for a frame that cannot be abandoned.
+func (w *interruptibleWrite) interrupted() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.done
+}
+
+// InterruptWrite abandons the frame of the client request made with args, the
+// pointer passed to the call, if it is yet to be written or being written, and
+// reports whether it was. It lets a caller stop transmitting a large request
+// (e.g. a prompt carrying an image) that is no longer wanted, without touching
+// the frames of other requests. A frame abandoned part way is terminated with a
+// newline so that the peer discards it as one malformed line. Either way, the
+// call fails with ErrWriteInterrupted.
+func (c *Codec) InterruptWrite(args any) bool {
+	if reflect.ValueOf(args).Kind() != reflect.Pointer {
+		return false
+	}
+	c.writelock.Lock()
+	write := c.writes[args]
+	c.writelock.Unlock()
+	if write == nil {
+		return false
+	}
+	write.once.Do(func() {
+		close(write.done)
+	})
+	return true
+}
+
+// trackWrite registers the frame of the client request made with args, so that
+// InterruptWrite can abandon it. It returns nil if args is not a pointer.
+func (c *Codec) trackWrite(args any) *interruptibleWrite {
+	if reflect.ValueOf(args).Kind() != reflect.Pointer {
+		return nil
+	}
+	write := &interruptibleWrite{args: args, done: make(chan struct{})}
+	c.writelock.Lock()
+	c.writes[args] = write
+	c.writelock.Unlock()
+	return write
+}
+
+// untrackWrite forgets the frame of a client request once it has been written
+// or abandoned.
+func (c *Codec) untrackWrite(write *interruptibleWrite) {
+	if write == nil {
+		return
+	}
+	c.writelock.Lock()
+	defer c.writelock.Unlock()
+	if c.writes[write.args] == write {
+		delete(c.writes, write.args)
+	}
+}
+
+func (c *Codec) writeRequest(payload *Payload) error {
+	write := payload.write
+	defer c.untrackWrite(write)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	for written := 0; written < len(data); {
+		select {
+		case <-write.interrupted():
+			if written > 0 {
+				if _, err := c.rwc.Write([]byte{'\n'}); err != nil {
+					return err
+				}
+			}
+			select {
+			case c.interrupted <- &Payload{
+				Version: JSONRPC2Version,
+				ID:      payload.ID,
+				Error:   json.RawMessage(ErrWriteInterrupted.Error()),
+			}:
+			case <-c.donectx.Done():
+			}
+			return nil
+		default:
+		}
+		n, err := c.rwc.Write(data[written:min(written+writeChunkSize, len(data))])
+		if err != nil {
+			return err
+		}
+		written += n
+	}
+	return nil
+}
+
 func (c *Codec) recv() {
 	defer c.txcloseonce.Do(func() {
 		close(c.inreqs)
@@ -370,6 +528,7 @@ func (c *Codec) recv() {
 			return
 		}
 		if payload != nil {
+			c.logFrame("recv", payload)
 			if payload.Stream > StreamOpen {
 				c.receiverlock.RLock()
 				_, ok := c.receivers[payload.ID]
@@ -565,6 +724,7 @@ func (c *Codec) WriteRequest(r *rpc.Request, x any) error {
 	if streamopen {
 		stream = StreamOpen
 	}
+	write := c.trackWrite(x)
 	select {
 	case c.outpls <- &Payload{
 		Version: JSONRPC2Version,
@@ -572,8 +732,23 @@ func (c *Codec) WriteRequest(r *rpc.Request, x any) error {
 		ID:      reqid,
 		Stream:  stream,
 		Params:  params,
+		write:   write,
 	}:
+	case <-write.interrupted():
+		// The frame was abandoned before the send goroutine took it up.
+		c.untrackWrite(write)
+		c.clilock.Lock()
+		delete(c.clireqids, reqid)
+		delete(c.reqmeth, reqid)
+		c.clilock.Unlock()
+		if streamopen {
+			c.senderlock.Lock()
+			delete(c.senders, reqid)
+			c.senderlock.Unlock()
+		}
+		return rpc.ServerError(ErrWriteInterrupted.Error())
 	case <-c.donectx.Done():
+		c.untrackWrite(write)
 		return c.loadOrFallbackErr(io.EOF)
 	}
 	return nil
@@ -586,6 +761,7 @@ func (c *Codec) ReadResponseHeader(r *rpc.Response) error {
 		if !ok {
 			return c.loadOrFallbackErr(io.EOF)
 		}
+	case c.thisres = <-c.interrupted:
 	case <-c.donectx.Done():
 		return c.loadOrFallbackErr(io.EOF)
 	}
@@ -697,6 +873,8 @@ type Payload struct {
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
 	Error   json.RawMessage `json:"error,omitempty"`
+
+	write *interruptibleWrite // the frame of a client request, see InterruptWrite
 }
 
 func (p *Payload) GetID() string              { return p.ID }
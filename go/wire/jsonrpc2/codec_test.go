@@ -1,9 +1,11 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"io"
+	"log/slog"
 	"net"
 	"net/rpc"
 	"strconv"
@@ -69,6 +71,18 @@ func (TestWireService) Prompt(args *TestArgs, reply *TestReply) error {
 	return nil
 }
 
+// Slow echoes the input, which must be an integer, after a delay that decreases
+// as the input grows, so concurrent calls complete in reverse order.
+func (TestWireService) Slow(args *TestArgs, reply *TestReply) error {
+	n, err := strconv.Atoi(args.UserInput)
+	if err != nil {
+		return err
+	}
+	time.Sleep(time.Duration(100-n) * 100 * time.Microsecond)
+	reply.Echo = args.UserInput
+	return nil
+}
+
 func (TestWireService) Failplain(_ *struct{}, _ *struct{}) error {
 	return errors.New("bad")
 }
@@ -166,6 +180,29 @@ func TestCodec_RPC_RoundTrip_Success(t *testing.T) {
 	}
 }
 
+func TestCodec_RPC_ConcurrentCalls_OutOfOrderResponses(t *testing.T) {
+	client := newRPCClient(t, TestWireService{})
+
+	const n = 100
+	calls := make([]*rpc.Call, n)
+	for i := range n {
+		calls[i] = client.Go("Transport.Slow", &TestArgs{UserInput: strconv.Itoa(i)}, &TestReply{}, nil)
+	}
+	for i, call := range calls {
+		select {
+		case <-call.Done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("call %d did not complete", i)
+		}
+		if call.Error != nil {
+			t.Fatalf("call %d: %v", i, call.Error)
+		}
+		if echo := call.Reply.(*TestReply).Echo; echo != strconv.Itoa(i) {
+			t.Errorf("call %d: got the response of call %s", i, echo)
+		}
+	}
+}
+
 func TestCodec_RPC_Error_PlainStringIsJSONEncodedString(t *testing.T) {
 	client := newRPCClient(t, TestWireService{})
 
@@ -328,6 +365,137 @@ func TestCodec_DecodeError_InvalidJSON_PropagatesNonEOF(t *testing.T) {
 	}
 }
 
+func TestCodec_LenientJSON_TrailingCommaAndComments(t *testing.T) {
+	c1, c2 := net.Pipe()
+	codec := newTestCodec(c1, LenientJSON())
+	defer codec.Close()
+	defer c2.Close()
+
+	go func() {
+		_, _ = io.WriteString(c2, `{"jsonrpc":"2.0", /* block */ "id":"1","method":"prompt", // line
+"params":{"UserInput":"a,}","list":[1,2,],},}`+"\n")
+	}()
+
+	var req rpc.Request
+	if err := codec.ReadRequestHeader(&req); err != nil {
+		t.Fatalf("ReadRequestHeader: %v", err)
+	}
+	if req.ServiceMethod != "Transport.Prompt" {
+		t.Fatalf("expected method Transport.Prompt, got %q", req.ServiceMethod)
+	}
+	var args TestArgs
+	if err := codec.ReadRequestBody(&args); err != nil {
+		t.Fatalf("ReadRequestBody: %v", err)
+	}
+	if args.UserInput != "a,}" {
+		t.Fatalf("expected string literal to be preserved, got %q", args.UserInput)
+	}
+}
+
+func TestLenientReader_Read(t *testing.T) {
+	const (
+		input    = `{"a":[1,2,], /* block */ "b":"c,}" // line` + "\n" + `,}`
+		expected = `{"a":[1,2],   "b":"c,}" ` + "\n" + `}`
+	)
+	// A single read returns all the buffered input.
+	l := newLenientReader(strings.NewReader(input))
+	p := make([]byte, 256)
+	n, err := l.Read(p)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(p[:n]) != expected {
+		t.Fatalf("expected %q, got %q", expected, p[:n])
+	}
+
+	// Reads into a small buffer return the same output.
+	l = newLenientReader(strings.NewReader(input))
+	var out []byte
+	small := make([]byte, 3)
+	for {
+		n, err := l.Read(small)
+		out = append(out, small[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	}
+	if string(out) != expected {
+		t.Fatalf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestCodec_FrameLogger(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		level   slog.Level
+		records int
+	}{
+		{"enabled", slog.LevelDebug, 2},
+		{"disabled", slog.LevelInfo, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: tc.level}))
+
+			c1, c2 := net.Pipe()
+			clientCodec := newTestCodec(c1, FrameLogger(logger, slog.LevelDebug))
+			done := startRPCServer(t, newTestCodec(c2), TestWireService{})
+			client := rpc.NewClientWithCodec(clientCodec)
+
+			var reply TestReply
+			if err := client.Call("Transport.Prompt", &TestArgs{UserInput: "hello"}, &reply); err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+			_ = client.Close()
+			<-done
+
+			var directions []string
+			for line := range strings.Lines(logs.String()) {
+				var record struct {
+					Direction string `json:"direction"`
+					Frame     string `json:"frame"`
+				}
+				if err := json.Unmarshal([]byte(line), &record); err != nil {
+					t.Fatalf("invalid log record %q: %v", line, err)
+				}
+				if !strings.Contains(record.Frame, "hello") {
+					t.Errorf("expected the frame in %s", line)
+				}
+				directions = append(directions, record.Direction)
+			}
+			if len(directions) != tc.records {
+				t.Fatalf("expected %d frame records, got %q", tc.records, directions)
+			}
+			if tc.records > 0 && (directions[0] != "send" || directions[1] != "recv") {
+				t.Errorf("expected a sent then a received frame, got %q", directions)
+			}
+		})
+	}
+}
+
+func TestCodec_StrictJSON_TrailingCommaIsRejected(t *testing.T) {
+	c1, c2 := net.Pipe()
+	codec := newTestCodec(c1)
+	defer codec.Close()
+	defer c2.Close()
+
+	go func() {
+		_, _ = io.WriteString(c2, `{"jsonrpc":"2.0","id":"1","method":"prompt","params":{},}`+"\n")
+	}()
+
+	err := codec.ReadRequestHeader(&rpc.Request{})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected json syntax error, got %T %v", err, err)
+	}
+}
+
 func TestCodec_RPC_UnknownMethod_DiscardBodyAndError(t *testing.T) {
 	client := newRPCClient(t, TestWireService{})
 
@@ -561,6 +729,101 @@ func TestCodec_Send_EncodeError_SetsErrAndSubsequentCallsFail(t *testing.T) {
 	codec.clilock.Unlock()
 }
 
+type slowWriter struct {
+	delay   time.Duration
+	written atomic.Int64
+	last    atomic.Int32
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.written.Add(int64(len(p)))
+	w.last.Store(int32(p[len(p)-1]))
+	return len(p), nil
+}
+
+func TestCodec_InterruptWrite_AbandonsRequestFrame(t *testing.T) {
+	pr, pw := io.Pipe()
+	writer := &slowWriter{delay: 10 * time.Millisecond}
+	codec := newTestCodec(&pipeRWC{r: pr, w: writer})
+	client := rpc.NewClientWithCodec(codec)
+	defer client.Close()
+	defer pw.Close()
+
+	const size = 4 << 20 // takes over a second to write at this pace
+	args := &TestArgs{UserInput: strings.Repeat("x", size)}
+	if codec.InterruptWrite(args) {
+		t.Fatal("expected no write to interrupt while idle")
+	}
+
+	call := client.Go("Transport.Prompt", args, &TestReply{}, nil)
+	waitUntil(t, 1*time.Second, func() bool {
+		return writer.written.Load() > 0
+	})
+	if codec.InterruptWrite(&TestArgs{UserInput: args.UserInput}) {
+		t.Fatal("expected the write of another request not to interrupt")
+	}
+	if !codec.InterruptWrite(args) {
+		t.Fatal("expected an in-progress write to interrupt")
+	}
+
+	select {
+	case <-call.Done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("call did not return promptly after InterruptWrite")
+	}
+	if e, ok := ParseError(call.Error); !ok || e != ErrWriteInterrupted {
+		t.Fatalf("expected ErrWriteInterrupted, got %v", call.Error)
+	}
+	if written := writer.written.Load(); written >= size {
+		t.Fatalf("expected the frame to be abandoned, but %d bytes were written", written)
+	}
+	if last := byte(writer.last.Load()); last != '\n' {
+		t.Fatalf("expected the abandoned frame to end with a newline, got %q", last)
+	}
+	if pending := codec.PendingClientRequests(); pending != 0 {
+		t.Fatalf("expected no pending client requests, got %d", pending)
+	}
+}
+
+func TestCodec_InterruptWrite_AbandonsQueuedFrame(t *testing.T) {
+	pr, pw := io.Pipe()
+	writer := &slowWriter{delay: 10 * time.Millisecond}
+	codec := newTestCodec(&pipeRWC{r: pr, w: writer})
+	client := rpc.NewClientWithCodec(codec)
+	defer client.Close()
+	defer pw.Close()
+
+	const size = 1 << 20
+	uploading := &TestArgs{UserInput: strings.Repeat("x", size)}
+	client.Go("Transport.Prompt", uploading, &TestReply{}, nil)
+	waitUntil(t, 1*time.Second, func() bool {
+		return writer.written.Load() > 0
+	})
+	// Go blocks until the codec takes up the frame, which waits for the upload.
+	queued, done := &TestArgs{UserInput: "hello"}, make(chan *rpc.Call, 1)
+	go client.Go("Transport.Prompt", queued, &TestReply{}, done)
+	waitUntil(t, 1*time.Second, func() bool {
+		return codec.InterruptWrite(queued)
+	})
+
+	var call *rpc.Call
+	select {
+	case call = <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("call did not return promptly after InterruptWrite")
+	}
+	if e, ok := ParseError(call.Error); !ok || e != ErrWriteInterrupted {
+		t.Fatalf("expected ErrWriteInterrupted, got %v", call.Error)
+	}
+	waitUntil(t, 5*time.Second, func() bool {
+		return writer.written.Load() > size
+	})
+	if last := byte(writer.last.Load()); last != '\n' {
+		t.Fatalf("expected the other frame to be written whole, got a last byte of %q", last)
+	}
+}
+
 func TestCodec_ShutdownTimeout_CustomValue(t *testing.T) {
 	c1, c2 := net.Pipe()
 	defer c2.Close()
@@ -0,0 +1,155 @@
+package jsonrpc2
+
+import (
+	"bufio"
+	"io"
+)
+
+// lenientReader rewrites a stream of loosely formatted JSON into standard JSON
+// before it reaches the decoder. It strips line (//) and block (/* */) comments
+// and drops trailing commas that directly precede a closing '}' or ']'.
+// String literals are passed through untouched.
+type lenientReader struct {
+	r        *bufio.Reader
+	pending  []byte
+	err      error
+	inString bool
+	escaped  bool
+}
+
+func newLenientReader(r io.Reader) *lenientReader {
+	return &lenientReader{r: bufio.NewReader(r)}
+}
+
+// Read fills p with as much rewritten input as is available without blocking
+// again once some is: it steps through the buffered input until p is full or
+// the buffer is empty.
+func (l *lenientReader) Read(p []byte) (int, error) {
+	for len(l.pending) == 0 || len(l.pending) < len(p) && l.r.Buffered() > 0 {
+		if l.err != nil {
+			if len(l.pending) > 0 {
+				break
+			}
+			return 0, l.err
+		}
+		l.err = l.step()
+	}
+	n := copy(p, l.pending)
+	// Keep the rest at the start of pending, so that its storage is reused.
+	l.pending = l.pending[:copy(l.pending, l.pending[n:])]
+	return n, nil
+}
+
+func (l *lenientReader) step() error {
+	b, err := l.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if l.inString {
+		switch {
+		case l.escaped:
+			l.escaped = false
+		case b == '\\':
+			l.escaped = true
+		case b == '"':
+			l.inString = false
+		}
+		l.pending = append(l.pending, b)
+		return nil
+	}
+	switch b {
+	case '"':
+		l.inString = true
+		l.pending = append(l.pending, b)
+	case '/':
+		replacement, skipped, err := l.skipComment()
+		if err != nil {
+			return err
+		}
+		if skipped {
+			l.pending = append(l.pending, replacement)
+		} else {
+			l.pending = append(l.pending, b)
+		}
+	case ',':
+		var gap []byte
+		for {
+			next, err := l.r.ReadByte()
+			if err != nil {
+				l.pending = append(append(l.pending, ','), gap...)
+				return err
+			}
+			if isJSONSpace(next) {
+				gap = append(gap, next)
+				continue
+			}
+			if next == '/' {
+				replacement, skipped, err := l.skipComment()
+				if err != nil {
+					l.pending = append(append(l.pending, ','), gap...)
+					return err
+				}
+				if skipped {
+					gap = append(gap, replacement)
+					continue
+				}
+				l.pending = append(append(append(l.pending, ','), gap...), next)
+				return nil
+			}
+			// SAFETY: the byte was just read by ReadByte, so UnreadByte cannot fail.
+			_ = l.r.UnreadByte()
+			if next != '}' && next != ']' {
+				l.pending = append(l.pending, ',')
+			}
+			l.pending = append(l.pending, gap...)
+			return nil
+		}
+	default:
+		l.pending = append(l.pending, b)
+	}
+	return nil
+}
+
+// skipComment is called right after a '/' has been consumed.
+// It reports whether a comment was found and skipped, along with the
+// whitespace byte that should take its place in the output.
+func (l *lenientReader) skipComment() (byte, bool, error) {
+	next, err := l.r.Peek(1)
+	if err != nil {
+		if err == io.EOF {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	switch next[0] {
+	case '/':
+		for {
+			b, err := l.r.ReadByte()
+			if err != nil {
+				return 0, true, err
+			}
+			if b == '\n' {
+				return '\n', true, nil
+			}
+		}
+	case '*':
+		l.r.ReadByte() //nolint:errcheck
+		var star bool
+		for {
+			b, err := l.r.ReadByte()
+			if err != nil {
+				return 0, true, err
+			}
+			if star && b == '/' {
+				return ' ', true, nil
+			}
+			star = b == '*'
+		}
+	default:
+		return 0, false, nil
+	}
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
@@ -2,8 +2,10 @@ package wire
 
 import (
 	"bytes"
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"slices"
 )
 
 type (
@@ -228,7 +230,7 @@ func (params *RequestParams) UnmarshalJSON(data []byte) (err error) {
 
 type PromptResultStatus string
 
-var (
+const (
 	PromptResultStatusPending         PromptResultStatus = "pending"
 	PromptResultStatusFinished        PromptResultStatus = "finished"
 	PromptResultStatusCancelled       PromptResultStatus = "cancelled"
@@ -236,6 +238,22 @@ var (
 	PromptResultStatusUnexpectedEOF   PromptResultStatus = "unexpected_eof"
 )
 
+// IsTerminal reports whether the turn has ended, i.e. the status is anything but pending.
+func (s PromptResultStatus) IsTerminal() bool {
+	return s != PromptResultStatusPending
+}
+
+// IsError reports whether the turn ended without the agent finishing its work.
+// A cancelled turn is not an error, since the caller asked for it.
+func (s PromptResultStatus) IsError() bool {
+	switch s {
+	case PromptResultStatusUnexpectedEOF, PromptResultStatusMaxStepsReached:
+		return true
+	default:
+		return false
+	}
+}
+
 func NewContent(contentParts ...ContentPart) Content {
 	return Content{
 		Type:         ContentTypeContentParts,
@@ -440,6 +458,28 @@ const (
 	ApprovalRequestResponseReject            ApprovalRequestResponse = "reject"
 )
 
+// Approve responds to the request with ApprovalRequestResponseApprove.
+func (r ApprovalRequest) Approve() error {
+	return r.respond(ApprovalRequestResponseApprove)
+}
+
+// ApproveForSession responds to the request with ApprovalRequestResponseApproveForSession.
+func (r ApprovalRequest) ApproveForSession() error {
+	return r.respond(ApprovalRequestResponseApproveForSession)
+}
+
+// Reject responds to the request with ApprovalRequestResponseReject.
+func (r ApprovalRequest) Reject() error {
+	return r.respond(ApprovalRequestResponseReject)
+}
+
+func (r ApprovalRequest) respond(response ApprovalRequestResponse) error {
+	if r.Responder == nil {
+		return fmt.Errorf("approval request %s has no responder", r.ID)
+	}
+	return r.Respond(response)
+}
+
 // ApprovalResponse is the response to an ApprovalRequest
 type ApprovalResponse struct {
 	RequestID string                  `json:"request_id"`
@@ -475,6 +515,23 @@ type DisplayBlock struct {
 	Command  Optional[string]                 `json:"command,omitzero"`
 }
 
+// NormalizeDisplayBlocks returns a copy of blocks ordered by the position of
+// their type in order. Blocks whose type is not listed come last. The relative
+// order of blocks that rank equally is preserved.
+func NormalizeDisplayBlocks(blocks []DisplayBlock, order []DisplayBlockType) []DisplayBlock {
+	rank := func(block DisplayBlock) int {
+		if i := slices.Index(order, block.Type); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	normalized := slices.Clone(blocks)
+	slices.SortStableFunc(normalized, func(a, b DisplayBlock) int {
+		return cmp.Compare(rank(a), rank(b))
+	})
+	return normalized
+}
+
 type DisplayBlockDataType string
 
 const (
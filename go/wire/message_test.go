@@ -3,6 +3,7 @@ package wire
 import (
 	"encoding/json"
 	"reflect"
+	"slices"
 	"testing"
 )
 
@@ -192,6 +193,28 @@ func TestPromptResult_UnmarshalJSON_NullSteps(t *testing.T) {
 	}
 }
 
+func TestPromptResultStatus_Predicates(t *testing.T) {
+	tests := []struct {
+		status   PromptResultStatus
+		terminal bool
+		isError  bool
+	}{
+		{PromptResultStatusPending, false, false},
+		{PromptResultStatusFinished, true, false},
+		{PromptResultStatusCancelled, true, false},
+		{PromptResultStatusMaxStepsReached, true, true},
+		{PromptResultStatusUnexpectedEOF, true, true},
+	}
+	for _, tt := range tests {
+		if got := tt.status.IsTerminal(); got != tt.terminal {
+			t.Errorf("%q.IsTerminal()=%v, want %v", tt.status, got, tt.terminal)
+		}
+		if got := tt.status.IsError(); got != tt.isError {
+			t.Errorf("%q.IsError()=%v, want %v", tt.status, got, tt.isError)
+		}
+	}
+}
+
 func TestApprovalRequest_MarshalJSON_IgnoresResponder(t *testing.T) {
 	ar := ApprovalRequest{
 		Responder:   badResponderFunc(func(RequestResponse) error { return nil }),
@@ -331,3 +354,66 @@ func TestRequestParams_UnmarshalJSON_UnknownTypeReturnsError(t *testing.T) {
 		t.Fatalf("expected error for unknown request type")
 	}
 }
+
+func TestNormalizeDisplayBlocks(t *testing.T) {
+	text := func(s string) Optional[string] { return Optional[string]{Value: s, Valid: true} }
+	blocks := []DisplayBlock{
+		{Type: DisplayBlockTypeShell, Command: text("ls")},
+		{Type: DisplayBlockTypeDiff, Path: text("a.go")},
+		{Type: DisplayBlockTypeUnknown},
+		{Type: DisplayBlockTypeBrief, Text: text("first")},
+		{Type: DisplayBlockTypeDiff, Path: text("b.go")},
+		{Type: DisplayBlockTypeBrief, Text: text("second")},
+	}
+	original := slices.Clone(blocks)
+
+	got := NormalizeDisplayBlocks(blocks, []DisplayBlockType{DisplayBlockTypeBrief, DisplayBlockTypeDiff, DisplayBlockTypeShell})
+	expected := []DisplayBlock{
+		{Type: DisplayBlockTypeBrief, Text: text("first")},
+		{Type: DisplayBlockTypeBrief, Text: text("second")},
+		{Type: DisplayBlockTypeDiff, Path: text("a.go")},
+		{Type: DisplayBlockTypeDiff, Path: text("b.go")},
+		{Type: DisplayBlockTypeShell, Command: text("ls")},
+		{Type: DisplayBlockTypeUnknown},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %+v, want %+v", got, expected)
+	}
+	if !reflect.DeepEqual(blocks, original) {
+		t.Error("expected the input slice to be left unchanged")
+	}
+}
+
+func TestApprovalRequest_ResponseHelpers(t *testing.T) {
+	tests := []struct {
+		name     string
+		respond  func(ApprovalRequest) error
+		expected ApprovalRequestResponse
+	}{
+		{"Approve", ApprovalRequest.Approve, ApprovalRequestResponseApprove},
+		{"ApproveForSession", ApprovalRequest.ApproveForSession, ApprovalRequestResponseApproveForSession},
+		{"Reject", ApprovalRequest.Reject, ApprovalRequestResponseReject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []RequestResponse
+			req := ApprovalRequest{
+				ID: "req-1",
+				Responder: badResponderFunc(func(r RequestResponse) error {
+					sent = append(sent, r)
+					return nil
+				}),
+			}
+			if err := tt.respond(req); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if !reflect.DeepEqual(sent, []RequestResponse{tt.expected}) {
+				t.Errorf("expected %v to be sent, got %v", tt.expected, sent)
+			}
+		})
+	}
+
+	if err := (ApprovalRequest{ID: "req-2"}).Approve(); err == nil {
+		t.Error("expected an error for a request without a responder")
+	}
+}
@@ -0,0 +1,91 @@
+package kimi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// ErrWriteConflict is reported to the model, as the result of a tool call, when
+// the call would write a file that another call in flight is writing and the
+// policy is WriteConflictReject.
+var ErrWriteConflict = errors.New("write conflict")
+
+// WriteConflictPolicy decides what happens when tool calls writing the same
+// file, as declared with WithFileWrite, run concurrently.
+type WriteConflictPolicy int
+
+const (
+	// WriteConflictAllow runs the calls concurrently. It is the default.
+	WriteConflictAllow WriteConflictPolicy = iota
+	// WriteConflictSerialize runs the calls one after the other.
+	WriteConflictSerialize
+	// WriteConflictReject fails the calls that arrive while another call is
+	// writing the same file, with ErrWriteConflict.
+	WriteConflictReject
+)
+
+// writePathFunc returns a function extracting the path written by a call from
+// its arguments, according to WithFileWrite.
+func writePathFunc(pathField string) func(args json.RawMessage) (string, bool) {
+	if pathField == "" {
+		return nil
+	}
+	return func(args json.RawMessage) (string, bool) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(args, &fields); err != nil {
+			return "", false
+		}
+		var path string
+		if err := json.Unmarshal(fields[pathField], &path); err != nil || path == "" {
+			return "", false
+		}
+		return filepath.Clean(path), true
+	}
+}
+
+// writeLocks tracks the files written by the tool calls in flight.
+type writeLocks struct {
+	policy WriteConflictPolicy
+
+	mu    sync.Mutex
+	paths map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+func newWriteLocks(policy WriteConflictPolicy) *writeLocks {
+	return &writeLocks{policy: policy, paths: make(map[string]*pathLock)}
+}
+
+// acquire waits until the call may write path, or fails if it may not, and
+// returns the function to call once the call has returned.
+func (w *writeLocks) acquire(path string) (release func(), err error) {
+	w.mu.Lock()
+	lock, busy := w.paths[path]
+	if busy && w.policy == WriteConflictReject {
+		w.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s is being written by another tool call; retry once it has finished", ErrWriteConflict, path)
+	}
+	if !busy {
+		lock = &pathLock{}
+		w.paths[path] = lock
+	}
+	lock.refs++
+	w.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		w.mu.Lock()
+		if lock.refs--; lock.refs == 0 {
+			delete(w.paths, path)
+		}
+		w.mu.Unlock()
+	}, nil
+}